@@ -0,0 +1,199 @@
+package edurouter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// ConflictDetection configures the IPv4 address conflict detection of RFC 5227
+type ConflictDetection struct {
+	// ProbeWait is the maximum random delay before the first probe
+	ProbeWait time.Duration
+	// ProbeNum is the number of probes sent
+	ProbeNum int
+	// ProbeMin and ProbeMax bound the random delay between two probes
+	ProbeMin time.Duration
+	ProbeMax time.Duration
+	// AnnounceWait is the delay after the last probe before the address is used
+	AnnounceWait time.Duration
+	// AnnounceNum is the number of announcements sent once the address is used
+	AnnounceNum int
+	// AnnounceInterval is the delay between two announcements
+	AnnounceInterval time.Duration
+	// DefendInterval is the minimum delay between two announcements defending the address
+	DefendInterval time.Duration
+}
+
+// DefaultConflictDetection uses the protocol constants of RFC 5227
+var DefaultConflictDetection = ConflictDetection{
+	ProbeWait:        1 * time.Second,
+	ProbeNum:         3,
+	ProbeMin:         1 * time.Second,
+	ProbeMax:         2 * time.Second,
+	AnnounceWait:     2 * time.Second,
+	AnnounceNum:      2,
+	AnnounceInterval: 2 * time.Second,
+	DefendInterval:   10 * time.Second,
+}
+
+// addressConflictDetector probes for the emulated address of an interface before it is used, and defends it afterwards
+type addressConflictDetector struct {
+	config      ConflictDetection
+	iface       *InterfaceConfig
+	writer      *ARPv4Writer
+	probing     bool
+	conflict    chan net.HardwareAddr
+	lastDefense time.Time
+	mu          sync.Mutex
+}
+
+func newAddressConflictDetector(iface *InterfaceConfig, config ConflictDetection) *addressConflictDetector {
+	writer := NewARPv4Writer(iface)
+	writer.Initialize(iface.transport)
+
+	return &addressConflictDetector{
+		config:   config,
+		iface:    iface,
+		writer:   writer,
+		probing:  true,
+		conflict: make(chan net.HardwareAddr, 1),
+	}
+}
+
+// probe sends the ARP probes and waits for conflicting packets.
+// It returns an error wrapping ErrAddressConflict if another host uses the address.
+func (d *addressConflictDetector) probe(ctx context.Context) error {
+	ip := d.iface.Addr.IP
+
+	if err := d.wait(ctx, randomDuration(0, d.config.ProbeWait)); err != nil {
+		return err
+	}
+
+	for i := 0; i < d.config.ProbeNum; i++ {
+		Logger(LogSubsystemARP).Debug().
+			Str("iface", d.iface.InterfaceName).
+			Stringer("ip", ip).
+			Int("probe", i+1).
+			Msg("probing address")
+
+		if err := d.writer.SendArpProbe(ip); err != nil {
+			return err
+		}
+
+		delay := randomDuration(d.config.ProbeMin, d.config.ProbeMax)
+		if i == d.config.ProbeNum-1 {
+			delay = d.config.AnnounceWait
+		}
+
+		if err := d.wait(ctx, delay); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	d.probing = false
+	d.mu.Unlock()
+	return nil
+}
+
+// wait returns early if a conflict is observed or ctx is done
+func (d *addressConflictDetector) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case hwAddr := <-d.conflict:
+		return fmt.Errorf("%w: %s is used by %s", ErrAddressConflict, d.iface.Addr.IP, hwAddr)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// announce claims the address with the configured number of announcements
+func (d *addressConflictDetector) announce(ctx context.Context) {
+	for i := 0; i < d.config.AnnounceNum; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.config.AnnounceInterval):
+			}
+		}
+
+		if err := d.writer.SendArpAnnouncement(); err != nil {
+			Logger(LogSubsystemARP).Error().Msgf("error during arp announcement: %v", err)
+			return
+		}
+	}
+}
+
+// isProbing reports whether the address is not used yet, the interface must not answer ARP requests for it then
+func (d *addressConflictDetector) isProbing() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.probing
+}
+
+// observe checks a received ARP packet for a conflict with the address of the interface and reports whether it conflicts.
+// While probing, a conflict aborts the probe. Afterwards the address is defended at most once per DefendInterval.
+func (d *addressConflictDetector) observe(packet *ARPv4Pdu) bool {
+	if bytes.Equal(packet.SrcHardwareAddr, *d.iface.HardwareAddr) {
+		// our own packet
+		return false
+	}
+
+	ip := d.iface.Addr.IP
+	senderIsUs := bytes.Equal(packet.SrcProtoAddr, ip)
+	// another host probing for the same address
+	concurrentProbe := packet.Operation == ARPOperationRequest && net.IP(packet.SrcProtoAddr).Equal(net.IPv4zero) && bytes.Equal(packet.DstProtoAddr, ip)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.probing {
+		if senderIsUs || concurrentProbe {
+			select {
+			case d.conflict <- net.HardwareAddr(packet.SrcHardwareAddr):
+			default:
+			}
+		}
+		return senderIsUs || concurrentProbe
+	}
+
+	if !senderIsUs {
+		return false
+	}
+
+	log := Logger(LogSubsystemARP).Warn().
+		Str("iface", d.iface.InterfaceName).
+		Stringer("ip", ip).
+		Stringer("hw_addr", net.HardwareAddr(packet.SrcHardwareAddr))
+
+	if time.Since(d.lastDefense) < d.config.DefendInterval {
+		log.Msg("address conflict, already defended recently")
+		return true
+	}
+
+	d.lastDefense = time.Now()
+	log.Msg("address conflict, defending address")
+
+	if err := d.writer.SendArpAnnouncement(); err != nil {
+		Logger(LogSubsystemARP).Error().Msgf("error during arp announcement: %v", err)
+	}
+	return true
+}
+
+func randomDuration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
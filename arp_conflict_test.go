@@ -0,0 +1,160 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+var fastConflictDetection = edurouter.ConflictDetection{
+	ProbeNum:         3,
+	ProbeMin:         10 * time.Millisecond,
+	ProbeMax:         20 * time.Millisecond,
+	AnnounceWait:     20 * time.Millisecond,
+	AnnounceNum:      2,
+	AnnounceInterval: 10 * time.Millisecond,
+	DefendInterval:   time.Second,
+}
+
+// nextARP returns the next ARP packet received on frameCh, skipping other frames
+func nextARP(t *testing.T, frameCh <-chan *ethernet.Frame) *edurouter.ARPv4Pdu {
+	for {
+		f := receiveFrame(frameCh, time.Second)
+		require.NotNil(t, f, "no ARP packet received")
+
+		if f.EtherType != ethernet.EtherTypeARP {
+			continue
+		}
+
+		var packet edurouter.ARPv4Pdu
+		require.NoError(t, (&packet).UnmarshalBinary(f.Payload))
+		return &packet
+	}
+}
+
+func writeARP(t *testing.T, port *edurouter.VirtualSwitchPort, op edurouter.ARPOperation, srcIP, dstIP net.IP, dstHwAddr net.HardwareAddr) {
+	packet := edurouter.ARPv4Pdu{
+		HTYPE:           edurouter.HTYPEEthernet,
+		PTYPE:           ethernet.EtherTypeIPv4,
+		HLEN:            edurouter.HardwareAddrLen,
+		PLEN:            net.IPv4len,
+		Operation:       op,
+		SrcHardwareAddr: port.HardwareAddr(),
+		SrcProtoAddr:    srcIP,
+		DstHardwareAddr: edurouter.EmptyHardwareAddr,
+		DstProtoAddr:    dstIP,
+	}
+
+	payload, err := packet.MarshalBinary()
+	require.NoError(t, err)
+
+	writeFrame(t, port, &ethernet.Frame{
+		Destination: dstHwAddr,
+		Source:      port.HardwareAddr(),
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     payload,
+	})
+}
+
+// newProbingInterface returns an interface on a new segment which probes for 10.0.1.1, and a host on that segment
+func newProbingInterface(t *testing.T) (*edurouter.InterfaceConfig, *edurouter.VirtualSwitchPort) {
+	segment := edurouter.NewVirtualSwitch()
+
+	iface, err := edurouter.NewInterfaceConfig("eth1", &net.IPNet{IP: net.IP{10, 0, 1, 1}, Mask: net.CIDRMask(24, 32)})
+	require.NoError(t, err)
+	iface.Transport = segment.NewPort(net.HardwareAddr{2, 0, 0, 0, 1, 1})
+
+	conflictDetection := fastConflictDetection
+	iface.ConflictDetection = &conflictDetection
+
+	host := segment.NewPort(net.HardwareAddr{2, 0, 0, 0, 1, 100})
+	require.NoError(t, host.Open(nil))
+
+	return iface, host
+}
+
+func TestConflictDetection_ProbeAndAnnounce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := newVirtualRouter(t, ctx, 1, []*edurouter.VirtualSwitch{edurouter.NewVirtualSwitch()}, []string{"10.0.0.1/24"})
+
+	iface, host := newProbingInterface(t)
+	hostFrames := readFrames(host)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.listener.AddInterface(iface)
+	}()
+
+	for i := 0; i < fastConflictDetection.ProbeNum; i++ {
+		probe := nextARP(t, hostFrames)
+		assert.EqualValues(t, edurouter.ARPOperationRequest, probe.Operation)
+		assert.EqualValues(t, net.IPv4zero.To4(), probe.SrcProtoAddr)
+		assert.EqualValues(t, iface.Addr.IP, probe.DstProtoAddr)
+
+		// the address is not answered for while it is probed
+		writeARP(t, host, edurouter.ARPOperationRequest, net.IP{10, 0, 1, 100}, iface.Addr.IP, ethernet.Broadcast)
+	}
+
+	for i := 0; i < fastConflictDetection.AnnounceNum; i++ {
+		announcement := nextARP(t, hostFrames)
+		assert.EqualValues(t, edurouter.ARPOperationRequest, announcement.Operation)
+		assert.EqualValues(t, iface.Addr.IP, announcement.SrcProtoAddr)
+		assert.EqualValues(t, iface.Addr.IP, announcement.DstProtoAddr)
+	}
+
+	require.NoError(t, <-done)
+	assert.Len(t, r.listener.Interfaces(), 2)
+
+	// requests are answered once the address is used
+	writeARP(t, host, edurouter.ARPOperationRequest, net.IP{10, 0, 1, 100}, iface.Addr.IP, ethernet.Broadcast)
+	reply := nextARP(t, hostFrames)
+	assert.EqualValues(t, edurouter.ARPOperationResponse, reply.Operation)
+
+	// a host claiming the address is answered with an announcement, but only once per DefendInterval
+	writeARP(t, host, edurouter.ARPOperationRequest, iface.Addr.IP, iface.Addr.IP, ethernet.Broadcast)
+	defense := nextARP(t, hostFrames)
+	assert.EqualValues(t, iface.Addr.IP, defense.SrcProtoAddr)
+	assert.EqualValues(t, iface.Addr.IP, defense.DstProtoAddr)
+
+	writeARP(t, host, edurouter.ARPOperationRequest, iface.Addr.IP, iface.Addr.IP, ethernet.Broadcast)
+	assert.Nil(t, receiveFrame(hostFrames, 50*time.Millisecond))
+}
+
+func TestConflictDetection_Conflict(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := newVirtualRouter(t, ctx, 1, []*edurouter.VirtualSwitch{edurouter.NewVirtualSwitch()}, []string{"10.0.0.1/24"})
+
+	iface, host := newProbingInterface(t)
+	hostFrames := readFrames(host)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.listener.AddInterface(iface)
+	}()
+
+	// the host owns the address and answers the probe
+	probe := nextARP(t, hostFrames)
+	writeARP(t, host, edurouter.ARPOperationResponse, iface.Addr.IP, net.IPv4zero.To4(), net.HardwareAddr(probe.SrcHardwareAddr))
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, edurouter.ErrAddressConflict)
+		assert.ErrorContains(t, err, "10.0.1.1 is used by 02:00:00:00:01:64")
+	case <-time.After(time.Second):
+		t.Fatal("probing did not finish")
+	}
+
+	assert.Len(t, r.listener.Interfaces(), 1)
+	for _, route := range r.listener.RouteTable().GetRoutes() {
+		assert.NotSame(t, iface, route.OutInterface)
+	}
+}
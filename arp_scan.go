@@ -0,0 +1,203 @@
+package edurouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxARPScanAddresses limits the size of the network scanned by ARPv4Table.Scan
+const MaxARPScanAddresses = 4096
+
+// ARPScanResult is a host which answered an ARP scan
+type ARPScanResult struct {
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	ResponseTime time.Duration
+}
+
+// arpScanProbe is a request sent by a scan, whose entry is cleaned up after the scan
+type arpScanProbe struct {
+	ip       net.IP
+	entry    *arpEntry
+	resolved chan struct{}
+}
+
+// Scan sends one ARP request to every address of network, one every interval, and waits up to timeout for late replies.
+// Replies are stored in the table like replies to any other request. Addresses which did not answer are not kept.
+// The results are ordered by IP address. If ctx is done, the hosts found so far are returned.
+// If a request can not be sent, the scan stops and the hosts found so far are returned with the error.
+func (a *ARPv4Table) Scan(ctx context.Context, network *net.IPNet, interval, timeout time.Duration) ([]ARPScanResult, error) {
+	addrs, err := scanAddresses(network, a.ifconfig.Addr.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ARPScanResult
+	var finished bool
+	var mu sync.Mutex
+
+	var sendErr error
+	var probes []arpScanProbe
+	defer func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+
+		for _, p := range probes {
+			a.finishScanProbe(p)
+		}
+	}()
+
+	for i, ip := range addrs {
+		if i > 0 && !sleepContext(ctx, interval) {
+			break
+		}
+
+		ip := ip
+		sent := time.Now()
+		probe := a.solicit(ip, func(hwAddr net.HardwareAddr, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil || finished {
+				return
+			}
+
+			results = append(results, ARPScanResult{
+				IP:           ip,
+				HardwareAddr: hwAddr,
+				ResponseTime: time.Since(sent),
+			})
+		})
+		if probe.resolved != nil {
+			probes = append(probes, probe)
+		}
+
+		sendErr = a.arpWriter.SendArpRequest(ip)
+		if sendErr != nil {
+			break
+		}
+	}
+
+	sleepContext(ctx, timeout)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	sort.Slice(results, func(i, j int) bool { return bytes.Compare(results[i].IP, results[j].IP) < 0 })
+
+	// the results must not be appended to once they are returned
+	finished = true
+	return results, sendErr
+}
+
+// solicit marks ipAddr as being resolved, so its reply is accepted, and queues done for the reply.
+// The returned probe has a nil resolved channel if the entry was resolved by another goroutine already.
+func (a *ARPv4Table) solicit(ipAddr net.IP, done ARPResolvedFunc) arpScanProbe {
+	ipv4NumFormat := binary.BigEndian.Uint32(ipAddr)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.entries[ipv4NumFormat]
+	if !ok {
+		e = &arpEntry{
+			state:   ARPStateIncomplete,
+			updated: time.Now(),
+		}
+		a.entries[ipv4NumFormat] = e
+	}
+
+	e.pending = append(e.pending, done)
+
+	if e.resolved != nil {
+		// the resolving goroutine cleans up the entry
+		return arpScanProbe{ip: ipAddr}
+	}
+
+	e.resolved = make(chan struct{})
+	return arpScanProbe{ip: ipAddr, entry: e, resolved: e.resolved}
+}
+
+// finishScanProbe cleans up the entry of a request which was not answered.
+// Resolutions queued by others in the meantime are handed over to a resolving goroutine.
+func (a *ARPv4Table) finishScanProbe(p arpScanProbe) {
+	ipv4NumFormat := binary.BigEndian.Uint32(p.ip)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e := p.entry
+	if a.entries[ipv4NumFormat] != e || e.resolved != p.resolved {
+		// answered or removed
+		return
+	}
+
+	if len(e.pending) > 1 {
+		var unicastHwAddr net.HardwareAddr
+		if e.state == ARPStateStale {
+			unicastHwAddr = e.hwAddr
+		}
+
+		go a.resolve(p.ip, e, e.resolved, unicastHwAddr, a.timeouts)
+		return
+	}
+
+	// the scan ignores results after it finished, the queued resolution can be dropped
+	e.pending = nil
+	e.resolved = nil
+
+	if e.state == ARPStateIncomplete {
+		delete(a.entries, ipv4NumFormat)
+	}
+}
+
+// scanAddresses returns the addresses of network without the network and broadcast addresses and without self
+func scanAddresses(network *net.IPNet, self net.IP) ([]net.IP, error) {
+	ip := network.IP.To4()
+	if ip == nil || len(network.Mask) != net.IPv4len {
+		return nil, ErrNotAnIPv4Address
+	}
+
+	first := binary.BigEndian.Uint32(ip.Mask(network.Mask))
+	last := first | ^binary.BigEndian.Uint32(network.Mask)
+
+	if last-first >= MaxARPScanAddresses {
+		return nil, ErrARPScanRangeTooLarge
+	}
+
+	if last-first > 1 {
+		// /31 and /32 networks have no network and broadcast addresses
+		first++
+		last--
+	}
+
+	var addrs []net.IP
+	for n := first; n <= last && n >= first; n++ {
+		addr := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(addr, n)
+
+		if !addr.Equal(self) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// sleepContext returns false if ctx is done before d elapsed
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,128 @@
+package edurouter_test
+
+import (
+	"context"
+	"errors"
+	"github.com/davidkroell/edurouter"
+	"github.com/davidkroell/edurouter/internal/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestARPv4Table_Scan(t *testing.T) {
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	hosts := map[string]net.HardwareAddr{
+		"192.168.100.3": {0, 1, 2, 3, 4, 3},
+		"192.168.100.5": {0, 1, 2, 3, 4, 5},
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+		arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+		// replies to the scan are solicited
+		arpTable.SetLearningPolicy(edurouter.ARPLearningPolicy{SolicitedOnly: true})
+
+		var requested []string
+		mockArpWriter.EXPECT().SendArpRequest(gomock.Any()).Times(5).DoAndReturn(func(ip net.IP) error {
+			requested = append(requested, ip.String())
+
+			if hwAddr, ok := hosts[ip.String()]; ok {
+				go func() {
+					time.Sleep(5 * time.Millisecond)
+					assert.NoError(t, arpTable.StoreReply(ip, hwAddr))
+				}()
+			}
+			return nil
+		})
+
+		_, network, _ := net.ParseCIDR("192.168.100.0/29")
+		results, err := arpTable.Scan(context.Background(), network, time.Millisecond, 50*time.Millisecond)
+		require.NoError(t, err)
+
+		// network, broadcast and own address are not scanned
+		assert.Equal(t, []string{"192.168.100.2", "192.168.100.3", "192.168.100.4", "192.168.100.5", "192.168.100.6"}, requested)
+
+		require.Len(t, results, 2)
+		for i, ip := range []string{"192.168.100.3", "192.168.100.5"} {
+			assert.Equal(t, ip, results[i].IP.String())
+			assert.EqualValues(t, hosts[ip], results[i].HardwareAddr)
+			assert.GreaterOrEqual(t, results[i].ResponseTime, 5*time.Millisecond)
+		}
+
+		// addresses which did not answer are not kept
+		entries := arpTable.Entries()
+		require.Len(t, entries, 2)
+		for _, e := range entries {
+			assert.Equal(t, edurouter.ARPStateReachable, e.State)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+		arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		mockArpWriter.EXPECT().SendArpRequest(gomock.Any()).Times(1).DoAndReturn(func(ip net.IP) error {
+			cancel()
+			return nil
+		})
+
+		results, err := arpTable.Scan(ctx, config.Addr, time.Second, time.Second)
+		require.NoError(t, err)
+		assert.Empty(t, results)
+		assert.Empty(t, arpTable.Entries())
+	})
+
+	t.Run("SendFailed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+		arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+		arpTable.SetLearningPolicy(edurouter.ARPLearningPolicy{SolicitedOnly: true})
+
+		sendErr := errors.New("interface is down")
+		mockArpWriter.EXPECT().SendArpRequest(gomock.Any()).Times(4).DoAndReturn(func(ip net.IP) error {
+			if ip.String() == "192.168.100.5" {
+				return sendErr
+			}
+
+			if hwAddr, ok := hosts[ip.String()]; ok {
+				go func() {
+					time.Sleep(5 * time.Millisecond)
+					assert.NoError(t, arpTable.StoreReply(ip, hwAddr))
+				}()
+			}
+			return nil
+		})
+
+		_, network, _ := net.ParseCIDR("192.168.100.0/29")
+		results, err := arpTable.Scan(context.Background(), network, time.Millisecond, 50*time.Millisecond)
+		assert.ErrorIs(t, err, sendErr)
+
+		// the hosts found before the failure are returned
+		require.Len(t, results, 1)
+		assert.Equal(t, "192.168.100.3", results[0].IP.String())
+	})
+
+	t.Run("RangeTooLarge", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		arpTable := edurouter.NewARPv4Table(config, mocks.NewMockARPWriter(ctrl))
+
+		_, network, _ := net.ParseCIDR("10.0.0.0/8")
+		_, err := arpTable.Scan(context.Background(), network, time.Millisecond, time.Millisecond)
+		assert.ErrorIs(t, err, edurouter.ErrARPScanRangeTooLarge)
+	})
+}
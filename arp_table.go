@@ -1,28 +1,199 @@
 package edurouter
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"net"
+	"sort"
 	"sync"
 	"time"
 )
 
+// ARPEntryState is the state of a neighbor in the ARP table, modelled after the Linux neighbor subsystem
+type ARPEntryState uint8
+
+const (
+	// ARPStateIncomplete entries are being resolved and have no hardware address yet
+	ARPStateIncomplete ARPEntryState = 0
+	// ARPStateReachable entries were confirmed recently and are used without further checks
+	ARPStateReachable ARPEntryState = 1
+	// ARPStateStale entries have a hardware address which must be revalidated before it is used again
+	ARPStateStale ARPEntryState = 2
+	// ARPStateFailed entries did not answer. Resolving them fails immediately until the entry expires.
+	ARPStateFailed ARPEntryState = 3
+)
+
+func (s ARPEntryState) String() string {
+	switch s {
+	case ARPStateIncomplete:
+		return "incomplete"
+	case ARPStateReachable:
+		return "reachable"
+	case ARPStateStale:
+		return "stale"
+	case ARPStateFailed:
+		return "failed"
+	default:
+		return ""
+	}
+}
+
+// ARPTimeouts configures the aging of ARP table entries
+type ARPTimeouts struct {
+	// ReachableTime after which a confirmed entry becomes stale
+	ReachableTime time.Duration
+	// StaleTime after which an unused stale entry is removed
+	StaleTime time.Duration
+	// FailedTime for which a failed entry is kept, before it is resolved again
+	FailedTime time.Duration
+	// RetransTime between two ARP requests for the same address
+	RetransTime time.Duration
+	// MaxProbes is the number of ARP requests sent before resolving fails
+	MaxProbes int
+	// GCInterval between two runs of the expiry goroutine
+	GCInterval time.Duration
+	// QueueLength is the number of packets waiting per address while it is resolved
+	QueueLength int
+}
+
+var DefaultARPTimeouts = ARPTimeouts{
+	ReachableTime: 30 * time.Second,
+	StaleTime:     60 * time.Second,
+	FailedTime:    3 * time.Second,
+	RetransTime:   100 * time.Millisecond,
+	MaxProbes:     10,
+	GCInterval:    time.Second,
+	QueueLength:   16,
+}
+
+// ARPEntry is a snapshot of a neighbor in the ARP table
+type ARPEntry struct {
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	State        ARPEntryState
+	// Static entries are configured manually and never age
+	Static bool
+	// Updated is the time the entry was last confirmed, or resolving it started or failed
+	Updated time.Time
+}
+
+type arpEntry struct {
+	hwAddr  net.HardwareAddr
+	state   ARPEntryState
+	static  bool
+	updated time.Time
+
+	// pending resolutions are called once the entry is confirmed or resolving failed
+	pending []ARPResolvedFunc
+	// resolved is closed when the entry is confirmed, it is nil while no ARP requests are sent
+	resolved chan struct{}
+}
+
 type ARPv4Table struct {
-	ifconfig     *InterfaceConfig
-	ipv4ToMacMap map[uint32]net.HardwareAddr
-	arpWriter    ARPWriter
-	mu           sync.Mutex
+	ifconfig  *InterfaceConfig
+	entries   map[uint32]*arpEntry
+	arpWriter ARPWriter
+	timeouts  ARPTimeouts
+	policy    ARPLearningPolicy
+	mu        sync.Mutex
 }
 
 func NewARPv4Table(ifconfig *InterfaceConfig, arpWriter ARPWriter) *ARPv4Table {
 	return &ARPv4Table{
-		ifconfig:     ifconfig,
-		ipv4ToMacMap: make(map[uint32]net.HardwareAddr),
-		arpWriter:    arpWriter,
-		mu:           sync.Mutex{}}
+		ifconfig:  ifconfig,
+		entries:   make(map[uint32]*arpEntry),
+		arpWriter: arpWriter,
+		timeouts:  DefaultARPTimeouts,
+		policy:    DefaultARPLearningPolicy,
+		mu:        sync.Mutex{}}
 }
 
+func (a *ARPv4Table) SetTimeouts(timeouts ARPTimeouts) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.timeouts = timeouts
+}
+
+func (a *ARPv4Table) Timeouts() ARPTimeouts {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.timeouts
+}
+
+// ARPLearningPolicy decides which received packets update the ARP table
+type ARPLearningPolicy struct {
+	// SolicitedOnly accepts only replies to ARP requests sent while resolving an address
+	SolicitedOnly bool
+	// LearnFromIP updates entries from the source addresses of received IPv4 packets
+	LearnFromIP bool
+	// LockStatic protects static entries from being overwritten with another hardware address
+	LockStatic bool
+}
+
+var DefaultARPLearningPolicy = ARPLearningPolicy{
+	LearnFromIP: true,
+	LockStatic:  true,
+}
+
+// arpLearnSource is where the hardware address of an entry was learnt from
+type arpLearnSource uint8
+
+const (
+	arpLearnManual arpLearnSource = 0
+	arpLearnReply  arpLearnSource = 1
+	arpLearnIPv4   arpLearnSource = 2
+)
+
+func (s arpLearnSource) String() string {
+	switch s {
+	case arpLearnReply:
+		return "arp reply"
+	case arpLearnIPv4:
+		return "ipv4 packet"
+	default:
+		return "manual"
+	}
+}
+
+// Store confirms that ipAddr is reachable at macAddr, regardless of the learning policy. Static entries keep being static.
 func (a *ARPv4Table) Store(ipAddr, macAddr []byte) error {
+	return a.store(ipAddr, macAddr, false, arpLearnManual)
+}
+
+// StoreStatic adds an entry which never ages, replacing a dynamic entry of the same address
+func (a *ARPv4Table) StoreStatic(ipAddr, macAddr []byte) error {
+	return a.store(ipAddr, macAddr, true, arpLearnManual)
+}
+
+// StoreReply learns the sender of an ARP reply, if the learning policy accepts it.
+// Unsolicited replies are rejected with ErrUnsolicitedARPReply if only solicited ones are accepted.
+func (a *ARPv4Table) StoreReply(ipAddr, macAddr []byte) error {
+	return a.store(ipAddr, macAddr, false, arpLearnReply)
+}
+
+// StoreFromIPv4 learns the sender of an IPv4 packet, if the learning policy allows learning from IP traffic
+func (a *ARPv4Table) StoreFromIPv4(ipAddr, macAddr []byte) error {
+	return a.store(ipAddr, macAddr, false, arpLearnIPv4)
+}
+
+func (a *ARPv4Table) SetLearningPolicy(policy ARPLearningPolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.policy = policy
+}
+
+func (a *ARPv4Table) LearningPolicy() ARPLearningPolicy {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.policy
+}
+
+func (a *ARPv4Table) store(ipAddr, macAddr []byte, static bool, source arpLearnSource) error {
 	if len(macAddr) != HardwareAddrLen {
 		return ErrNotAnMACHardwareAddress
 	}
@@ -31,50 +202,384 @@ func (a *ARPv4Table) Store(ipAddr, macAddr []byte) error {
 		return ErrNotAnIPv4Address
 	}
 
+	ipv4NumFormat := binary.BigEndian.Uint32(ipAddr)
+
+	a.mu.Lock()
+
+	e, ok := a.entries[ipv4NumFormat]
+
+	err := a.checkLearningPolicy(ipAddr, macAddr, e, source)
+	if err != nil {
+		a.mu.Unlock()
+		return err
+	}
+
+	if !ok {
+		e = &arpEntry{}
+		a.entries[ipv4NumFormat] = e
+	}
+
+	if source != arpLearnManual && e.hwAddr != nil && !bytes.Equal(e.hwAddr, macAddr) {
+		Logger(LogSubsystemARP).Warn().
+			Str("iface", a.ifconfig.InterfaceName).
+			Stringer("ip", net.IP(ipAddr)).
+			Stringer("old_hw_addr", e.hwAddr).
+			Stringer("hw_addr", net.HardwareAddr(macAddr)).
+			Str("source", source.String()).
+			Msg("hardware address changed")
+	}
+
+	e.hwAddr = macAddr
+	e.state = ARPStateReachable
+	e.static = e.static || static
+	e.updated = time.Now()
+
+	// flush the resolutions waiting for this address
+	pending := e.pending
+	e.pending = nil
+	if e.resolved != nil {
+		close(e.resolved)
+		e.resolved = nil
+	}
+
+	a.mu.Unlock()
+
+	for _, done := range pending {
+		done(macAddr, nil)
+	}
+	return nil
+}
+
+// checkLearningPolicy must be called with a.mu held. e is nil if there is no entry for ipAddr yet.
+func (a *ARPv4Table) checkLearningPolicy(ipAddr, macAddr []byte, e *arpEntry, source arpLearnSource) error {
+	switch source {
+	case arpLearnManual:
+		return nil
+	case arpLearnIPv4:
+		if !a.policy.LearnFromIP {
+			return ErrARPLearningDisabled
+		}
+	case arpLearnReply:
+		if a.policy.SolicitedOnly && (e == nil || e.resolved == nil) {
+			return ErrUnsolicitedARPReply
+		}
+	}
+
+	if e != nil && e.static && a.policy.LockStatic && !bytes.Equal(e.hwAddr, macAddr) {
+		Logger(LogSubsystemARP).Warn().
+			Str("iface", a.ifconfig.InterfaceName).
+			Stringer("ip", net.IP(ipAddr)).
+			Stringer("static_hw_addr", e.hwAddr).
+			Stringer("hw_addr", net.HardwareAddr(macAddr)).
+			Str("source", source.String()).
+			Msg("static entry not overwritten")
+		return ErrARPEntryLocked
+	}
+	return nil
+}
+
+// Lookup returns the entry of ipAddr without resolving it
+func (a *ARPv4Table) Lookup(ipAddr net.IP) (ARPEntry, bool) {
+	if len(ipAddr) != net.IPv4len {
+		return ARPEntry{}, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.entries[binary.BigEndian.Uint32(ipAddr)]
+	if !ok {
+		return ARPEntry{}, false
+	}
+
+	a.age(e, time.Now())
+	return e.snapshot(ipAddr), true
+}
+
+// Entries returns all entries ordered by IP address
+func (a *ARPv4Table) Entries() []ARPEntry {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	keys := make([]uint32, 0, len(a.entries))
+	for k := range a.entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	now := time.Now()
+	entries := make([]ARPEntry, len(keys))
+	for i, k := range keys {
+		e := a.entries[k]
+		a.age(e, now)
+
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, k)
+		entries[i] = e.snapshot(ip)
+	}
+	return entries
+}
+
+// Delete removes the entry of ipAddr, static or not. Resolutions waiting for it fail with ErrARPEntryRemoved.
+func (a *ARPv4Table) Delete(ipAddr net.IP) error {
+	if len(ipAddr) != net.IPv4len {
+		return ErrNotAnIPv4Address
+	}
+
 	ipv4NumFormat := binary.BigEndian.Uint32(ipAddr)
-	a.ipv4ToMacMap[ipv4NumFormat] = macAddr
+
+	a.mu.Lock()
+
+	e, ok := a.entries[ipv4NumFormat]
+	if !ok {
+		a.mu.Unlock()
+		return ErrNoSuchARPEntry
+	}
+
+	pending := a.removeLocked(ipv4NumFormat, e)
+	a.mu.Unlock()
+
+	for _, done := range pending {
+		done(nil, ErrARPEntryRemoved)
+	}
 	return nil
 }
 
+// Flush removes all dynamic entries, and the static ones too if includeStatic is set.
+// It returns the number of removed entries.
+func (a *ARPv4Table) Flush(includeStatic bool) int {
+	a.mu.Lock()
+
+	var pending []ARPResolvedFunc
+	var n int
+
+	for k, e := range a.entries {
+		if e.static && !includeStatic {
+			continue
+		}
+
+		pending = append(pending, a.removeLocked(k, e)...)
+		n++
+	}
+
+	a.mu.Unlock()
+
+	for _, done := range pending {
+		done(nil, ErrARPEntryRemoved)
+	}
+	return n
+}
+
+// removeLocked removes an entry and stops resolving it. The returned resolutions must be failed by the caller.
+func (a *ARPv4Table) removeLocked(ipv4NumFormat uint32, e *arpEntry) []ARPResolvedFunc {
+	delete(a.entries, ipv4NumFormat)
+
+	pending := e.pending
+	e.pending = nil
+	if e.resolved != nil {
+		close(e.resolved)
+		e.resolved = nil
+	}
+	return pending
+}
+
+func (e *arpEntry) snapshot(ip net.IP) ARPEntry {
+	return ARPEntry{
+		IP:           ip,
+		HardwareAddr: e.hwAddr,
+		State:        e.state,
+		Static:       e.static,
+		Updated:      e.updated,
+	}
+}
+
+// ARPResolvedFunc is called once a queued resolution finished, either with the hardware address or an error
+type ARPResolvedFunc func(hwAddr net.HardwareAddr, err error)
+
+// Resolve returns the hardware address of ipAddr, blocking until it is resolved or resolving failed
 func (a *ARPv4Table) Resolve(ipAddr net.IP) ([]byte, error) {
+	type result struct {
+		hwAddr net.HardwareAddr
+		err    error
+	}
+
+	resultCh := make(chan result, 1)
+
+	hwAddr, queued, err := a.ResolveAsync(ipAddr, func(hwAddr net.HardwareAddr, err error) {
+		resultCh <- result{hwAddr, err}
+	})
+	if !queued {
+		return hwAddr, err
+	}
+
+	r := <-resultCh
+	return r.hwAddr, r.err
+}
+
+// ResolveAsync returns the hardware address of ipAddr right away if it is reachable.
+// Otherwise done is queued and called once the ARP reply arrives or resolving failed, and queued is true.
+// Unknown addresses are resolved with broadcast ARP requests,
+// stale entries are revalidated with unicast requests to the known neighbor first.
+// At most QueueLength resolutions wait per address, the oldest one fails with ErrARPQueueFull if another is queued.
+func (a *ARPv4Table) ResolveAsync(ipAddr net.IP, done ARPResolvedFunc) (hwAddr net.HardwareAddr, queued bool, err error) {
 	if len(ipAddr) != net.IPv4len {
-		return nil, ErrNotAnIPv4Address
+		return nil, false, ErrNotAnIPv4Address
 	}
 
 	ipv4NumFormat := binary.BigEndian.Uint32(ipAddr)
 
-	const numArpRequests = 10
-	const checkIntervalMillis = 10
+	a.mu.Lock()
+
+	e, ok := a.entries[ipv4NumFormat]
+	if ok {
+		a.age(e, time.Now())
+	}
 
-	for i := 0; i < numArpRequests*checkIntervalMillis; i++ {
-		hwAddr, found := a.resolveFromCache(ipv4NumFormat)
-		if found {
-			return hwAddr, nil
+	switch {
+	case !ok:
+		e = &arpEntry{
+			state:   ARPStateIncomplete,
+			updated: time.Now(),
 		}
+		a.entries[ipv4NumFormat] = e
+	case e.state == ARPStateReachable:
+		a.mu.Unlock()
+		return e.hwAddr, false, nil
+	case e.state == ARPStateFailed:
+		a.mu.Unlock()
+		return nil, false, ErrARPTimeout
+	}
+
+	var dropped ARPResolvedFunc
+	if len(e.pending) > 0 && len(e.pending) >= a.timeouts.QueueLength {
+		dropped = e.pending[0]
+		e.pending = e.pending[1:]
+	}
+	e.pending = append(e.pending, done)
 
-		time.Sleep(time.Millisecond * checkIntervalMillis)
+	if e.resolved == nil {
+		e.resolved = make(chan struct{})
 
-		// every 100 milliseconds
-		if i%numArpRequests == 0 {
-			// Send ARP
-			err := a.arpWriter.SendArpRequest(ipAddr)
-			if err != nil {
-				return nil, err
-			}
+		var unicastHwAddr net.HardwareAddr
+		if e.state == ARPStateStale {
+			unicastHwAddr = e.hwAddr
 		}
+		go a.resolve(net.IP(bytes.Clone(ipAddr)), e, e.resolved, unicastHwAddr, a.timeouts)
+	}
+
+	a.mu.Unlock()
+
+	if dropped != nil {
+		dropped(nil, ErrARPQueueFull)
 	}
-	return nil, ErrARPTimeout
+	return nil, true, nil
 }
 
-func (a *ARPv4Table) resolveFromCache(ipv4NumFormat uint32) ([]byte, bool) {
+// resolve sends ARP requests for ipAddr until entry e is confirmed, or fails all queued resolutions
+func (a *ARPv4Table) resolve(ipAddr net.IP, e *arpEntry, resolved chan struct{}, unicastHwAddr net.HardwareAddr, timeouts ARPTimeouts) {
+	for i := 0; i < timeouts.MaxProbes; i++ {
+		var err error
+		if unicastHwAddr != nil {
+			err = a.arpWriter.SendUnicastArpRequest(ipAddr, unicastHwAddr)
+		} else {
+			err = a.arpWriter.SendArpRequest(ipAddr)
+		}
+
+		if err != nil {
+			a.failResolve(ipAddr, e, resolved, err)
+			return
+		}
+
+		retrans := time.NewTimer(timeouts.RetransTime)
+
+		select {
+		case <-resolved:
+			retrans.Stop()
+			return
+		case <-retrans.C:
+		}
+	}
+
+	a.failResolve(ipAddr, e, resolved, ErrARPTimeout)
+}
+
+// failResolve fails all resolutions queued on entry e, unless it was confirmed in the meantime.
+// The entry is marked as failed after a timeout, and forgotten if the ARP request could not be sent.
+func (a *ARPv4Table) failResolve(ipAddr net.IP, e *arpEntry, resolved chan struct{}, err error) {
+	ipv4NumFormat := binary.BigEndian.Uint32(ipAddr)
+
+	a.mu.Lock()
+
+	if a.entries[ipv4NumFormat] != e || e.resolved != resolved {
+		a.mu.Unlock()
+		return
+	}
+
+	pending := e.pending
+	e.pending = nil
+	e.resolved = nil
+
+	if err == ErrARPTimeout {
+		e.state = ARPStateFailed
+		e.hwAddr = nil
+		e.updated = time.Now()
+	} else if e.state == ARPStateIncomplete {
+		delete(a.entries, ipv4NumFormat)
+	}
+
+	a.mu.Unlock()
+
+	for _, done := range pending {
+		done(nil, err)
+	}
+}
+
+// age moves a reachable entry to stale once it was not confirmed for ReachableTime
+func (a *ARPv4Table) age(e *arpEntry, now time.Time) {
+	if e.state == ARPStateReachable && !e.static && now.Sub(e.updated) >= a.timeouts.ReachableTime {
+		e.state = ARPStateStale
+	}
+}
+
+// expire ages all entries and removes stale and failed entries which timed out
+func (a *ARPv4Table) expire(now time.Time) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if k, ok := a.ipv4ToMacMap[ipv4NumFormat]; ok {
-		return k, true
+	for ip, e := range a.entries {
+		a.age(e, now)
+
+		if e.resolved != nil {
+			// the resolving goroutine owns the entry
+			continue
+		}
+
+		switch e.state {
+		case ARPStateStale:
+			if now.Sub(e.updated) >= a.timeouts.ReachableTime+a.timeouts.StaleTime {
+				delete(a.entries, ip)
+			}
+		case ARPStateFailed:
+			if now.Sub(e.updated) >= a.timeouts.FailedTime {
+				delete(a.entries, ip)
+			}
+		}
 	}
-	return nil, false
+}
+
+// RunExpiry starts the goroutine aging the entries until ctx is done
+func (a *ARPv4Table) RunExpiry(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(a.Timeouts().GCInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				a.expire(now)
+			}
+		}
+	}()
 }
@@ -1,14 +1,17 @@
 package edurouter_test
 
 import (
+	"context"
 	"errors"
 	"github.com/davidkroell/edurouter"
 	"github.com/davidkroell/edurouter/internal/mocks"
 	"github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net"
 	"testing"
+	"time"
 )
 
 func TestARPv4Table_Store(t *testing.T) {
@@ -121,3 +124,339 @@ func TestARPv4Table_Store(t *testing.T) {
 		assert.EqualValues(t, expectedMac, actualMac)
 	})
 }
+
+func TestARPv4Table_Aging(t *testing.T) {
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	timeouts := edurouter.ARPTimeouts{
+		ReachableTime: 20 * time.Millisecond,
+		StaleTime:     20 * time.Millisecond,
+		FailedTime:    20 * time.Millisecond,
+		RetransTime:   20 * time.Millisecond,
+		MaxProbes:     2,
+		GCInterval:    5 * time.Millisecond,
+	}
+
+	ip := net.IP{192, 168, 0, 100}
+	mac := net.HardwareAddr{0, 1, 2, 3, 4, 5}
+
+	t.Run("StaleEntryIsRevalidated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+		arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+		arpTable.SetTimeouts(timeouts)
+
+		require.NoError(t, arpTable.Store(ip, mac))
+
+		entry, ok := arpTable.Lookup(ip)
+		require.True(t, ok)
+		assert.Equal(t, edurouter.ARPStateReachable, entry.State)
+
+		time.Sleep(timeouts.ReachableTime)
+
+		entry, ok = arpTable.Lookup(ip)
+		require.True(t, ok)
+		assert.Equal(t, edurouter.ARPStateStale, entry.State)
+
+		mockArpWriter.EXPECT().SendUnicastArpRequest(ip, mac).DoAndReturn(func(ip net.IP, hwAddr net.HardwareAddr) error {
+			require.NoError(t, arpTable.Store(ip, hwAddr))
+			return nil
+		})
+
+		actualMac, err := arpTable.Resolve(ip)
+		assert.NoError(t, err)
+		assert.EqualValues(t, mac, actualMac)
+
+		entry, _ = arpTable.Lookup(ip)
+		assert.Equal(t, edurouter.ARPStateReachable, entry.State)
+	})
+
+	t.Run("StaleEntryFails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+		arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+		arpTable.SetTimeouts(timeouts)
+
+		require.NoError(t, arpTable.Store(ip, mac))
+		time.Sleep(timeouts.ReachableTime)
+
+		mockArpWriter.EXPECT().SendUnicastArpRequest(ip, mac).Return(nil).Times(timeouts.MaxProbes)
+
+		_, err := arpTable.Resolve(ip)
+		assert.ErrorIs(t, err, edurouter.ErrARPTimeout)
+
+		entry, ok := arpTable.Lookup(ip)
+		require.True(t, ok)
+		assert.Equal(t, edurouter.ARPStateFailed, entry.State)
+		assert.Nil(t, entry.HardwareAddr)
+
+		// failed entries are not resolved again until they expire
+		_, err = arpTable.Resolve(ip)
+		assert.ErrorIs(t, err, edurouter.ErrARPTimeout)
+	})
+
+	t.Run("ExpiryRemovesEntries", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ctrl := gomock.NewController(t)
+		mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+		arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+		arpTable.SetTimeouts(timeouts)
+		arpTable.RunExpiry(ctx)
+
+		require.NoError(t, arpTable.Store(ip, mac))
+
+		assert.Eventually(t, func() bool {
+			_, ok := arpTable.Lookup(ip)
+			return !ok
+		}, time.Second, timeouts.GCInterval)
+	})
+}
+
+func TestARPv4Table_ResolveAsync(t *testing.T) {
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+	arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+
+	timeouts := edurouter.DefaultARPTimeouts
+	timeouts.QueueLength = 2
+	arpTable.SetTimeouts(timeouts)
+
+	ip := net.IP{192, 168, 0, 100}
+	mac := net.HardwareAddr{0, 1, 2, 3, 4, 5}
+
+	requested := make(chan struct{})
+	mockArpWriter.EXPECT().SendArpRequest(ip).DoAndReturn(func(ip net.IP) error {
+		close(requested)
+		return nil
+	})
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		hwAddr, queued, err := arpTable.ResolveAsync(ip, func(hwAddr net.HardwareAddr, err error) {
+			if err == nil {
+				assert.EqualValues(t, mac, hwAddr)
+			}
+			results <- err
+		})
+		assert.True(t, queued)
+		assert.NoError(t, err)
+		assert.Nil(t, hwAddr)
+	}
+
+	// the oldest resolution is dropped from the full queue
+	assert.ErrorIs(t, <-results, edurouter.ErrARPQueueFull)
+
+	<-requested
+	entry, ok := arpTable.Lookup(ip)
+	require.True(t, ok)
+	assert.Equal(t, edurouter.ARPStateIncomplete, entry.State)
+
+	require.NoError(t, arpTable.Store(ip, mac))
+	assert.NoError(t, <-results)
+	assert.NoError(t, <-results)
+
+	hwAddr, queued, err := arpTable.ResolveAsync(ip, nil)
+	assert.False(t, queued)
+	assert.NoError(t, err)
+	assert.EqualValues(t, mac, hwAddr)
+}
+
+func TestARPv4Table_StaticEntries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	arpTable := edurouter.NewARPv4Table(config, mocks.NewMockARPWriter(ctrl))
+
+	timeouts := edurouter.DefaultARPTimeouts
+	timeouts.ReachableTime = 10 * time.Millisecond
+	timeouts.StaleTime = 10 * time.Millisecond
+	timeouts.GCInterval = 5 * time.Millisecond
+	arpTable.SetTimeouts(timeouts)
+	arpTable.RunExpiry(ctx)
+
+	staticIP := net.IP{192, 168, 100, 20}
+	dynamicIP := net.IP{192, 168, 100, 10}
+	mac := net.HardwareAddr{0, 1, 2, 3, 4, 5}
+
+	require.NoError(t, arpTable.StoreStatic(staticIP, mac))
+	require.NoError(t, arpTable.Store(dynamicIP, mac))
+	assert.ErrorIs(t, arpTable.StoreStatic([]byte{1}, mac), edurouter.ErrNotAnIPv4Address)
+
+	entries := arpTable.Entries()
+	require.Len(t, entries, 2)
+	assert.EqualValues(t, dynamicIP, entries[0].IP)
+	assert.False(t, entries[0].Static)
+	assert.EqualValues(t, staticIP, entries[1].IP)
+	assert.True(t, entries[1].Static)
+	assert.EqualValues(t, mac, entries[1].HardwareAddr)
+
+	// the dynamic entry expires, the static one survives
+	assert.Eventually(t, func() bool {
+		return len(arpTable.Entries()) == 1
+	}, time.Second, timeouts.GCInterval)
+
+	entry, ok := arpTable.Lookup(staticIP)
+	require.True(t, ok)
+	assert.Equal(t, edurouter.ARPStateReachable, entry.State)
+
+	// storing keeps the entry static
+	newMac := net.HardwareAddr{0, 1, 2, 3, 4, 6}
+	require.NoError(t, arpTable.Store(staticIP, newMac))
+	entry, _ = arpTable.Lookup(staticIP)
+	assert.True(t, entry.Static)
+	assert.EqualValues(t, newMac, entry.HardwareAddr)
+
+	require.NoError(t, arpTable.Store(dynamicIP, mac))
+	assert.Equal(t, 1, arpTable.Flush(false))
+	assert.Len(t, arpTable.Entries(), 1)
+
+	assert.NoError(t, arpTable.Delete(staticIP))
+	assert.ErrorIs(t, arpTable.Delete(staticIP), edurouter.ErrNoSuchARPEntry)
+	assert.Empty(t, arpTable.Entries())
+}
+
+func TestARPv4Table_DeleteWhileResolving(t *testing.T) {
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	mockArpWriter := mocks.NewMockARPWriter(ctrl)
+	arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+
+	ip := net.IP{192, 168, 0, 100}
+
+	// the request may or may not be sent before the entry is flushed
+	mockArpWriter.EXPECT().SendArpRequest(ip).Return(nil).MaxTimes(1)
+
+	result := make(chan error, 1)
+	_, queued, err := arpTable.ResolveAsync(ip, func(hwAddr net.HardwareAddr, err error) {
+		result <- err
+	})
+	require.NoError(t, err)
+	require.True(t, queued)
+
+	assert.Equal(t, 1, arpTable.Flush(false))
+	assert.ErrorIs(t, <-result, edurouter.ErrARPEntryRemoved)
+}
+
+func TestARPv4Table_LearningPolicy(t *testing.T) {
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	ip := net.IP{192, 168, 100, 10}
+	mac := net.HardwareAddr{0, 1, 2, 3, 4, 5}
+	spoofedMac := net.HardwareAddr{6, 6, 6, 6, 6, 6}
+
+	t.Run("SolicitedOnly", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+		arpTable := edurouter.NewARPv4Table(config, mockArpWriter)
+		arpTable.SetLearningPolicy(edurouter.ARPLearningPolicy{SolicitedOnly: true})
+
+		assert.ErrorIs(t, arpTable.StoreReply(ip, spoofedMac), edurouter.ErrUnsolicitedARPReply)
+		_, ok := arpTable.Lookup(ip)
+		assert.False(t, ok)
+
+		mockArpWriter.EXPECT().SendArpRequest(ip).DoAndReturn(func(ip net.IP) error {
+			require.NoError(t, arpTable.StoreReply(ip, mac))
+			return nil
+		})
+
+		actualMac, err := arpTable.Resolve(ip)
+		require.NoError(t, err)
+		assert.EqualValues(t, mac, actualMac)
+
+		// the request is answered already
+		assert.ErrorIs(t, arpTable.StoreReply(ip, spoofedMac), edurouter.ErrUnsolicitedARPReply)
+		entry, _ := arpTable.Lookup(ip)
+		assert.EqualValues(t, mac, entry.HardwareAddr)
+	})
+
+	t.Run("LearnFromIP", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		arpTable := edurouter.NewARPv4Table(config, mocks.NewMockARPWriter(ctrl))
+
+		assert.Equal(t, edurouter.DefaultARPLearningPolicy, arpTable.LearningPolicy())
+		require.NoError(t, arpTable.StoreFromIPv4(ip, mac))
+		_, ok := arpTable.Lookup(ip)
+		assert.True(t, ok)
+
+		arpTable.SetLearningPolicy(edurouter.ARPLearningPolicy{})
+		assert.ErrorIs(t, arpTable.StoreFromIPv4(ip, spoofedMac), edurouter.ErrARPLearningDisabled)
+		entry, _ := arpTable.Lookup(ip)
+		assert.EqualValues(t, mac, entry.HardwareAddr)
+	})
+
+	t.Run("LockStatic", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		arpTable := edurouter.NewARPv4Table(config, mocks.NewMockARPWriter(ctrl))
+
+		require.NoError(t, arpTable.StoreStatic(ip, mac))
+
+		assert.ErrorIs(t, arpTable.StoreReply(ip, spoofedMac), edurouter.ErrARPEntryLocked)
+		assert.ErrorIs(t, arpTable.StoreFromIPv4(ip, spoofedMac), edurouter.ErrARPEntryLocked)
+		assert.NoError(t, arpTable.StoreReply(ip, mac))
+
+		entry, _ := arpTable.Lookup(ip)
+		assert.EqualValues(t, mac, entry.HardwareAddr)
+		assert.True(t, entry.Static)
+
+		arpTable.SetLearningPolicy(edurouter.ARPLearningPolicy{})
+		assert.NoError(t, arpTable.StoreReply(ip, spoofedMac))
+		entry, _ = arpTable.Lookup(ip)
+		assert.EqualValues(t, spoofedMac, entry.HardwareAddr)
+	})
+}
+
+func TestARPv4Table_FlipFlopWarning(t *testing.T) {
+	buf := captureLog(t)
+	require.NoError(t, edurouter.SetLogLevel(edurouter.LogSubsystemARP, zerolog.WarnLevel))
+
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	arpTable := edurouter.NewARPv4Table(config, mocks.NewMockARPWriter(ctrl))
+
+	ip := net.IP{192, 168, 100, 10}
+	require.NoError(t, arpTable.StoreReply(ip, net.HardwareAddr{0, 1, 2, 3, 4, 5}))
+	require.NoError(t, arpTable.StoreReply(ip, net.HardwareAddr{0, 1, 2, 3, 4, 5}))
+	assert.Empty(t, buf.String())
+
+	require.NoError(t, arpTable.StoreReply(ip, net.HardwareAddr{6, 6, 6, 6, 6, 6}))
+	assert.Contains(t, buf.String(), `"message":"hardware address changed"`)
+	assert.Contains(t, buf.String(), `"old_hw_addr":"00:01:02:03:04:05"`)
+}
@@ -2,31 +2,49 @@ package edurouter
 
 import (
 	"github.com/mdlayher/ethernet"
-	"github.com/mdlayher/raw"
 	"net"
 )
 
 //go:generate mockgen -destination ./internal/mocks/mock_arp_writer.go -package mocks github.com/davidkroell/edurouter ARPWriter
-//go:generate mockgen -destination ./internal/mocks/mock_net_packetconn.go -package mocks net PacketConn
 
 type ARPWriter interface {
 	SendArpRequest(ip net.IP) error
+	// SendUnicastArpRequest asks a known neighbor directly whether it still owns ip
+	SendUnicastArpRequest(ip net.IP, hwAddr net.HardwareAddr) error
 }
 
 type ARPv4Writer struct {
 	ifconfig *InterfaceConfig
-	c        net.PacketConn
+	c        FrameTransport
 }
 
 func NewARPv4Writer(ifconfig *InterfaceConfig) *ARPv4Writer {
 	return &ARPv4Writer{ifconfig: ifconfig}
 }
 
-func (a *ARPv4Writer) Initialize(c net.PacketConn) {
+func (a *ARPv4Writer) Initialize(c FrameTransport) {
 	a.c = c
 }
 
 func (a *ARPv4Writer) SendArpRequest(ip net.IP) error {
+	return a.sendArpRequest(a.ifconfig.Addr.IP, ip, ethernet.Broadcast)
+}
+
+func (a *ARPv4Writer) SendUnicastArpRequest(ip net.IP, hwAddr net.HardwareAddr) error {
+	return a.sendArpRequest(a.ifconfig.Addr.IP, ip, hwAddr)
+}
+
+// SendArpProbe asks whether ip is in use, without claiming any address (RFC 5227)
+func (a *ARPv4Writer) SendArpProbe(ip net.IP) error {
+	return a.sendArpRequest(net.IPv4zero.To4(), ip, ethernet.Broadcast)
+}
+
+// SendArpAnnouncement claims the address of the interface, updating the ARP tables of all neighbors (RFC 5227)
+func (a *ARPv4Writer) SendArpAnnouncement() error {
+	return a.sendArpRequest(a.ifconfig.Addr.IP, a.ifconfig.Addr.IP, ethernet.Broadcast)
+}
+
+func (a *ARPv4Writer) sendArpRequest(srcIP, dstIP net.IP, frameDst net.HardwareAddr) error {
 	if a.c == nil {
 		return ErrARPPacketConn
 	}
@@ -38,9 +56,9 @@ func (a *ARPv4Writer) SendArpRequest(ip net.IP) error {
 		PLEN:            net.IPv4len,
 		Operation:       ARPOperationRequest,
 		SrcHardwareAddr: *a.ifconfig.HardwareAddr,
-		SrcProtoAddr:    a.ifconfig.Addr.IP,
+		SrcProtoAddr:    srcIP,
 		DstHardwareAddr: EmptyHardwareAddr,
-		DstProtoAddr:    ip,
+		DstProtoAddr:    dstIP,
 	}
 
 	bin, err := req.MarshalBinary()
@@ -49,7 +67,7 @@ func (a *ARPv4Writer) SendArpRequest(ip net.IP) error {
 	}
 
 	frame := ethernet.Frame{
-		Destination: ethernet.Broadcast,
+		Destination: frameDst,
 		Source:      req.SrcHardwareAddr,
 		EtherType:   ethernet.EtherTypeARP,
 		Payload:     bin,
@@ -61,6 +79,5 @@ func (a *ARPv4Writer) SendArpRequest(ip net.IP) error {
 		return err
 	}
 
-	_, err = a.c.WriteTo(frameBinary, &raw.Addr{HardwareAddr: frame.Destination})
-	return err
+	return a.c.WriteFrame(frameBinary)
 }
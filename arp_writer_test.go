@@ -5,7 +5,6 @@ import (
 	"github.com/davidkroell/edurouter/internal/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/mdlayher/ethernet"
-	"github.com/mdlayher/raw"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net"
@@ -33,15 +32,14 @@ func TestARPv4Writer(t *testing.T) {
 	t.Run("OK", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 
-		mockPacketConn := mocks.NewMockPacketConn(ctrl)
+		mockTransport := mocks.NewMockFrameTransport(ctrl)
 
-		arpWriter.Initialize(mockPacketConn)
+		arpWriter.Initialize(mockTransport)
 
 		ipToResolve := []byte{192, 168, 100, 2}
 
-		mockPacketConn.EXPECT().WriteTo(gomock.Not(gomock.Nil()), gomock.Not(gomock.Nil())).
-			DoAndReturn(func(p []byte, addr net.Addr) (int, error) {
-				assert.EqualValues(t, &raw.Addr{HardwareAddr: ethernet.Broadcast}, addr)
+		mockTransport.EXPECT().WriteFrame(gomock.Not(gomock.Nil())).
+			DoAndReturn(func(p []byte) error {
 				var frame ethernet.Frame
 
 				err := (&frame).UnmarshalBinary(p)
@@ -67,11 +65,45 @@ func TestARPv4Writer(t *testing.T) {
 				assert.EqualValues(t, edurouter.EmptyHardwareAddr, arpReq.DstHardwareAddr)
 				assert.EqualValues(t, ipToResolve, arpReq.DstProtoAddr)
 
-				return 0, nil
+				return nil
 			})
 
 		err := arpWriter.SendArpRequest(ipToResolve)
 
+		assert.Nil(t, err)
+	})
+	t.Run("OKUnicast", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+
+		mockTransport := mocks.NewMockFrameTransport(ctrl)
+
+		arpWriter.Initialize(mockTransport)
+
+		ipToResolve := []byte{192, 168, 100, 2}
+		neighborHwAddr := net.HardwareAddr{2, 0, 0, 0, 0, 2}
+
+		mockTransport.EXPECT().WriteFrame(gomock.Not(gomock.Nil())).
+			DoAndReturn(func(p []byte) error {
+				var frame ethernet.Frame
+
+				err := (&frame).UnmarshalBinary(p)
+				require.NoError(t, err)
+
+				assert.EqualValues(t, neighborHwAddr, frame.Destination)
+
+				var arpReq edurouter.ARPv4Pdu
+				err = (&arpReq).UnmarshalBinary(frame.Payload)
+				require.NoError(t, err)
+
+				assert.EqualValues(t, edurouter.ARPOperationRequest, arpReq.Operation)
+				assert.EqualValues(t, edurouter.EmptyHardwareAddr, arpReq.DstHardwareAddr)
+				assert.EqualValues(t, ipToResolve, arpReq.DstProtoAddr)
+
+				return nil
+			})
+
+		err := arpWriter.SendUnicastArpRequest(ipToResolve, neighborHwAddr)
+
 		assert.Nil(t, err)
 	})
 }
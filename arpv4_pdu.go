@@ -3,8 +3,8 @@ package edurouter
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"github.com/mdlayher/ethernet"
-	"io"
 	"net"
 )
 
@@ -13,9 +13,40 @@ type ARPOperation uint16
 const (
 	ARPOperationRequest  ARPOperation = 1
 	ARPOperationResponse ARPOperation = 2
-	HTYPEEthernet                     = 1
+	// RARP and InARP operations are decoded, but not handled by the router
+	ARPOperationRARPRequest   ARPOperation = 3
+	ARPOperationRARPResponse  ARPOperation = 4
+	ARPOperationInARPRequest  ARPOperation = 8
+	ARPOperationInARPResponse ARPOperation = 9
+	HTYPEEthernet                          = 1
 )
 
+// arpHeaderLength is the length of the fixed part of an ARP packet, before the addresses
+const arpHeaderLength = 8
+
+func (op ARPOperation) String() string {
+	switch op {
+	case ARPOperationRequest:
+		return "request"
+	case ARPOperationResponse:
+		return "reply"
+	case ARPOperationRARPRequest:
+		return "RARP request"
+	case ARPOperationRARPResponse:
+		return "RARP reply"
+	case ARPOperationInARPRequest:
+		return "InARP request"
+	case ARPOperationInARPResponse:
+		return "InARP reply"
+	default:
+		return "unknown"
+	}
+}
+
+func (op ARPOperation) isKnown() bool {
+	return op.String() != "unknown"
+}
+
 var EmptyHardwareAddr = []byte{
 	0x0, 0x0, 0x0,
 	0x0, 0x0, 0x0,
@@ -33,31 +64,35 @@ type ARPv4Pdu struct {
 	DstProtoAddr    []byte
 }
 
+// IsEthernetAndIPv4 reports whether the packet resolves IPv4 addresses to MAC addresses
 func (a *ARPv4Pdu) IsEthernetAndIPv4() bool {
-	if a.HTYPE != HTYPEEthernet {
-		// not ethernet
-		return false
-	}
+	return a.ValidateEthernetAndIPv4() == nil
+}
 
-	if a.PTYPE != ethernet.EtherTypeARP && a.PTYPE != ethernet.EtherTypeIPv4 {
-		// not IPv4
-		return false
+// ValidateEthernetAndIPv4 returns an error wrapping ErrUnsupportedARPHardwareType or ErrUnsupportedARPProtocolType
+// if the packet does not resolve IPv4 addresses to MAC addresses
+func (a *ARPv4Pdu) ValidateEthernetAndIPv4() error {
+	if a.HTYPE != HTYPEEthernet || a.HLEN != HardwareAddrLen {
+		return fmt.Errorf("%w: hardware type %d with length %d", ErrUnsupportedARPHardwareType, a.HTYPE, a.HLEN)
 	}
 
-	if a.HLEN != HardwareAddrLen {
-		// MAC's are 6 bytes
-		return false
+	if a.PTYPE != ethernet.EtherTypeIPv4 || a.PLEN != net.IPv4len {
+		return fmt.Errorf("%w: protocol type 0x%04x with length %d", ErrUnsupportedARPProtocolType, uint16(a.PTYPE), a.PLEN)
 	}
 
-	if a.PLEN != net.IPv4len {
-		// IP's are 4 bytes
-		return false
-	}
+	return nil
+}
 
-	return true
+// Length returns the length of the encoded packet, which depends on HLEN and PLEN
+func (a *ARPv4Pdu) Length() int {
+	return arpHeaderLength + 2*int(a.HLEN) + 2*int(a.PLEN)
 }
 
 func (a *ARPv4Pdu) IsArpRequestForConfig(config *InterfaceConfig) bool {
+	return a.IsArpRequestForIP(config.Addr.IP)
+}
+
+func (a *ARPv4Pdu) IsArpRequestForIP(ip net.IP) bool {
 	if a.Operation != ARPOperationRequest {
 		// not request
 		return false
@@ -68,7 +103,7 @@ func (a *ARPv4Pdu) IsArpRequestForConfig(config *InterfaceConfig) bool {
 		return false
 	}
 
-	if !bytes.Equal(a.DstProtoAddr, config.Addr.IP) {
+	if !bytes.Equal(a.DstProtoAddr, ip) {
 		// targetAddr should be the same
 		return false
 	}
@@ -80,6 +115,15 @@ func (a *ARPv4Pdu) IsArpResponse() bool {
 }
 
 func (a *ARPv4Pdu) BuildARPResponseWithConfig(config *InterfaceConfig) *ARPv4Pdu {
+	return a.buildARPResponse(config, config.Addr.IP)
+}
+
+// BuildProxyARPResponseWithConfig answers the request on behalf of the requested address, with the hardware address of config
+func (a *ARPv4Pdu) BuildProxyARPResponseWithConfig(config *InterfaceConfig) *ARPv4Pdu {
+	return a.buildARPResponse(config, a.DstProtoAddr)
+}
+
+func (a *ARPv4Pdu) buildARPResponse(config *InterfaceConfig, srcProtoAddr []byte) *ARPv4Pdu {
 	return &ARPv4Pdu{
 		HTYPE:     a.HTYPE,
 		PTYPE:     a.PTYPE,
@@ -89,7 +133,7 @@ func (a *ARPv4Pdu) BuildARPResponseWithConfig(config *InterfaceConfig) *ARPv4Pdu
 
 		// provide configured mac as src
 		SrcHardwareAddr: *config.HardwareAddr,
-		SrcProtoAddr:    config.Addr.IP,
+		SrcProtoAddr:    srcProtoAddr,
 
 		// flip original sender to target
 		DstHardwareAddr: a.SrcHardwareAddr,
@@ -98,28 +142,36 @@ func (a *ARPv4Pdu) BuildARPResponseWithConfig(config *InterfaceConfig) *ARPv4Pdu
 }
 
 func (a *ARPv4Pdu) MarshalBinary() ([]byte, error) {
-	b := make([]byte, 28)
+	hlen, plen := int(a.HLEN), int(a.PLEN)
 
-	b[0] = byte(a.HTYPE >> 8)
-	b[1] = byte(a.HTYPE)
-	b[2] = byte(a.PTYPE >> 8)
-	b[3] = byte(a.PTYPE)
+	if len(a.SrcHardwareAddr) != hlen || len(a.DstHardwareAddr) != hlen ||
+		len(a.SrcProtoAddr) != plen || len(a.DstProtoAddr) != plen {
+		return nil, ErrARPAddressLength
+	}
+
+	b := make([]byte, a.Length())
+
+	binary.BigEndian.PutUint16(b[0:2], a.HTYPE)
+	binary.BigEndian.PutUint16(b[2:4], uint16(a.PTYPE))
 	b[4] = a.HLEN
 	b[5] = a.PLEN
-	b[6] = byte(a.Operation >> 8)
-	b[7] = byte(a.Operation)
+	binary.BigEndian.PutUint16(b[6:8], uint16(a.Operation))
 
-	copy(b[8:], a.SrcHardwareAddr)
-	copy(b[14:], a.SrcProtoAddr)
-	copy(b[18:], a.DstHardwareAddr)
-	copy(b[24:], a.DstProtoAddr)
+	n := arpHeaderLength
+	for _, addr := range [][]byte{a.SrcHardwareAddr, a.SrcProtoAddr, a.DstHardwareAddr, a.DstProtoAddr} {
+		n += copy(b[n:], addr)
+	}
 
 	return b, nil
 }
 
+// UnmarshalBinary decodes an ARP packet of any hardware and protocol type, the addresses are copied from payload.
+// It returns an error wrapping ErrARPTruncated if payload is shorter than the packet,
+// and ErrUnknownARPOperation with all fields decoded if the operation is unknown.
+// Use ValidateEthernetAndIPv4 before handling the addresses as MAC and IPv4 addresses.
 func (a *ARPv4Pdu) UnmarshalBinary(payload []byte) error {
-	if len(payload) < 27 {
-		return io.ErrUnexpectedEOF
+	if len(payload) < arpHeaderLength {
+		return fmt.Errorf("%w: %d of %d header bytes", ErrARPTruncated, len(payload), arpHeaderLength)
 	}
 
 	a.HTYPE = binary.BigEndian.Uint16(payload[0:2])
@@ -127,10 +179,28 @@ func (a *ARPv4Pdu) UnmarshalBinary(payload []byte) error {
 	a.HLEN = payload[4]
 	a.PLEN = payload[5]
 	a.Operation = ARPOperation(binary.BigEndian.Uint16(payload[6:8]))
-	a.SrcHardwareAddr = payload[8:14]
-	a.SrcProtoAddr = payload[14:18]
-	a.DstHardwareAddr = payload[18:24]
-	a.DstProtoAddr = payload[24:28]
+
+	if len(payload) < a.Length() {
+		return fmt.Errorf("%w: %d of %d bytes", ErrARPTruncated, len(payload), a.Length())
+	}
+
+	hlen, plen := int(a.HLEN), int(a.PLEN)
+	n := arpHeaderLength
+
+	next := func(length int) []byte {
+		addr := bytes.Clone(payload[n : n+length])
+		n += length
+		return addr
+	}
+
+	a.SrcHardwareAddr = next(hlen)
+	a.SrcProtoAddr = next(plen)
+	a.DstHardwareAddr = next(hlen)
+	a.DstProtoAddr = next(plen)
+
+	if !a.Operation.isKnown() {
+		return fmt.Errorf("%w: %d", ErrUnknownARPOperation, a.Operation)
+	}
 
 	return nil
 }
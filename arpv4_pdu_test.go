@@ -0,0 +1,153 @@
+package edurouter_test
+
+import (
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+func testARPv4Pdu() edurouter.ARPv4Pdu {
+	return edurouter.ARPv4Pdu{
+		HTYPE:           edurouter.HTYPEEthernet,
+		PTYPE:           ethernet.EtherTypeIPv4,
+		HLEN:            edurouter.HardwareAddrLen,
+		PLEN:            net.IPv4len,
+		Operation:       edurouter.ARPOperationRequest,
+		SrcHardwareAddr: []byte{1, 1, 1, 3, 3, 3},
+		SrcProtoAddr:    []byte{192, 168, 100, 100},
+		DstHardwareAddr: edurouter.EmptyHardwareAddr,
+		DstProtoAddr:    []byte{192, 168, 100, 1},
+	}
+}
+
+func TestARPv4Pdu_UnmarshalBinary(t *testing.T) {
+	tests := map[string]struct {
+		modify       func(b []byte) []byte
+		wantErr      error
+		wantOp       edurouter.ARPOperation
+		wantValidErr error
+	}{
+		"OK": {
+			modify: func(b []byte) []byte { return b },
+			wantOp: edurouter.ARPOperationRequest,
+		},
+		"Padding": {
+			modify: func(b []byte) []byte { return append(b, make([]byte, 18)...) },
+			wantOp: edurouter.ARPOperationRequest,
+		},
+		"HeaderTruncated": {
+			modify:  func(b []byte) []byte { return b[:7] },
+			wantErr: edurouter.ErrARPTruncated,
+		},
+		"AddressesTruncated": {
+			modify:  func(b []byte) []byte { return b[:27] },
+			wantErr: edurouter.ErrARPTruncated,
+		},
+		"UnknownOperation": {
+			modify: func(b []byte) []byte {
+				b[7] = 5
+				return b
+			},
+			wantErr: edurouter.ErrUnknownARPOperation,
+			wantOp:  5,
+		},
+		"RARPReply": {
+			modify: func(b []byte) []byte {
+				b[7] = byte(edurouter.ARPOperationRARPResponse)
+				return b
+			},
+			wantOp: edurouter.ARPOperationRARPResponse,
+		},
+		"InARPRequest": {
+			modify: func(b []byte) []byte {
+				b[7] = byte(edurouter.ARPOperationInARPRequest)
+				return b
+			},
+			wantOp: edurouter.ARPOperationInARPRequest,
+		},
+		"ProtocolTypeARP": {
+			modify: func(b []byte) []byte {
+				b[2], b[3] = 0x08, 0x06
+				return b
+			},
+			wantOp:       edurouter.ARPOperationRequest,
+			wantValidErr: edurouter.ErrUnsupportedARPProtocolType,
+		},
+		"HardwareType": {
+			modify: func(b []byte) []byte {
+				b[1] = 6
+				return b
+			},
+			wantOp:       edurouter.ARPOperationRequest,
+			wantValidErr: edurouter.ErrUnsupportedARPHardwareType,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			pdu := testARPv4Pdu()
+			b, err := pdu.MarshalBinary()
+			require.NoError(t, err)
+			require.Len(t, b, 28)
+
+			var actual edurouter.ARPv4Pdu
+			err = (&actual).UnmarshalBinary(v.modify(b))
+			if v.wantErr != nil {
+				assert.ErrorIs(t, err, v.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if v.wantErr == edurouter.ErrARPTruncated {
+				return
+			}
+
+			assert.Equal(t, v.wantOp, actual.Operation)
+			assert.EqualValues(t, pdu.SrcProtoAddr, actual.SrcProtoAddr)
+			assert.EqualValues(t, pdu.DstProtoAddr, actual.DstProtoAddr)
+
+			if v.wantValidErr != nil {
+				assert.ErrorIs(t, actual.ValidateEthernetAndIPv4(), v.wantValidErr)
+				assert.False(t, actual.IsEthernetAndIPv4())
+			} else {
+				assert.NoError(t, actual.ValidateEthernetAndIPv4())
+			}
+		})
+	}
+}
+
+func TestARPv4Pdu_VariableLengths(t *testing.T) {
+	// a hardware type with 8 byte addresses, resolving 16 byte protocol addresses
+	pdu := edurouter.ARPv4Pdu{
+		HTYPE:           27,
+		PTYPE:           ethernet.EtherTypeIPv6,
+		HLEN:            8,
+		PLEN:            net.IPv6len,
+		Operation:       edurouter.ARPOperationInARPResponse,
+		SrcHardwareAddr: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		SrcProtoAddr:    net.ParseIP("2001:db8::1"),
+		DstHardwareAddr: []byte{8, 7, 6, 5, 4, 3, 2, 1},
+		DstProtoAddr:    net.ParseIP("2001:db8::2"),
+	}
+
+	b, err := pdu.MarshalBinary()
+	require.NoError(t, err)
+	assert.Len(t, b, 8+2*8+2*16)
+	assert.Equal(t, len(b), pdu.Length())
+
+	var actual edurouter.ARPv4Pdu
+	require.NoError(t, (&actual).UnmarshalBinary(b))
+	assert.EqualValues(t, pdu, actual)
+	assert.ErrorIs(t, actual.ValidateEthernetAndIPv4(), edurouter.ErrUnsupportedARPHardwareType)
+
+	// the decoded addresses do not alias the payload
+	b[8] = 0xff
+	assert.EqualValues(t, 1, actual.SrcHardwareAddr[0])
+
+	pdu.SrcProtoAddr = net.IP{10, 0, 0, 1}
+	_, err = pdu.MarshalBinary()
+	assert.ErrorIs(t, err, edurouter.ErrARPAddressLength)
+}
@@ -0,0 +1,244 @@
+package edurouter
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type FrameDirection uint8
+
+const (
+	FrameDirectionIn  FrameDirection = 0
+	FrameDirectionOut FrameDirection = 1
+)
+
+func (d FrameDirection) String() string {
+	switch d {
+	case FrameDirectionIn:
+		return "in"
+	case FrameDirectionOut:
+		return "out"
+	default:
+		return ""
+	}
+}
+
+// CapturedFrame is a raw ethernet frame seen on one of the router's interfaces
+type CapturedFrame struct {
+	Timestamp     time.Time
+	InterfaceName string
+	Direction     FrameDirection
+	Data          []byte
+}
+
+// FrameObserver is notified about every frame entering and leaving the router.
+// ObserveFrame is called on the forwarding path and must not block.
+type FrameObserver interface {
+	ObserveFrame(f CapturedFrame)
+}
+
+// frameObservers fans out frames to all registered observers
+type frameObservers struct {
+	observers map[uint64]FrameObserver
+	nextID    uint64
+	mu        sync.RWMutex
+}
+
+func newFrameObservers() *frameObservers {
+	return &frameObservers{
+		observers: map[uint64]FrameObserver{},
+	}
+}
+
+func (o *frameObservers) add(observer FrameObserver) uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.nextID++
+	o.observers[o.nextID] = observer
+	return o.nextID
+}
+
+func (o *frameObservers) remove(id uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.observers, id)
+}
+
+func (o *frameObservers) ObserveFrame(f CapturedFrame) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for _, observer := range o.observers {
+		observer.ObserveFrame(f)
+	}
+}
+
+// observedFrameTransport reports all frames read from and written to a FrameTransport
+type observedFrameTransport struct {
+	FrameTransport
+	iface    *InterfaceConfig
+	observer FrameObserver
+}
+
+func (t *observedFrameTransport) ReadFrame(b []byte) (int, error) {
+	n, err := t.FrameTransport.ReadFrame(b)
+	if err == nil {
+		t.observe(FrameDirectionIn, b[:n])
+	}
+	return n, err
+}
+
+func (t *observedFrameTransport) WriteFrame(b []byte) error {
+	err := t.FrameTransport.WriteFrame(b)
+	if err == nil {
+		t.observe(FrameDirectionOut, b)
+	}
+	return err
+}
+
+func (t *observedFrameTransport) observe(direction FrameDirection, b []byte) {
+	data := make([]byte, len(b))
+	copy(data, b)
+
+	t.observer.ObserveFrame(CapturedFrame{
+		Timestamp:     time.Now(),
+		InterfaceName: t.iface.InterfaceName,
+		Direction:     direction,
+		Data:          data,
+	})
+}
+
+const captureQueueLength = 1024
+
+// Capture writes the frames of one or all interfaces into a pcapng file.
+// Frames are written asynchronously, if the writer can not keep up frames are dropped.
+type Capture struct {
+	InterfaceName string
+	Path          string
+	file          *os.File
+	writer        *PcapngWriter
+	frames        chan CapturedFrame
+	done          chan struct{}
+	observerID    uint64
+	numFrames     atomic.Uint64
+	numDropped    atomic.Uint64
+	stopOnce      sync.Once
+}
+
+// NewCapture creates the pcapng file at path. An empty interfaceName captures all interfaces.
+func NewCapture(interfaceName, path string) (*Capture, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := NewPcapngWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	c := &Capture{
+		InterfaceName: interfaceName,
+		Path:          path,
+		file:          file,
+		writer:        writer,
+		frames:        make(chan CapturedFrame, captureQueueLength),
+		done:          make(chan struct{}),
+	}
+
+	go c.run()
+	return c, nil
+}
+
+func (c *Capture) ObserveFrame(f CapturedFrame) {
+	if c.InterfaceName != "" && c.InterfaceName != f.InterfaceName {
+		return
+	}
+
+	select {
+	case c.frames <- f:
+	default:
+		c.numDropped.Add(1)
+	}
+}
+
+func (c *Capture) run() {
+	defer close(c.done)
+
+	for f := range c.frames {
+		err := c.writer.WriteFrame(f)
+		if err != nil {
+			Logger(LogSubsystemIface).Error().Msgf("error writing capture %s: %v", c.Path, err)
+			continue
+		}
+		c.numFrames.Add(1)
+	}
+}
+
+// Stop flushes all pending frames and closes the file.
+// The capture must not receive frames anymore when Stop is called.
+func (c *Capture) Stop() error {
+	var err error
+
+	c.stopOnce.Do(func() {
+		close(c.frames)
+		<-c.done
+		err = c.file.Close()
+	})
+	return err
+}
+
+// NumFrames returns the number of frames written to the file
+func (c *Capture) NumFrames() uint64 {
+	return c.numFrames.Load()
+}
+
+// NumDropped returns the number of frames which were lost because the writer was too slow
+func (c *Capture) NumDropped() uint64 {
+	return c.numDropped.Load()
+}
+
+const frameMonitorQueueLength = 256
+
+// FrameMonitor renders the frames matching a CaptureFilter into one-line summaries.
+// Like Capture it never blocks the forwarding path, lines are dropped if the reader is too slow.
+type FrameMonitor struct {
+	filter     *CaptureFilter
+	lines      chan string
+	numDropped atomic.Uint64
+}
+
+func NewFrameMonitor(filter *CaptureFilter) *FrameMonitor {
+	return &FrameMonitor{
+		filter: filter,
+		lines:  make(chan string, frameMonitorQueueLength),
+	}
+}
+
+func (m *FrameMonitor) ObserveFrame(f CapturedFrame) {
+	d := decodeFrame(f)
+	if !m.filter.match(d) {
+		return
+	}
+
+	select {
+	case m.lines <- f.Timestamp.Format("15:04:05.000000") + " " + d.summary():
+	default:
+		m.numDropped.Add(1)
+	}
+}
+
+// Lines returns the summaries of the matching frames, prefixed with the time they were seen
+func (m *FrameMonitor) Lines() <-chan string {
+	return m.lines
+}
+
+// NumDropped returns the number of summaries which were lost because the reader was too slow
+func (m *FrameMonitor) NumDropped() uint64 {
+	return m.numDropped.Load()
+}
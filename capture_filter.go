@@ -0,0 +1,318 @@
+package edurouter
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mdlayher/ethernet"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// CaptureFilter selects frames by a tcpdump-like expression. The following primitives are supported:
+//
+//	iface NAME                  frames seen on the interface NAME
+//	in, out                     direction of the frame
+//	arp, ip, icmp, tcp, udp     shorthands for the ethertype and IP protocol
+//	ether proto arp|ip|NUM      ethertype of the frame
+//	ip proto icmp|tcp|udp|NUM   protocol of an IPv4 packet
+//	[src|dst] host ADDR         IPv4 source or destination, or ARP sender or target address
+//	[src|dst] net CIDR          same as host, but matches a whole network
+//
+// Primitives are combined with and (&&), or (||), not (!) and parentheses.
+// The empty expression matches all frames.
+type CaptureFilter struct {
+	Expression string
+	match      func(d *decodedFrame) bool
+}
+
+type captureFilterFunc func(d *decodedFrame) bool
+
+// ParseCaptureFilter compiles a filter expression. Errors wrap ErrInvalidCaptureFilter.
+func ParseCaptureFilter(expression string) (*CaptureFilter, error) {
+	p := &captureFilterParser{tokens: tokenizeCaptureFilter(expression)}
+
+	f := &CaptureFilter{Expression: expression}
+
+	if len(p.tokens) == 0 {
+		f.match = func(*decodedFrame) bool { return true }
+		return f, nil
+	}
+
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("%w: unexpected '%s'", ErrInvalidCaptureFilter, tok)
+	}
+
+	f.match = match
+	return f, nil
+}
+
+// Match reports whether the frame is selected by the filter
+func (f *CaptureFilter) Match(frame CapturedFrame) bool {
+	return f.match(decodeFrame(frame))
+}
+
+func tokenizeCaptureFilter(expression string) []string {
+	// parentheses and negation are tokens on their own, even without whitespace around them
+	replacer := strings.NewReplacer("(", " ( ", ")", " ) ", "!", " ! ", "&&", " && ", "||", " || ")
+	return strings.Fields(replacer.Replace(expression))
+}
+
+type captureFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *captureFilterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *captureFilterParser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+// nextArgument returns the argument of the primitive keyword
+func (p *captureFilterParser) nextArgument(keyword string) (string, error) {
+	tok := p.next()
+	switch tok {
+	case "", "(", ")", "!", "&&", "||", "and", "or", "not":
+		return "", fmt.Errorf("%w: missing argument for '%s'", ErrInvalidCaptureFilter, keyword)
+	}
+	return tok, nil
+}
+
+func (p *captureFilterParser) parseOr() (captureFilterFunc, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(d *decodedFrame) bool { return l(d) || right(d) }
+	}
+
+	return left, nil
+}
+
+func (p *captureFilterParser) parseAnd() (captureFilterFunc, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.next()
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(d *decodedFrame) bool { return l(d) && right(d) }
+	}
+
+	return left, nil
+}
+
+func (p *captureFilterParser) parseNot() (captureFilterFunc, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decodedFrame) bool { return !inner(d) }, nil
+
+	case "(":
+		p.next()
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.next() != ")" {
+			return nil, fmt.Errorf("%w: missing ')'", ErrInvalidCaptureFilter)
+		}
+		return inner, nil
+	}
+
+	return p.parsePrimitive()
+}
+
+func (p *captureFilterParser) parsePrimitive() (captureFilterFunc, error) {
+	tok := p.next()
+
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("%w: unexpected end of expression", ErrInvalidCaptureFilter)
+
+	case "iface":
+		name, err := p.nextArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decodedFrame) bool { return d.InterfaceName == name }, nil
+
+	case "in":
+		return func(d *decodedFrame) bool { return d.Direction == FrameDirectionIn }, nil
+	case "out":
+		return func(d *decodedFrame) bool { return d.Direction == FrameDirectionOut }, nil
+
+	case "arp":
+		return matchEtherType(ethernet.EtherTypeARP), nil
+	case "icmp":
+		return matchIPProtocol(IPProtocolICMPv4), nil
+	case "tcp":
+		return matchIPProtocol(IPProtocolTCP), nil
+	case "udp":
+		return matchIPProtocol(IPProtocolUDP), nil
+
+	case "ip":
+		if p.peek() != "proto" {
+			return matchEtherType(ethernet.EtherTypeIPv4), nil
+		}
+		p.next()
+
+		arg, err := p.nextArgument("ip proto")
+		if err != nil {
+			return nil, err
+		}
+
+		proto, err := parseIPProtocol(arg)
+		if err != nil {
+			return nil, err
+		}
+		return matchIPProtocol(proto), nil
+
+	case "ether":
+		if p.next() != "proto" {
+			return nil, fmt.Errorf("%w: expected 'proto' after 'ether'", ErrInvalidCaptureFilter)
+		}
+
+		arg, err := p.nextArgument("ether proto")
+		if err != nil {
+			return nil, err
+		}
+
+		etherType, err := parseEtherType(arg)
+		if err != nil {
+			return nil, err
+		}
+		return matchEtherType(etherType), nil
+
+	case "src", "dst":
+		qualifier := p.next()
+		if qualifier != "host" && qualifier != "net" {
+			return nil, fmt.Errorf("%w: expected 'host' or 'net' after '%s'", ErrInvalidCaptureFilter, tok)
+		}
+		return p.parseAddress(tok, qualifier)
+
+	case "host", "net":
+		return p.parseAddress("", tok)
+	}
+
+	return nil, fmt.Errorf("%w: unknown primitive '%s'", ErrInvalidCaptureFilter, tok)
+}
+
+// parseAddress parses the argument of a host or net primitive. direction is either src, dst or empty for both.
+func (p *captureFilterParser) parseAddress(direction, qualifier string) (captureFilterFunc, error) {
+	arg, err := p.nextArgument(qualifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var contains func(ip net.IP) bool
+
+	if qualifier == "host" {
+		host := net.ParseIP(arg).To4()
+		if host == nil {
+			return nil, fmt.Errorf("%w: '%s' is not an IPv4 address", ErrInvalidCaptureFilter, arg)
+		}
+
+		contains = func(ip net.IP) bool { return ip != nil && bytes.Equal(ip.To4(), host) }
+	} else {
+		_, ipNet, err := net.ParseCIDR(arg)
+		if err != nil || ipNet.IP.To4() == nil {
+			return nil, fmt.Errorf("%w: '%s' is not an IPv4 network", ErrInvalidCaptureFilter, arg)
+		}
+
+		contains = func(ip net.IP) bool { return ip != nil && ipNet.Contains(ip) }
+	}
+
+	switch direction {
+	case "src":
+		return func(d *decodedFrame) bool { return contains(d.srcIP()) }, nil
+	case "dst":
+		return func(d *decodedFrame) bool { return contains(d.dstIP()) }, nil
+	default:
+		return func(d *decodedFrame) bool { return contains(d.srcIP()) || contains(d.dstIP()) }, nil
+	}
+}
+
+func matchEtherType(etherType ethernet.EtherType) captureFilterFunc {
+	return func(d *decodedFrame) bool {
+		return d.eth != nil && d.eth.EtherType == etherType
+	}
+}
+
+func matchIPProtocol(proto IPProtocol) captureFilterFunc {
+	return func(d *decodedFrame) bool {
+		return d.ipv4 != nil && d.ipv4.Protocol == proto
+	}
+}
+
+func parseEtherType(s string) (ethernet.EtherType, error) {
+	switch s {
+	case "arp":
+		return ethernet.EtherTypeARP, nil
+	case "ip":
+		return ethernet.EtherTypeIPv4, nil
+	}
+
+	n, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid ethertype '%s'", ErrInvalidCaptureFilter, s)
+	}
+	return ethernet.EtherType(n), nil
+}
+
+func parseIPProtocol(s string) (IPProtocol, error) {
+	switch s {
+	case "icmp":
+		return IPProtocolICMPv4, nil
+	case "tcp":
+		return IPProtocolTCP, nil
+	case "udp":
+		return IPProtocolUDP, nil
+	}
+
+	n, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid IP protocol '%s'", ErrInvalidCaptureFilter, s)
+	}
+	return IPProtocol(n), nil
+}
@@ -0,0 +1,234 @@
+package edurouter_test
+
+import (
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func marshalFrame(t *testing.T, f *ethernet.Frame) []byte {
+	b, err := f.MarshalBinary()
+	require.NoError(t, err)
+	return b
+}
+
+func testARPRequestFrame(t *testing.T) edurouter.CapturedFrame {
+	arp := edurouter.ARPv4Pdu{
+		HTYPE:           edurouter.HTYPEEthernet,
+		PTYPE:           ethernet.EtherTypeIPv4,
+		HLEN:            edurouter.HardwareAddrLen,
+		PLEN:            net.IPv4len,
+		Operation:       edurouter.ARPOperationRequest,
+		SrcHardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 5},
+		SrcProtoAddr:    []byte{10, 0, 0, 5},
+		DstHardwareAddr: edurouter.EmptyHardwareAddr,
+		DstProtoAddr:    []byte{10, 0, 0, 1},
+	}
+	arpBinary, err := arp.MarshalBinary()
+	require.NoError(t, err)
+
+	return edurouter.CapturedFrame{
+		InterfaceName: "eth0",
+		Direction:     edurouter.FrameDirectionIn,
+		Data: marshalFrame(t, &ethernet.Frame{
+			Destination: ethernet.Broadcast,
+			Source:      net.HardwareAddr{2, 0, 0, 0, 0, 5},
+			EtherType:   ethernet.EtherTypeARP,
+			Payload:     arpBinary,
+		}),
+	}
+}
+
+func testEchoReplyFrame(t *testing.T) edurouter.CapturedFrame {
+	icmp := edurouter.ICMPPacket{
+		IcmpType: edurouter.IcmpTypeEchoReply,
+		Id:       7,
+		Seq:      3,
+		Data:     []byte{1, 2, 3, 4},
+	}
+	icmpBinary, err := icmp.MarshalBinary()
+	require.NoError(t, err)
+
+	ip := edurouter.NewIPv4Pdu(net.IP{10, 0, 1, 1}, net.IP{192, 168, 0, 9}, edurouter.IPProtocolICMPv4, icmpBinary)
+	ipBinary, err := ip.MarshalBinary()
+	require.NoError(t, err)
+
+	return edurouter.CapturedFrame{
+		InterfaceName: "eth1",
+		Direction:     edurouter.FrameDirectionOut,
+		Data: marshalFrame(t, &ethernet.Frame{
+			Destination: net.HardwareAddr{2, 0, 0, 0, 0, 9},
+			Source:      net.HardwareAddr{2, 0, 0, 0, 1, 1},
+			EtherType:   ethernet.EtherTypeIPv4,
+			Payload:     ipBinary,
+		}),
+	}
+}
+
+func testParameterProblemFrame(t *testing.T) edurouter.CapturedFrame {
+	icmp := edurouter.ICMPPacket{
+		IcmpType: edurouter.IcmpTypeParameterProblem,
+		// the pointer names the first option byte
+		Id:   20 << 8,
+		Data: make([]byte, edurouter.IPv4HeaderLength+8),
+	}
+	icmpBinary, err := icmp.MarshalBinary()
+	require.NoError(t, err)
+
+	ip := edurouter.NewIPv4Pdu(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, edurouter.IPProtocolICMPv4, icmpBinary)
+	ipBinary, err := ip.MarshalBinary()
+	require.NoError(t, err)
+
+	return edurouter.CapturedFrame{
+		InterfaceName: "eth0",
+		Direction:     edurouter.FrameDirectionOut,
+		Data: marshalFrame(t, &ethernet.Frame{
+			Destination: net.HardwareAddr{2, 0, 0, 0, 0, 2},
+			Source:      net.HardwareAddr{2, 0, 0, 0, 0, 1},
+			EtherType:   ethernet.EtherTypeIPv4,
+			Payload:     ipBinary,
+		}),
+	}
+}
+
+func TestSummarizeFrame(t *testing.T) {
+	tests := map[string]struct {
+		frame edurouter.CapturedFrame
+		want  string
+	}{
+		"ARPRequest": {
+			frame: testARPRequestFrame(t),
+			want:  "eth0 in ARP who-has 10.0.0.1 tell 10.0.0.5",
+		},
+		"EchoReply": {
+			frame: testEchoReplyFrame(t),
+			want:  "eth1 out IP 10.0.1.1 > 192.168.0.9: ICMP echo reply, id 7, seq 3, length 12",
+		},
+		"ParameterProblem": {
+			frame: testParameterProblemFrame(t),
+			want:  "eth0 out IP 10.0.0.1 > 10.0.0.2: ICMP parameter problem, pointer 20, length 36",
+		},
+		"UnknownEtherType": {
+			frame: edurouter.CapturedFrame{
+				InterfaceName: "eth0",
+				Data: marshalFrame(t, &ethernet.Frame{
+					Destination: ethernet.Broadcast,
+					Source:      net.HardwareAddr{2, 0, 0, 0, 0, 5},
+					EtherType:   ethernet.EtherTypeIPv6,
+					Payload:     make([]byte, 46),
+				}),
+			},
+			want: "eth0 in 02:00:00:00:00:05 > ff:ff:ff:ff:ff:ff, ethertype IPv6, length 46",
+		},
+		"Malformed": {
+			frame: edurouter.CapturedFrame{
+				InterfaceName: "eth0",
+				Data:          []byte{1, 2, 3},
+			},
+			want: "eth0 in malformed frame, length 3",
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, v.want, edurouter.SummarizeFrame(v.frame))
+		})
+	}
+}
+
+func TestCaptureFilter(t *testing.T) {
+	arpFrame := testARPRequestFrame(t)
+	echoFrame := testEchoReplyFrame(t)
+
+	tests := map[string]struct {
+		expression string
+		wantARP    bool
+		wantEcho   bool
+	}{
+		"Empty":            {expression: "", wantARP: true, wantEcho: true},
+		"Interface":        {expression: "iface eth0", wantARP: true},
+		"Direction":        {expression: "out", wantEcho: true},
+		"ARP":              {expression: "arp", wantARP: true},
+		"IP":               {expression: "ip", wantEcho: true},
+		"ICMP":             {expression: "icmp", wantEcho: true},
+		"UDP":              {expression: "udp"},
+		"EtherProto":       {expression: "ether proto 0x0806", wantARP: true},
+		"IPProto":          {expression: "ip proto 1", wantEcho: true},
+		"Host":             {expression: "host 10.0.0.1", wantARP: true},
+		"SrcHost":          {expression: "src host 10.0.0.1"},
+		"DstHost":          {expression: "dst host 10.0.0.1", wantARP: true},
+		"Net":              {expression: "net 10.0.0.0/16", wantARP: true, wantEcho: true},
+		"DstNet":           {expression: "dst net 192.168.0.0/24", wantEcho: true},
+		"And":              {expression: "in and icmp"},
+		"Or":               {expression: "arp or icmp", wantARP: true, wantEcho: true},
+		"Not":              {expression: "not arp", wantEcho: true},
+		"Precedence":       {expression: "arp or icmp and in", wantARP: true},
+		"Parentheses":      {expression: "(arp or icmp) and out", wantEcho: true},
+		"SymbolOperators":  {expression: "!(arp&&in)||udp", wantEcho: true},
+		"NestedNegation":   {expression: "not not iface eth1", wantEcho: true},
+		"ParenthesizedAll": {expression: "((iface eth0))", wantARP: true},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := edurouter.ParseCaptureFilter(v.expression)
+			require.NoError(t, err)
+
+			assert.Equal(t, v.wantARP, f.Match(arpFrame))
+			assert.Equal(t, v.wantEcho, f.Match(echoFrame))
+		})
+	}
+}
+
+func TestParseCaptureFilter_Errors(t *testing.T) {
+	tests := map[string]string{
+		"UnknownPrimitive":   "foo",
+		"MissingArgument":    "iface",
+		"MissingOperand":     "arp and",
+		"MissingParenthesis": "(arp or icmp",
+		"TrailingToken":      "arp icmp",
+		"InvalidHost":        "host 10.0.0",
+		"InvalidNet":         "net 10.0.0.0",
+		"InvalidEtherProto":  "ether proto foo",
+		"InvalidIPProto":     "ip proto 300",
+		"MissingQualifier":   "src 10.0.0.1",
+		"OperatorAsArgument": "iface and",
+	}
+
+	for name, expression := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := edurouter.ParseCaptureFilter(expression)
+			assert.ErrorIs(t, err, edurouter.ErrInvalidCaptureFilter)
+		})
+	}
+}
+
+func TestFrameMonitor(t *testing.T) {
+	f, err := edurouter.ParseCaptureFilter("arp")
+	require.NoError(t, err)
+
+	m := edurouter.NewFrameMonitor(f)
+
+	arpFrame := testARPRequestFrame(t)
+	arpFrame.Timestamp = time.Date(2023, 1, 1, 12, 30, 15, 123456000, time.Local)
+
+	m.ObserveFrame(testEchoReplyFrame(t))
+	m.ObserveFrame(arpFrame)
+
+	select {
+	case line := <-m.Lines():
+		assert.Equal(t, "12:30:15.123456 eth0 in ARP who-has 10.0.0.1 tell 10.0.0.5", line)
+	default:
+		t.Fatal("no summary for matching frame")
+	}
+
+	select {
+	case line := <-m.Lines():
+		t.Fatalf("unexpected summary %s", line)
+	default:
+	}
+}
@@ -0,0 +1,95 @@
+package edurouter_test
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLinkLayerListener_Capture(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sw := edurouter.NewVirtualSwitch()
+	r := newVirtualRouter(t, ctx, 1, []*edurouter.VirtualSwitch{sw}, []string{"10.0.0.1/24"})
+
+	path := filepath.Join(t.TempDir(), "eth0.pcapng")
+
+	_, err := r.listener.StartCapture("eth1", path)
+	assert.EqualError(t, err, edurouter.ErrUnknownInterface.Error())
+
+	c, err := r.listener.StartCapture("eth0", path)
+	require.NoError(t, err)
+	assert.Len(t, r.listener.Captures(), 1)
+
+	_, err = r.listener.StartCapture("", path)
+	assert.EqualError(t, err, edurouter.ErrCaptureAlreadyRunning.Error())
+
+	hostHwAddr := net.HardwareAddr{2, 0, 0, 0, 0, 100}
+	host := sw.NewPort(hostHwAddr)
+	require.NoError(t, host.Open(nil))
+	hostFrames := readFrames(host)
+
+	arpRequest := edurouter.ARPv4Pdu{
+		HTYPE:           edurouter.HTYPEEthernet,
+		PTYPE:           ethernet.EtherTypeIPv4,
+		HLEN:            edurouter.HardwareAddrLen,
+		PLEN:            net.IPv4len,
+		Operation:       edurouter.ARPOperationRequest,
+		SrcHardwareAddr: hostHwAddr,
+		SrcProtoAddr:    []byte{10, 0, 0, 2},
+		DstHardwareAddr: edurouter.EmptyHardwareAddr,
+		DstProtoAddr:    []byte{10, 0, 0, 1},
+	}
+	arpBinary, err := arpRequest.MarshalBinary()
+	require.NoError(t, err)
+
+	writeFrame(t, host, &ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      hostHwAddr,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     arpBinary,
+	})
+
+	require.NotNil(t, receiveFrame(hostFrames, time.Second))
+
+	require.Eventually(t, func() bool {
+		return c.NumFrames() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, r.listener.StopCapture(path))
+	assert.Empty(t, r.listener.Captures())
+	assert.EqualError(t, r.listener.StopCapture(path), edurouter.ErrNoSuchCapture.Error())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var packets []pcapngBlock
+	for _, block := range splitPcapngBlocks(t, b) {
+		if block.blockType == 6 {
+			packets = append(packets, block)
+		}
+	}
+	require.Len(t, packets, 2)
+
+	// request in, response out
+	wantFlags := []uint32{1, 2}
+	for i, packet := range packets {
+		capturedLength := binary.LittleEndian.Uint32(packet.body[12:16])
+
+		var f ethernet.Frame
+		require.NoError(t, (&f).UnmarshalBinary(packet.body[20:20+capturedLength]))
+		assert.EqualValues(t, ethernet.EtherTypeARP, f.EtherType)
+
+		options := packet.body[20+capturedLength+(4-capturedLength%4)%4:]
+		assert.EqualValues(t, wantFlags[i], binary.LittleEndian.Uint32(options[4:8]))
+	}
+}
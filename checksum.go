@@ -6,10 +6,14 @@ func onesComplementChecksum(bytes []byte) uint16 {
 
 	// Compute checksum
 	var csum uint32
-	for i := 0; i < len(bytes); i += 2 {
+	for i := 0; i+1 < len(bytes); i += 2 {
 		csum += uint32(bytes[i]) << 8
 		csum += uint32(bytes[i+1])
 	}
+	// an odd trailing byte is padded with zero
+	if len(bytes)%2 != 0 {
+		csum += uint32(bytes[len(bytes)-1]) << 8
+	}
 	for {
 		// Break when sum is less or equals to 0xFFFF
 		if csum <= 65535 {
@@ -14,6 +14,8 @@ func TestOnesComplementChecksum(t *testing.T) {
 		"one":                     {inputBytes: []byte{0, 1}, want: 0xfffe},
 		"10bytes random":          {inputBytes: []byte{42, 69, 42, 69, 42, 69, 42, 69, 42, 69}, want: 0x2ca6},
 		"10bytes newpaltz sample": {inputBytes: []byte{0x23, 0xfb, 0x34, 0xc0, 0xa0, 0x90, 0xbc, 0xaf, 0xfc, 0x05}, want: 0x4dfe},
+		"odd length padded":       {inputBytes: []byte{0x23, 0xfb, 0x34}, want: 0xa804},
+		"single byte":             {inputBytes: []byte{1}, want: 0xfeff},
 	}
 
 	for name, v := range tests {
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davidkroell/edurouter"
+	"github.com/spf13/cobra"
+	"net"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	ErrNoInterfaceForAddress = errors.New("edurouter: no interface is attached to the network of this address, use -i <interface>")
+	ErrUnknownPolicyOption   = errors.New("edurouter: unknown policy option, use solicited-only, learn-from-ip or lock-static")
+	ErrInvalidOnOff          = errors.New("edurouter: expected on or off")
+)
+
+func parseOnOff(s string) (bool, error) {
+	switch s {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, ErrInvalidOnOff
+	}
+}
+
+func formatOnOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// selectInterfaces returns the interface with the given name, or all interfaces if name is empty
+func selectInterfaces(name string) ([]*edurouter.InterfaceConfig, error) {
+	if name == "" {
+		return listener.Interfaces(), nil
+	}
+
+	for _, iface := range listener.Interfaces() {
+		if iface.InterfaceName == name {
+			return []*edurouter.InterfaceConfig{iface}, nil
+		}
+	}
+	return nil, edurouter.ErrUnknownInterface
+}
+
+func parseIPv4(s string) (net.IP, error) {
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return nil, edurouter.ErrNotAnIPv4Address
+	}
+	return ip, nil
+}
+
+func arpCommands() *cobra.Command {
+	arpCmds := &cobra.Command{
+		Use:   "arp",
+		Short: "show or configure the ARP tables",
+	}
+
+	var iface string
+
+	listCmd := &cobra.Command{
+		Use:   "list [-i iface]",
+		Short: "list the ARP entries of all or one interface",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ifaces, err := selectInterfaces(iface)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 1, 2, 4, ' ', 0)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "IP", "HW ADDR", "INTERFACE", "STATE", "AGE", "TYPE")
+
+			for _, i := range ifaces {
+				for _, e := range i.ArpTable.Entries() {
+					hwAddr := "-"
+					if e.HardwareAddr != nil {
+						hwAddr = e.HardwareAddr.String()
+					}
+
+					entryType := "dynamic"
+					if e.Static {
+						entryType = "static"
+					}
+
+					age := time.Since(e.Updated).Truncate(100 * time.Millisecond)
+
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.IP, hwAddr, i.InterfaceName, e.State, age, entryType)
+				}
+			}
+
+			return w.Flush()
+		},
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add [-i iface] <ip> <hw-addr>",
+		Short: "add a static ARP entry, on the interface attached to the network of ip by default",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ip, err := parseIPv4(args[0])
+			if err != nil {
+				return err
+			}
+
+			hwAddr, err := net.ParseMAC(args[1])
+			if err != nil {
+				return err
+			}
+
+			ifaces, err := selectInterfaces(iface)
+			if err != nil {
+				return err
+			}
+
+			if iface == "" {
+				var attached []*edurouter.InterfaceConfig
+				for _, i := range ifaces {
+					if i.Addr.Contains(ip) {
+						attached = append(attached, i)
+					}
+				}
+				ifaces = attached
+			}
+
+			if len(ifaces) == 0 {
+				return ErrNoInterfaceForAddress
+			}
+
+			return ifaces[0].ArpTable.StoreStatic(ip, hwAddr)
+		},
+	}
+
+	delCmd := &cobra.Command{
+		Use:   "del [-i iface] <ip>",
+		Short: "delete an ARP entry from all or one interface",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ip, err := parseIPv4(args[0])
+			if err != nil {
+				return err
+			}
+
+			ifaces, err := selectInterfaces(iface)
+			if err != nil {
+				return err
+			}
+
+			deleted := false
+			for _, i := range ifaces {
+				err = i.ArpTable.Delete(ip)
+				if err == edurouter.ErrNoSuchARPEntry {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				deleted = true
+			}
+
+			if !deleted {
+				return edurouter.ErrNoSuchARPEntry
+			}
+			return nil
+		},
+	}
+
+	var all bool
+
+	flushCmd := &cobra.Command{
+		Use:   "flush [-i iface] [--all]",
+		Short: "delete the dynamic ARP entries of all or one interface",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ifaces, err := selectInterfaces(iface)
+			if err != nil {
+				return err
+			}
+
+			var n int
+			for _, i := range ifaces {
+				n += i.ArpTable.Flush(all)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%d entries deleted\n", n)
+			return nil
+		},
+	}
+
+	policyCmd := &cobra.Command{
+		Use:   "policy [-i iface] [solicited-only|learn-from-ip|lock-static on|off]",
+		Short: "show or configure which received packets update the ARP tables",
+		Long: `show or configure which received packets update the ARP tables.
+
+options:
+  solicited-only   accept only ARP replies to requests sent by the router
+  learn-from-ip    update entries from the source addresses of received IPv4 packets
+  lock-static      never overwrite static entries with another hardware address`,
+		Args: cobra.RangeArgs(0, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return ErrTooFewArguments
+			}
+
+			ifaces, err := selectInterfaces(iface)
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 0 {
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 1, 2, 4, ' ', 0)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "INTERFACE", "SOLICITED-ONLY", "LEARN-FROM-IP", "LOCK-STATIC")
+				for _, i := range ifaces {
+					policy := i.ArpTable.LearningPolicy()
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", i.InterfaceName, formatOnOff(policy.SolicitedOnly), formatOnOff(policy.LearnFromIP), formatOnOff(policy.LockStatic))
+				}
+				return w.Flush()
+			}
+
+			on, err := parseOnOff(args[1])
+			if err != nil {
+				return err
+			}
+
+			for _, i := range ifaces {
+				policy := i.ArpTable.LearningPolicy()
+
+				switch args[0] {
+				case "solicited-only":
+					policy.SolicitedOnly = on
+				case "learn-from-ip":
+					policy.LearnFromIP = on
+				case "lock-static":
+					policy.LockStatic = on
+				default:
+					return ErrUnknownPolicyOption
+				}
+
+				i.ArpTable.SetLearningPolicy(policy)
+			}
+			return nil
+		},
+	}
+
+	for _, c := range []*cobra.Command{listCmd, addCmd, delCmd, flushCmd, policyCmd} {
+		c.Flags().StringVarP(&iface, "interface", "i", "", "interface")
+	}
+	flushCmd.Flags().BoolVar(&all, "all", false, "delete static entries too")
+
+	arpCmds.AddCommand(listCmd, addCmd, delCmd, flushCmd, policyCmd)
+	return arpCmds
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"net"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	ErrMissingInterface = errors.New("edurouter: missing interface, use -i <interface>")
+	ErrInvalidScanRate  = errors.New("edurouter: the scan rate must be at least 1 request per second")
+)
+
+func arpScanCommand() *cobra.Command {
+	var iface string
+	var rate uint
+	var wait time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "arpscan -i iface [cidr] [--rate <requests per second>] [--wait <duration>]",
+		Short: "discover the hosts on the network of an interface, or in cidr, with ARP requests",
+		Args:  cobra.RangeArgs(0, 1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if iface == "" {
+				return ErrMissingInterface
+			}
+
+			if rate == 0 {
+				return ErrInvalidScanRate
+			}
+
+			ifaces, err := selectInterfaces(iface)
+			if err != nil {
+				return err
+			}
+			i := ifaces[0]
+
+			network := &net.IPNet{IP: i.Addr.IP.Mask(i.Addr.Mask), Mask: i.Addr.Mask}
+			if len(args) == 1 {
+				_, network, err = net.ParseCIDR(args[0])
+				if err != nil {
+					return err
+				}
+			}
+
+			ctx, stop := foregroundContext()
+			defer stop()
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "scanning %s on %s, press Ctrl-C to stop\n", network, i.InterfaceName)
+
+			start := time.Now()
+			results, scanErr := i.ArpTable.Scan(ctx, network, time.Second/time.Duration(rate), wait)
+			if scanErr != nil && results == nil {
+				return scanErr
+			}
+
+			w := tabwriter.NewWriter(out, 1, 2, 4, ' ', 0)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", "IP", "HW ADDR", "RESPONSE TIME")
+			for _, r := range results {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", r.IP, r.HardwareAddr, r.ResponseTime.Round(10*time.Microsecond))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "%d hosts found in %s\n", len(results), time.Since(start).Round(time.Millisecond))
+			// the hosts found before a failed request are shown with the error
+			return scanErr
+		},
+	}
+
+	cmd.Flags().StringVarP(&iface, "interface", "i", "", "interface")
+	cmd.Flags().UintVar(&rate, "rate", 50, "ARP requests per second")
+	cmd.Flags().DurationVar(&wait, "wait", time.Second, "time to wait for replies after the last request")
+	return cmd
+}
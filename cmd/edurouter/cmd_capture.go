@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davidkroell/edurouter"
+	"github.com/spf13/cobra"
+	"strings"
+	"text/tabwriter"
+)
+
+var ErrMissingCaptureFile = errors.New("edurouter: missing capture file, use -w <file>")
+
+func captureCommands() *cobra.Command {
+	captureCmds := &cobra.Command{
+		Use:   "capture [filter]",
+		Short: "show frames matching a filter until Ctrl-C is pressed, or capture them into pcapng files",
+		Long: `show one-line summaries of the frames passing through the router until Ctrl-C is pressed.
+
+filter primitives:
+  iface NAME                  frames seen on the interface NAME
+  in, out                     direction of the frame
+  arp, ip, icmp, tcp, udp     shorthands for the ethertype and IP protocol
+  ether proto arp|ip|NUM      ethertype of the frame
+  ip proto icmp|tcp|udp|NUM   protocol of an IPv4 packet
+  [src|dst] host ADDR         IPv4 source or destination, or ARP sender or target address
+  [src|dst] net CIDR          same as host, but matches a whole network
+
+primitives are combined with and, or, not and parentheses, e.g.
+  capture iface eth0 and (arp or icmp)`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := edurouter.ParseCaptureFilter(strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := foregroundContext()
+			defer stop()
+
+			monitor := edurouter.NewFrameMonitor(filter)
+			id := listener.AddFrameObserver(monitor)
+			defer listener.RemoveFrameObserver(id)
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintln(out, "capturing, press Ctrl-C to stop")
+
+			var numFrames uint64
+			for {
+				select {
+				case line := <-monitor.Lines():
+					fmt.Fprintln(out, line)
+					numFrames++
+				case <-ctx.Done():
+					fmt.Fprintf(out, "%d frames shown, %d dropped\n", numFrames, monitor.NumDropped())
+					return nil
+				}
+			}
+		},
+	}
+
+	var iface string
+	var file string
+
+	startCmd := &cobra.Command{
+		Use:   "start [-i iface] -w file.pcapng",
+		Short: "start writing frames into a pcapng file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return ErrMissingCaptureFile
+			}
+
+			_, err := listener.StartCapture(iface, file)
+			return err
+		},
+	}
+
+	startCmd.Flags().StringVarP(&iface, "interface", "i", "", "interface to capture, all if omitted")
+	startCmd.Flags().StringVarP(&file, "write", "w", "", "pcapng file to write")
+
+	stopCmd := &cobra.Command{
+		Use:   "stop [-w file.pcapng]",
+		Short: "stop a capture, all if no file is given",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listener.StopCapture(file)
+		},
+	}
+
+	stopCmd.Flags().StringVarP(&file, "write", "w", "", "pcapng file of the capture")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list all running captures",
+		Run: func(cmd *cobra.Command, args []string) {
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 1, 2, 4, ' ', 0)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "INTERFACE", "FILE", "FRAMES", "DROPPED")
+			for _, c := range listener.Captures() {
+				iface := c.InterfaceName
+				if iface == "" {
+					iface = "*"
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", iface, c.Path, c.NumFrames(), c.NumDropped())
+			}
+			w.Flush()
+		},
+	}
+
+	captureCmds.AddCommand(startCmd, stopCmd, listCmd)
+	return captureCmds
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/davidkroell/edurouter"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+func decodeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "decode <hex>",
+		Short: "decode an ethernet frame given as hex bytes",
+		Long: `decode an ethernet frame given as hex bytes and show its layers and fields.
+bytes may be separated by spaces or colons, e.g.
+  decode ff:ff:ff:ff:ff:ff 02:00:00:00:00:05 08 06 ...`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return ErrTooFewArguments
+			}
+
+			frame, err := parseHexBytes(strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprint(out, edurouter.Dissect(frame))
+			fmt.Fprintln(out)
+			fmt.Fprint(out, edurouter.HexDump(frame))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// parseHexBytes accepts hex strings as written by tcpdump, Wireshark or ip link, e.g. "0x08 0x06" or "08:06"
+func parseHexBytes(s string) ([]byte, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ':' || r == '-'
+	})
+
+	var sb strings.Builder
+	for _, f := range fields {
+		sb.WriteString(strings.TrimPrefix(f, "0x"))
+	}
+
+	return hex.DecodeString(sb.String())
+}
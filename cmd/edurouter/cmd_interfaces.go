@@ -5,6 +5,8 @@ import (
 	"github.com/davidkroell/edurouter"
 	"github.com/spf13/cobra"
 	"net"
+	"os"
+	"strings"
 	"text/tabwriter"
 )
 
@@ -16,9 +18,16 @@ func interfaceCommands() *cobra.Command {
 
 	var addr string
 	var iface string
+	var tap bool
+	var replayIn string
+	var replayOut string
+	var realtime bool
+	var hwAddr string
+	var noProbe bool
+	var proxyARP bool
 
 	addCmd := &cobra.Command{
-		Use:   "add --interface iface -a address",
+		Use:   "add --interface iface -a address [--tap] [--no-probe] [--proxy-arp] [--replay in.pcap [--replay-out out.pcap] [--realtime] [--hw-addr mac]]",
 		Short: "add an interface",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ip, ipNet, err := net.ParseCIDR(addr)
@@ -33,28 +42,144 @@ func interfaceCommands() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			listener.AddInterface(config)
-			return nil
+
+			config.ProxyARP = proxyARP
+
+			if tap {
+				config.Transport = edurouter.NewTapFrameTransport(iface)
+			}
+
+			if replayIn != "" {
+				config.Transport, err = replayTransport(replayIn, replayOut, hwAddr, realtime)
+				if err != nil {
+					return err
+				}
+			}
+
+			if !noProbe {
+				conflictDetection := edurouter.DefaultConflictDetection
+				config.ConflictDetection = &conflictDetection
+
+				fmt.Fprintf(cmd.OutOrStdout(), "probing whether %s is used by another host\n", config.Addr.IP)
+			}
+
+			return listener.AddInterface(config)
 		},
 	}
 
 	addCmd.Flags().StringVarP(&iface, "interface", "i", "", "")
 	addCmd.Flags().StringVarP(&addr, "address", "a", "", "")
+	addCmd.Flags().BoolVar(&tap, "tap", false, "create a TAP device instead of attaching to an existing interface")
+	addCmd.Flags().StringVar(&replayIn, "replay", "", "replay frames of a pcap or pcapng file instead of attaching to an interface")
+	addCmd.Flags().StringVar(&replayOut, "replay-out", "", "write the frames sent on a replayed interface into a pcap file")
+	addCmd.Flags().BoolVar(&realtime, "realtime", false, "honour the original timing when replaying")
+	addCmd.Flags().StringVar(&hwAddr, "hw-addr", "", "hardware address of a replayed interface")
+	addCmd.Flags().BoolVar(&proxyARP, "proxy-arp", false, "answer ARP requests for addresses routed through other interfaces")
+	addCmd.Flags().BoolVar(&noProbe, "no-probe", false, "use the address without probing for conflicts with other hosts")
 
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "list all interfaces",
 		Run: func(cmd *cobra.Command, args []string) {
 			w := tabwriter.NewWriter(cmd.OutOrStdout(), 1, 2, 4, ' ', 0)
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "INTERFACE", "HW ADDR", "IP (EMULATED)", "IP (REAL)")
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", "INTERFACE", "HW ADDR", "IP (EMULATED)", "IP (REAL)", "PROXY ARP")
 			for _, iface := range listener.Interfaces() {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", iface.InterfaceName, iface.HardwareAddr, iface.Addr, iface.RealIPAddr)
+				realIPAddr := "-"
+				if iface.RealIPAddr != nil {
+					realIPAddr = iface.RealIPAddr.String()
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", iface.InterfaceName, iface.HardwareAddr, iface.Addr, realIPAddr, formatOnOff(iface.ProxyARP))
 			}
+
+			loAddrs := []string{(&net.IPNet{IP: edurouter.LoopbackAddr, Mask: edurouter.LoopbackNetwork.Mask}).String()}
+			for _, id := range listener.Loopback().RouterIDs() {
+				loAddrs = append(loAddrs, id.String()+"/32")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", edurouter.LoopbackInterfaceName, "-", strings.Join(loAddrs, ", "), "-", formatOnOff(false))
 			w.Flush()
 		},
 	}
 
-	ifaceCmds.AddCommand(addCmd, listCmd)
+	ifaceCmds.AddCommand(addCmd, listCmd, loopbackCommands())
 
 	return ifaceCmds
 }
+
+func loopbackCommands() *cobra.Command {
+	loCmds := &cobra.Command{
+		Use:   edurouter.LoopbackInterfaceName,
+		Short: "configure the router-id addresses of the loopback interface",
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add <address>",
+		Short: "add a router-id address",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ip, err := parseIPv4(args[0])
+			if err != nil {
+				return err
+			}
+			return listener.Loopback().AddRouterID(ip)
+		},
+	}
+
+	delCmd := &cobra.Command{
+		Use:   "del <address>",
+		Short: "delete a router-id address",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ip, err := parseIPv4(args[0])
+			if err != nil {
+				return err
+			}
+			return listener.Loopback().DeleteRouterID(ip)
+		},
+	}
+
+	loCmds.AddCommand(addCmd, delCmd)
+	return loCmds
+}
+
+func replayTransport(in, out, hwAddr string, realtime bool) (*edurouter.ReplayFrameTransport, error) {
+	mac := edurouter.RandomHardwareAddr()
+	if hwAddr != "" {
+		var err error
+		mac, err = net.ParseMAC(hwAddr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inFile, err := os.Open(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var outFile *os.File
+	if out != "" {
+		outFile, err = os.Create(out)
+		if err != nil {
+			_ = inFile.Close()
+			return nil, err
+		}
+	}
+
+	var transport *edurouter.ReplayFrameTransport
+	if outFile != nil {
+		transport, err = edurouter.NewReplayFrameTransport(inFile, outFile, mac, realtime)
+	} else {
+		// a nil *os.File must not end up in the io.Writer interface
+		transport, err = edurouter.NewReplayFrameTransport(inFile, nil, mac, realtime)
+	}
+
+	if err != nil {
+		_ = inFile.Close()
+		if outFile != nil {
+			_ = outFile.Close()
+		}
+		return nil, err
+	}
+	return transport, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davidkroell/edurouter"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+var ErrUnknownLogLevel = errors.New("edurouter: unknown log level, use none, trace, debug, info, warn or error")
+
+var (
+	// logFile is the file the log is currently written to, nil for stdout
+	logFile *os.File
+	logJSON bool
+)
+
+func parseLogLevel(s string) (zerolog.Level, error) {
+	if s == "none" {
+		return zerolog.Disabled, nil
+	}
+
+	level, err := zerolog.ParseLevel(s)
+	if err != nil || s == "" {
+		return zerolog.NoLevel, ErrUnknownLogLevel
+	}
+	return level, nil
+}
+
+func formatLogLevel(level zerolog.Level) string {
+	if level == zerolog.Disabled {
+		return "none"
+	}
+	return level.String()
+}
+
+func applyLogOutput() {
+	var w io.Writer = os.Stdout
+	if logFile != nil {
+		w = logFile
+	}
+
+	edurouter.SetLogOutput(w, logJSON)
+}
+
+func logCommand() *cobra.Command {
+	logCmd := &cobra.Command{
+		Use:   "log [subsystem] [level]",
+		Short: "show or configure the log level",
+		Long: `show the log level of all subsystems, or set it for one or all of them.
+subsystems: arp, ipv4, icmp, route, iface
+levels: none, trace, debug, info, warn, error`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch len(args) {
+			case 0:
+				levels := edurouter.LogLevels()
+
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 1, 2, 4, ' ', 0)
+				fmt.Fprintf(w, "%s\t%s\n", "SUBSYSTEM", "LEVEL")
+				for _, s := range edurouter.LogSubsystems {
+					fmt.Fprintf(w, "%s\t%s\n", s, formatLogLevel(levels[s]))
+				}
+				w.Flush()
+
+				output := "stdout"
+				if logFile != nil {
+					output = logFile.Name()
+				}
+
+				format := "console"
+				if logJSON {
+					format = "json"
+				}
+
+				fmt.Fprintf(cmd.OutOrStdout(), "\noutput: %s (%s)\n", output, format)
+				return nil
+
+			case 1:
+				level, err := parseLogLevel(args[0])
+				if err != nil {
+					return err
+				}
+
+				edurouter.SetAllLogLevels(level)
+				return nil
+
+			default:
+				subsystem, err := edurouter.ParseLogSubsystem(args[0])
+				if err != nil {
+					return err
+				}
+
+				level, err := parseLogLevel(args[1])
+				if err != nil {
+					return err
+				}
+
+				return edurouter.SetLogLevel(subsystem, level)
+			}
+		},
+	}
+
+	fileCmd := &cobra.Command{
+		Use:   "file <path|->",
+		Short: "write the log into a file, - writes to stdout",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return ErrTooFewArguments
+			}
+
+			var f *os.File
+			if args[0] != "-" {
+				var err error
+				f, err = os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+				if err != nil {
+					return err
+				}
+			}
+
+			previous := logFile
+			logFile = f
+			applyLogOutput()
+
+			if previous != nil {
+				return previous.Close()
+			}
+			return nil
+		},
+	}
+
+	jsonCmd := &cobra.Command{
+		Use:   "json <on|off>",
+		Short: "write the log as JSON lines",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return ErrTooFewArguments
+			}
+
+			logJSON = args[0] == "on"
+			applyLogOutput()
+			return nil
+		},
+	}
+
+	logCmd.AddCommand(fileCmd, jsonCmd)
+	return logCmd
+}
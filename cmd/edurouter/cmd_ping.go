@@ -1,26 +1,163 @@
 package main
 
 import (
+	"fmt"
+	"github.com/davidkroell/edurouter"
 	"github.com/spf13/cobra"
+	"io"
 	"net"
+	"time"
 )
 
+// pingErrorText describes an ICMP error about an echo request like the classic ping
+func pingErrorText(r edurouter.PingReply) string {
+	switch r.Type {
+	case edurouter.IcmpTypeTimeExceeded:
+		return "Time to live exceeded"
+	case edurouter.IcmpTypeDestinationUnreachable:
+		switch r.Code {
+		case edurouter.IcmpCodeNetUnreachable:
+			return "Destination Net Unreachable"
+		case edurouter.IcmpCodeHostUnreachable:
+			return "Destination Host Unreachable"
+		case edurouter.IcmpCodeProtocolUnreachable:
+			return "Destination Protocol Unreachable"
+		case edurouter.IcmpCodePortUnreachable:
+			return "Destination Port Unreachable"
+		case edurouter.IcmpCodeSourceRouteFailed:
+			return "Source Route Failed"
+		}
+		return fmt.Sprintf("Destination Unreachable, code %d", r.Code)
+	case edurouter.IcmpTypeParameterProblem:
+		return "Parameter problem"
+	}
+	return fmt.Sprintf("ICMP type %d, code %d", r.Type, r.Code)
+}
+
+func printPingReply(w io.Writer, r edurouter.PingReply) {
+	switch {
+	case r.TimedOut():
+		fmt.Fprintf(w, "Request timeout for icmp_seq %d\n", r.Seq)
+	case r.Type == edurouter.IcmpTypeEchoReply:
+		fmt.Fprintf(w, "%d bytes from %s: icmp_seq=%d ttl=%d time=%.3f ms\n", r.Length, r.Src, r.Seq, r.TTL, milliseconds(r.RTT))
+	default:
+		fmt.Fprintf(w, "From %s icmp_seq=%d %s\n", r.Src, r.Seq, pingErrorText(r))
+	}
+}
+
+// printRecordedRoute prints the route of a reply like the classic ping, an unchanged route is not repeated
+func printRecordedRoute(w io.Writer, route, last []net.IP) {
+	if len(route) == len(last) {
+		same := true
+		for n := range route {
+			same = same && route[n].Equal(last[n])
+		}
+		if same {
+			fmt.Fprintln(w, "(same route)")
+			return
+		}
+	}
+
+	for n, addr := range route {
+		prefix := "\t"
+		if n == 0 {
+			prefix = "RR:\t"
+		}
+		fmt.Fprintf(w, "%s%s\n", prefix, addr)
+	}
+	fmt.Fprintln(w)
+}
+
+func printPingStatistics(w io.Writer, host string, s edurouter.PingStatistics) {
+	fmt.Fprintf(w, "--- %s ping statistics ---\n", host)
+	fmt.Fprintf(w, "%d packets transmitted, %d received, ", s.Transmitted, s.Received)
+	if s.Errors > 0 {
+		fmt.Fprintf(w, "+%d errors, ", s.Errors)
+	}
+	fmt.Fprintf(w, "%.0f%% packet loss, time %dms\n", s.Loss(), s.Elapsed.Milliseconds())
+
+	if s.Received > 0 {
+		fmt.Fprintf(w, "rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n",
+			milliseconds(s.Min), milliseconds(s.Avg), milliseconds(s.Max), milliseconds(s.Mdev))
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
 func pingCommand() *cobra.Command {
-	var numPings uint16
+	opts := edurouter.DefaultPingOptions
+	var iface string
+	var ttl uint8
+
 	cmd := &cobra.Command{
-		Use:   "ping host [-n <num pings>]",
+		Use:   "ping host [-c count] [-i interval] [-s size] [-t ttl] [-I iface] [-W timeout] [-w deadline] [-f] [-R]",
 		Short: "ping a host",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return ErrTooFewArguments
 			}
 
-			ip := net.ParseIP(args[0])
-			listener.IcmpPing(ip, numPings)
+			ip, err := parseIPv4(args[0])
+			if err != nil {
+				return err
+			}
+
+			opts.TTL = ttl
+			if iface != "" {
+				ifaces, err := selectInterfaces(iface)
+				if err != nil {
+					return err
+				}
+				opts.Source = ifaces[0].Addr.IP
+			}
+
+			ctx, stop := foregroundContext()
+			defer stop()
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "PING %s %d(%d) bytes of data.\n", ip, opts.Size, opts.Size+8+edurouter.IPv4HeaderLength)
+
+			var lastRoute []net.IP
+			replyFn := func(r edurouter.PingReply) {
+				printPingReply(out, r)
+
+				if opts.RecordRoute && r.Type == edurouter.IcmpTypeEchoReply {
+					printRecordedRoute(out, r.Route, lastRoute)
+					lastRoute = r.Route
+				}
+			}
+			if opts.Flood {
+				// like the classic ping, a flood only prints a dot per lost request
+				replyFn = func(r edurouter.PingReply) {
+					if r.Type != edurouter.IcmpTypeEchoReply {
+						fmt.Fprint(out, ".")
+					}
+				}
+			}
+
+			stats, err := listener.Ping(ctx, ip, opts, replyFn)
+			if err != nil {
+				return err
+			}
+
+			if opts.Flood {
+				fmt.Fprintln(out)
+			}
+			printPingStatistics(out, ip.String(), stats)
 			return nil
 		},
 	}
 
-	cmd.Flags().Uint16VarP(&numPings, "number", "n", 4, "number of pings")
+	cmd.Flags().IntVarP(&opts.Count, "count", "c", opts.Count, "number of echo requests, 0 pings until Ctrl-C")
+	cmd.Flags().DurationVarP(&opts.Interval, "interval", "i", opts.Interval, "time between echo requests")
+	cmd.Flags().IntVarP(&opts.Size, "size", "s", opts.Size, "number of data bytes")
+	cmd.Flags().Uint8VarP(&ttl, "ttl", "t", opts.TTL, "time to live")
+	cmd.Flags().StringVarP(&iface, "interface", "I", "", "send from the address of this interface")
+	cmd.Flags().DurationVarP(&opts.Timeout, "timeout", "W", opts.Timeout, "time to wait for a reply")
+	cmd.Flags().DurationVarP(&opts.Deadline, "deadline", "w", 0, "stop after this time, no matter how many requests were sent")
+	cmd.Flags().BoolVarP(&opts.Flood, "flood", "f", false, "send the next request as soon as a reply arrives")
+	cmd.Flags().BoolVarP(&opts.RecordRoute, "record-route", "R", false, "record the route to the host and back")
 	return cmd
 }
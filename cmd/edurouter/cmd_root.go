@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"github.com/davidkroell/edurouter"
 	"github.com/spf13/cobra"
 )
 
@@ -13,9 +14,20 @@ func rootCommand() *cobra.Command {
 	}
 
 	rootCmd.AddCommand(pingCommand())
+	rootCmd.AddCommand(tracerouteCommand())
 	rootCmd.AddCommand(versionCommand())
 	rootCmd.AddCommand(interfaceCommands())
 	rootCmd.AddCommand(routeCommands())
+	rootCmd.AddCommand(arpCommands())
+	rootCmd.AddCommand(arpScanCommand())
+	rootCmd.AddCommand(captureCommands())
+	rootCmd.AddCommand(decodeCommand())
+	rootCmd.AddCommand(traceCommands())
+	rootCmd.AddCommand(stepCommands())
+	rootCmd.AddCommand(logCommand())
+	rootCmd.AddCommand(stepActionCommand(edurouter.StepNext, "let the paused packet run to the next handler boundary"))
+	rootCmd.AddCommand(stepActionCommand(edurouter.StepContinue, "let the paused packet run through the router"))
+	rootCmd.AddCommand(stepActionCommand(edurouter.StepDrop, "drop the paused packet"))
 
 	return rootCmd
 }
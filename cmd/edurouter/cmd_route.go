@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/davidkroell/edurouter"
 	"github.com/spf13/cobra"
@@ -8,6 +9,8 @@ import (
 	"text/tabwriter"
 )
 
+var ErrUnknownSourceRouteOption = errors.New("edurouter: unknown source route option, use loose or strict")
+
 func routeCommands() *cobra.Command {
 	routeCmds := &cobra.Command{
 		Use:   "route",
@@ -76,6 +79,49 @@ func routeCommands() *cobra.Command {
 	addCmd.Flags().StringVarP(&addr, "address", "a", "", "")
 	addCmd.Flags().StringVar(&nextHop, "next-hop", "", "")
 
-	routeCmds.AddCommand(listCmd, addCmd)
+	sourceRouteCmd := &cobra.Command{
+		Use:   "source-route [loose|strict on|off]",
+		Short: "show or configure whether source routed packets are accepted",
+		Long: `show or configure whether source routed packets are accepted, in transit and addressed to the router.
+Rejected packets are answered with destination unreachable.
+
+options:
+  loose    accept packets with a loose source route option (LSRR)
+  strict   accept packets with a strict source route option (SSRR)`,
+		Args: cobra.RangeArgs(0, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return ErrTooFewArguments
+			}
+
+			policy := listener.SourceRoutePolicy()
+
+			if len(args) == 0 {
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 1, 2, 4, ' ', 0)
+				fmt.Fprintf(w, "%s\t%s\n", "LOOSE", "STRICT")
+				fmt.Fprintf(w, "%s\t%s\n", formatOnOff(policy.AllowLoose), formatOnOff(policy.AllowStrict))
+				return w.Flush()
+			}
+
+			on, err := parseOnOff(args[1])
+			if err != nil {
+				return err
+			}
+
+			switch args[0] {
+			case "loose":
+				policy.AllowLoose = on
+			case "strict":
+				policy.AllowStrict = on
+			default:
+				return ErrUnknownSourceRouteOption
+			}
+
+			listener.SetSourceRoutePolicy(policy)
+			return nil
+		},
+	}
+
+	routeCmds.AddCommand(listCmd, addCmd, sourceRouteCmd)
 	return routeCmds
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/davidkroell/edurouter"
+	"github.com/spf13/cobra"
+	"io"
+	"strings"
+)
+
+// stopBreakpointPrinter stops printing breakpoints when step mode is turned off
+var stopBreakpointPrinter context.CancelFunc
+
+func printBreakpoint(out io.Writer, b *edurouter.Breakpoint) {
+	fmt.Fprintf(out, "[step] trace %d paused at %s\n", b.Trace.ID, b.Stage)
+	fmt.Fprintf(out, "       %s\n", b.PDU)
+	fmt.Fprintln(out, "       next | continue | drop")
+}
+
+func stepCommands() *cobra.Command {
+	stepCmds := &cobra.Command{
+		Use:   "step",
+		Short: "pause packets at every handler boundary",
+	}
+
+	onCmd := &cobra.Command{
+		Use:   "on [filter]",
+		Short: "pause all packets matching the capture filter, all if omitted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var filter *edurouter.CaptureFilter
+
+			if len(args) > 0 {
+				var err error
+				filter, err = edurouter.ParseCaptureFilter(strings.Join(args, " "))
+				if err != nil {
+					return err
+				}
+			}
+
+			stepper := listener.Stepper()
+			stepper.Enable(filter)
+
+			if stopBreakpointPrinter == nil {
+				ctx, cancel := context.WithCancel(context.Background())
+				stopBreakpointPrinter = cancel
+
+				out := cmd.OutOrStdout()
+				go func() {
+					for {
+						select {
+						case <-ctx.Done():
+							return
+						case b := <-stepper.Breakpoints():
+							printBreakpoint(out, b)
+						}
+					}
+				}()
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "step mode on, packets pause at every handler boundary")
+			return nil
+		},
+	}
+
+	offCmd := &cobra.Command{
+		Use:   "off",
+		Short: "let all packets run through the router again",
+		Run: func(cmd *cobra.Command, args []string) {
+			listener.Stepper().Disable()
+
+			if stopBreakpointPrinter != nil {
+				stopBreakpointPrinter()
+				stopBreakpointPrinter = nil
+			}
+		},
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "show the packet waiting for the next step",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b := listener.Stepper().Current()
+			if b == nil {
+				return edurouter.ErrNoBreakpoint
+			}
+
+			printBreakpoint(cmd.OutOrStdout(), b)
+			return nil
+		},
+	}
+
+	stepCmds.AddCommand(onCmd, offCmd, showCmd)
+	return stepCmds
+}
+
+func stepActionCommand(action edurouter.StepAction, short string) *cobra.Command {
+	return &cobra.Command{
+		Use:   action.String(),
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listener.Stepper().Resume(action)
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"strconv"
+	"text/tabwriter"
+)
+
+var ErrNoSuchTrace = errors.New("edurouter: no trace with this id, it may have been forgotten already")
+
+func traceCommands() *cobra.Command {
+	traceCmds := &cobra.Command{
+		Use:   "trace",
+		Short: "show the journey of packets through the router",
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "show the journey of a packet",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return ErrTooFewArguments
+			}
+
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return err
+			}
+
+			trace, ok := listener.Tracer().Get(id)
+			if !ok {
+				return ErrNoSuchTrace
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), trace)
+			return nil
+		},
+	}
+
+	lastCmd := &cobra.Command{
+		Use:   "last",
+		Short: "show the journey of the most recent packet",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trace := listener.Tracer().Last()
+			if trace == nil {
+				return ErrNoSuchTrace
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), trace)
+			return nil
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the most recent traces",
+		Run: func(cmd *cobra.Command, args []string) {
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 1, 2, 4, ' ', 0)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "ID", "INTERFACE", "TIME", "LAST EVENT")
+			for _, trace := range listener.Tracer().Traces() {
+				lastEvent := "-"
+				if events := trace.Events(); len(events) > 0 {
+					lastEvent = events[len(events)-1].Message
+				}
+
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", trace.ID, trace.InterfaceName, trace.Started.Format("15:04:05.000000"), lastEvent)
+			}
+			w.Flush()
+		},
+	}
+
+	traceCmds.AddCommand(showCmd, lastCmd, listCmd)
+	return traceCmds
+}
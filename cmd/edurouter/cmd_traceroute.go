@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/davidkroell/edurouter"
+	"github.com/spf13/cobra"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// tracerouteAnnotation marks probes rejected on the way like the classic traceroute
+func tracerouteAnnotation(p edurouter.TracerouteProbe) string {
+	if p.Type != edurouter.IcmpTypeDestinationUnreachable {
+		return ""
+	}
+
+	switch p.Code {
+	case edurouter.IcmpCodeNetUnreachable:
+		return " !N"
+	case edurouter.IcmpCodeHostUnreachable:
+		return " !H"
+	case edurouter.IcmpCodeProtocolUnreachable:
+		return " !P"
+	case edurouter.IcmpCodePortUnreachable:
+		return ""
+	default:
+		return fmt.Sprintf(" !<%d>", p.Code)
+	}
+}
+
+func printTracerouteHop(w io.Writer, hop edurouter.TracerouteHop) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%2d ", hop.TTL)
+
+	var lastSrc net.IP
+	for _, p := range hop.Probes {
+		if p.Src == nil {
+			sb.WriteString(" *")
+			continue
+		}
+
+		if !p.Src.Equal(lastSrc) {
+			fmt.Fprintf(&sb, " %s ", p.Src)
+			lastSrc = p.Src
+		}
+
+		fmt.Fprintf(&sb, " %.3f ms%s", float64(p.RTT)/float64(time.Millisecond), tracerouteAnnotation(p))
+	}
+
+	fmt.Fprintln(w, sb.String())
+}
+
+func tracerouteCommand() *cobra.Command {
+	opts := edurouter.DefaultTracerouteOptions
+	var useUDP, useICMP bool
+
+	cmd := &cobra.Command{
+		Use:   "traceroute <host> [-m maxhops] [-q probes] [--udp|--icmp]",
+		Short: "show the routers on the path to a host",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ip, err := parseIPv4(args[0])
+			if err != nil {
+				return err
+			}
+
+			if useICMP {
+				opts.Protocol = edurouter.IPProtocolICMPv4
+			}
+
+			if err := opts.Validate(); err != nil {
+				return err
+			}
+
+			ctx, stop := foregroundContext()
+			defer stop()
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "traceroute to %s, %d hops max, press Ctrl-C to stop\n", ip, opts.MaxHops)
+
+			_, err = listener.Traceroute(ctx, ip, opts, func(hop edurouter.TracerouteHop) {
+				printTracerouteHop(out, hop)
+			})
+			return err
+		},
+	}
+
+	cmd.Flags().IntVarP(&opts.MaxHops, "max-hops", "m", opts.MaxHops, "maximum number of hops")
+	cmd.Flags().IntVarP(&opts.Probes, "queries", "q", opts.Probes, "number of probes per hop")
+	cmd.Flags().DurationVarP(&opts.Timeout, "wait", "w", opts.Timeout, "time to wait for the answer to a probe")
+	cmd.Flags().BoolVar(&useUDP, "udp", false, "send UDP datagrams to unused ports (default)")
+	cmd.Flags().BoolVar(&useICMP, "icmp", false, "send ICMP echo requests")
+	cmd.MarkFlagsMutuallyExclusive("udp", "icmp")
+	return cmd
+}
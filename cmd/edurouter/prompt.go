@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -26,6 +27,45 @@ var (
 #####################################################################`
 )
 
+// foreground is the command currently running until it is interrupted.
+// Ctrl-C stops this command instead of the router.
+var foreground struct {
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+// foregroundContext returns a context which is cancelled on Ctrl-C.
+// The returned stop function must be called when the command has finished.
+func foregroundContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	foreground.mu.Lock()
+	foreground.cancel = cancel
+	foreground.mu.Unlock()
+
+	return ctx, func() {
+		foreground.mu.Lock()
+		foreground.cancel = nil
+		foreground.mu.Unlock()
+
+		cancel()
+	}
+}
+
+// interruptForeground cancels the foreground command and reports whether one was running
+func interruptForeground() bool {
+	foreground.mu.Lock()
+	defer foreground.mu.Unlock()
+
+	if foreground.cancel == nil {
+		return false
+	}
+
+	foreground.cancel()
+	foreground.cancel = nil
+	return true
+}
+
 func initSuggestions() {
 	ifaces, err := net.Interfaces()
 	if err == nil {
@@ -73,9 +113,19 @@ func completer(doc prompt.Document) []prompt.Suggest {
 		{Text: "help", Description: "show help"},
 		{Text: "exit", Description: "exit edurouter"},
 		{Text: "ping", Description: "ping a host"},
+		{Text: "traceroute", Description: "show the routers on the path to a host"},
 
 		{Text: "route", Description: "show or configure the IP routes"},
 		{Text: "if", Description: "show  or configure the interfaces"},
+		{Text: "arp", Description: "show or configure the ARP tables"},
+		{Text: "arpscan", Description: "discover the hosts on a network with ARP requests"},
+		{Text: "capture", Description: "show frames matching a filter or capture them into pcapng files"},
+		{Text: "decode", Description: "decode an ethernet frame given as hex bytes"},
+		{Text: "trace", Description: "show the journey of packets through the router"},
+		{Text: "step", Description: "pause packets at every handler boundary"},
+		{Text: "next", Description: "let the paused packet run to the next handler boundary"},
+		{Text: "continue", Description: "let the paused packet run through the router"},
+		{Text: "drop", Description: "drop the paused packet"},
 		{Text: "log", Description: "show or configure the log level"},
 	}
 
@@ -83,7 +133,10 @@ func completer(doc prompt.Document) []prompt.Suggest {
 	if strings.HasPrefix(text, "version") ||
 		strings.HasPrefix(text, "help") ||
 		strings.HasPrefix(text, "exit") ||
-		strings.HasPrefix(text, "ping") {
+		strings.HasPrefix(text, "decode") ||
+		strings.HasPrefix(text, "next") ||
+		strings.HasPrefix(text, "continue") ||
+		strings.HasPrefix(text, "drop") {
 		s = []prompt.Suggest{}
 	}
 
@@ -103,6 +156,19 @@ func completer(doc prompt.Document) []prompt.Suggest {
 			s = []prompt.Suggest{
 				{Text: "list", Description: "list all routes"},
 				{Text: "add", Description: "add a route"},
+				{Text: "source-route", Description: "show or configure whether source routed packets are accepted"},
+			}
+
+			if strings.HasPrefix(text, "route source-route") {
+				switch splitted[len(splitted)-1] {
+				case "loose", "strict":
+					s = []prompt.Suggest{{Text: "on"}, {Text: "off"}}
+				default:
+					s = []prompt.Suggest{
+						{Text: "loose", Description: "accept packets with a loose source route"},
+						{Text: "strict", Description: "accept packets with a strict source route"},
+					}
+				}
 			}
 
 			if strings.HasPrefix(text, "route add") {
@@ -117,13 +183,250 @@ func completer(doc prompt.Document) []prompt.Suggest {
 		}
 	}
 
-	if strings.HasPrefix(text, "log") {
+	if strings.HasPrefix(text, "arp") && !strings.HasPrefix(text, "arpscan") {
+		switch argToComplete {
+		case "-i", "--interface":
+			s = []prompt.Suggest{}
+
+			for _, i := range listener.Interfaces() {
+				s = append(s, prompt.Suggest{Text: i.InterfaceName})
+			}
+
+		default:
+			s = []prompt.Suggest{
+				{Text: "list", Description: "list the ARP entries"},
+				{Text: "add", Description: "add a static ARP entry"},
+				{Text: "del", Description: "delete an ARP entry"},
+				{Text: "flush", Description: "delete the dynamic ARP entries"},
+				{Text: "policy", Description: "show or configure the learning policy"},
+			}
+
+			if len(splitted) > 2 || (len(splitted) == 2 && doc.GetWordBeforeCursor() == "") {
+				s = []prompt.Suggest{
+					{Text: "-i"},
+					{Text: "--interface"},
+				}
+
+				switch splitted[1] {
+				case "flush":
+					s = append(s, prompt.Suggest{Text: "--all", Description: "delete static entries too"})
+				case "policy":
+					switch splitted[len(splitted)-1] {
+					case "solicited-only", "learn-from-ip", "lock-static":
+						s = []prompt.Suggest{{Text: "on"}, {Text: "off"}}
+					default:
+						s = append(s,
+							prompt.Suggest{Text: "solicited-only", Description: "accept only ARP replies to requests sent by the router"},
+							prompt.Suggest{Text: "learn-from-ip", Description: "update entries from received IPv4 packets"},
+							prompt.Suggest{Text: "lock-static", Description: "never overwrite static entries"},
+						)
+					}
+				}
+			}
+		}
+	}
+
+	if strings.HasPrefix(text, "ping") {
+		switch argToComplete {
+		case "-I", "--interface":
+			s = []prompt.Suggest{}
+
+			for _, i := range listener.Interfaces() {
+				s = append(s, prompt.Suggest{Text: i.InterfaceName})
+			}
+
+		case "-c", "--count", "-i", "--interval", "-s", "--size", "-t", "--ttl", "-W", "--timeout", "-w", "--deadline":
+			s = []prompt.Suggest{}
+
+		default:
+			s = []prompt.Suggest{}
+
+			if len(splitted) > 2 || (len(splitted) == 2 && doc.GetWordBeforeCursor() == "") {
+				s = []prompt.Suggest{
+					{Text: "-c", Description: "number of echo requests"},
+					{Text: "-i", Description: "time between echo requests"},
+					{Text: "-s", Description: "number of data bytes"},
+					{Text: "-t", Description: "time to live"},
+					{Text: "-I", Description: "send from the address of this interface"},
+					{Text: "-W", Description: "time to wait for a reply"},
+					{Text: "-w", Description: "stop after this time"},
+					{Text: "-f", Description: "send the next request as soon as a reply arrives"},
+					{Text: "-R", Description: "record the route to the host and back"},
+				}
+			}
+		}
+	}
+
+	if strings.HasPrefix(text, "traceroute") {
+		switch argToComplete {
+		case "-m", "--max-hops", "-q", "--queries", "-w", "--wait":
+			s = []prompt.Suggest{}
+
+		default:
+			s = []prompt.Suggest{}
+
+			if len(splitted) > 2 || (len(splitted) == 2 && doc.GetWordBeforeCursor() == "") {
+				s = []prompt.Suggest{
+					{Text: "-m", Description: "maximum number of hops"},
+					{Text: "-q", Description: "number of probes per hop"},
+					{Text: "-w", Description: "time to wait for the answer to a probe"},
+					{Text: "--udp", Description: "send UDP datagrams to unused ports"},
+					{Text: "--icmp", Description: "send ICMP echo requests"},
+				}
+			}
+		}
+	}
+
+	if strings.HasPrefix(text, "arpscan") {
+		switch argToComplete {
+		case "-i", "--interface":
+			s = []prompt.Suggest{}
+
+			for _, i := range listener.Interfaces() {
+				s = append(s, prompt.Suggest{Text: i.InterfaceName})
+			}
+
+		case "--rate", "--wait":
+			s = []prompt.Suggest{}
+
+		default:
+			s = []prompt.Suggest{
+				{Text: "-i"},
+				{Text: "--interface"},
+				{Text: "--rate", Description: "ARP requests per second"},
+				{Text: "--wait", Description: "time to wait for replies after the last request"},
+			}
+		}
+	}
+
+	if strings.HasPrefix(text, "capture") {
+		switch argToComplete {
+		case "-i", "--interface":
+			s = []prompt.Suggest{}
+
+			for _, i := range listener.Interfaces() {
+				s = append(s, prompt.Suggest{Text: i.InterfaceName})
+			}
+
+		case "-w", "--write":
+			s = []prompt.Suggest{}
+
+		default:
+			s = []prompt.Suggest{
+				{Text: "start", Description: "start writing frames into a pcapng file"},
+				{Text: "stop", Description: "stop a capture"},
+				{Text: "list", Description: "list all running captures"},
+
+				{Text: "iface", Description: "frames of an interface"},
+				{Text: "in", Description: "frames received by the router"},
+				{Text: "out", Description: "frames sent by the router"},
+				{Text: "arp", Description: "ARP frames"},
+				{Text: "ip", Description: "IPv4 packets"},
+				{Text: "icmp", Description: "ICMP packets"},
+				{Text: "ether", Description: "ether proto arp|ip|NUM"},
+				{Text: "host", Description: "packets from or to an address"},
+				{Text: "net", Description: "packets from or to a network"},
+				{Text: "src", Description: "src host|net"},
+				{Text: "dst", Description: "dst host|net"},
+				{Text: "and"},
+				{Text: "or"},
+				{Text: "not"},
+			}
+
+			if len(splitted) > 1 && splitted[1] != "start" && splitted[1] != "stop" && splitted[1] != "list" {
+				// within a filter expression
+				s = s[3:]
+
+				switch splitted[len(splitted)-1] {
+				case "iface":
+					s = []prompt.Suggest{}
+
+					for _, i := range listener.Interfaces() {
+						s = append(s, prompt.Suggest{Text: i.InterfaceName})
+					}
+				case "src", "dst":
+					s = []prompt.Suggest{{Text: "host"}, {Text: "net"}}
+				}
+			}
+
+			if strings.HasPrefix(text, "capture start") {
+				s = []prompt.Suggest{
+					{Text: "-i"},
+					{Text: "--interface"},
+					{Text: "-w"},
+					{Text: "--write"},
+				}
+			}
+
+			if strings.HasPrefix(text, "capture stop") {
+				s = []prompt.Suggest{
+					{Text: "-w"},
+					{Text: "--write"},
+				}
+			}
+		}
+	}
+
+	if strings.HasPrefix(text, "trace") && !strings.HasPrefix(text, "traceroute") {
 		s = []prompt.Suggest{
+			{Text: "show", Description: "show the journey of a packet"},
+			{Text: "last", Description: "show the journey of the most recent packet"},
+			{Text: "list", Description: "list the most recent traces"},
+		}
+
+		if strings.HasPrefix(text, "trace show") {
+			s = []prompt.Suggest{}
+		}
+	}
+
+	if strings.HasPrefix(text, "step") {
+		s = []prompt.Suggest{
+			{Text: "on", Description: "pause all packets matching a capture filter"},
+			{Text: "off", Description: "let all packets run through the router again"},
+			{Text: "show", Description: "show the packet waiting for the next step"},
+		}
+
+		if strings.HasPrefix(text, "step on") || strings.HasPrefix(text, "step off") || strings.HasPrefix(text, "step show") {
+			s = []prompt.Suggest{}
+		}
+	}
+
+	if strings.HasPrefix(text, "log") {
+		levels := []prompt.Suggest{
 			{Text: "none", Description: "disable logging"},
+			{Text: "trace", Description: "set loglevel to trace"},
 			{Text: "debug", Description: "set loglevel to debug"},
 			{Text: "info", Description: "set loglevel to info"},
+			{Text: "warn", Description: "set loglevel to warn"},
 			{Text: "error", Description: "set loglevel to error"},
 		}
+
+		s = append(levels,
+			prompt.Suggest{Text: "file", Description: "write the log into a file, - writes to stdout"},
+			prompt.Suggest{Text: "json", Description: "write the log as JSON lines"},
+		)
+
+		for _, subsystem := range edurouter.LogSubsystems {
+			s = append(s, prompt.Suggest{Text: string(subsystem), Description: "set the loglevel of the " + string(subsystem) + " subsystem"})
+		}
+
+		// the first argument is complete once it is followed by a space
+		if len(splitted) > 2 || (len(splitted) == 2 && doc.GetWordBeforeCursor() == "") {
+			completingSecond := len(splitted) == 2 || (len(splitted) == 3 && doc.GetWordBeforeCursor() != "")
+
+			_, err := edurouter.ParseLogSubsystem(splitted[1])
+
+			switch {
+			case !completingSecond:
+				s = []prompt.Suggest{}
+			case splitted[1] == "json":
+				s = []prompt.Suggest{{Text: "on"}, {Text: "off"}}
+			case err == nil:
+				s = levels
+			default:
+				s = []prompt.Suggest{}
+			}
+		}
 	}
 
 	if strings.HasPrefix(text, "if") {
@@ -137,6 +440,18 @@ func completer(doc prompt.Document) []prompt.Suggest {
 			s = []prompt.Suggest{
 				{Text: "list", Description: "list all interfaces"},
 				{Text: "add", Description: "add an interface"},
+				{Text: "lo", Description: "configure the router-id addresses of the loopback interface"},
+			}
+
+			if strings.HasPrefix(text, "if lo") {
+				s = []prompt.Suggest{
+					{Text: "add", Description: "add a router-id address"},
+					{Text: "del", Description: "delete a router-id address"},
+				}
+
+				if len(splitted) > 3 || (len(splitted) == 3 && doc.GetWordBeforeCursor() == "") {
+					s = []prompt.Suggest{}
+				}
 			}
 
 			if strings.HasPrefix(text, "if add") {
@@ -144,6 +459,13 @@ func completer(doc prompt.Document) []prompt.Suggest {
 					{Text: "-i"},
 					{Text: "--interface"},
 					{Text: "-a"},
+					{Text: "--tap", Description: "create a TAP device"},
+					{Text: "--no-probe", Description: "use the address without probing for conflicts"},
+					{Text: "--proxy-arp", Description: "answer ARP requests for addresses routed through other interfaces"},
+					{Text: "--replay", Description: "replay frames of a pcap file"},
+					{Text: "--replay-out", Description: "write sent frames of a replayed interface into a pcap file"},
+					{Text: "--realtime", Description: "honour the original timing when replaying"},
+					{Text: "--hw-addr", Description: "hardware address of a replayed interface"},
 				}
 			}
 		}
@@ -165,13 +487,23 @@ func ExecutePrompt() {
 	go func() {
 		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
-		<-ch
+
+		for sig := range ch {
+			if sig == os.Interrupt && interruptForeground() {
+				continue
+			}
+			break
+		}
+
 		log.Info().Msg("edurouter close requested")
 		cancel()
 	}()
 
+	// the log is silent until it is enabled with the log command, it would interfere with the prompt otherwise
 	log.Logger = log.Output(zerolog.NewConsoleWriter())
 	log.Logger = log.Level(zerolog.Disabled)
+	edurouter.SetLogOutput(os.Stdout, false)
+	edurouter.SetAllLogLevels(zerolog.Disabled)
 
 	l := edurouter.NewLinkLayerListener()
 
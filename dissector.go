@@ -0,0 +1,461 @@
+package edurouter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mdlayher/ethernet"
+	"net"
+	"strings"
+)
+
+// DissectedField is a header field of a DissectedLayer.
+// Offset is relative to the start of the frame, bit fields report the bytes they are part of.
+type DissectedField struct {
+	Name     string
+	Offset   int
+	Length   int
+	Value    string
+	Children []DissectedField
+}
+
+// DissectedLayer is one protocol layer of a frame with its header fields and the problems found while decoding it
+type DissectedLayer struct {
+	Name     string
+	Offset   int
+	Length   int
+	Fields   []DissectedField
+	Problems []string
+}
+
+func (l *DissectedLayer) addField(name string, offset, length int, format string, args ...any) *DissectedField {
+	l.Fields = append(l.Fields, DissectedField{
+		Name:   name,
+		Offset: offset,
+		Length: length,
+		Value:  fmt.Sprintf(format, args...),
+	})
+	return &l.Fields[len(l.Fields)-1]
+}
+
+func (l *DissectedLayer) addProblem(format string, args ...any) {
+	l.Problems = append(l.Problems, fmt.Sprintf(format, args...))
+}
+
+// Dissection is the decoded layer tree of an ethernet frame
+type Dissection struct {
+	Data   []byte
+	Layers []*DissectedLayer
+}
+
+// Dissect decodes an ethernet frame layer by layer. Decoding stops at the first layer which can not be decoded,
+// the problem is reported on this layer. Bytes which are not part of any layer are reported as Data.
+func Dissect(frame []byte) *Dissection {
+	d := &Dissection{Data: frame}
+
+	var eth ethernet.Frame
+	if err := (&eth).UnmarshalBinary(frame); err != nil {
+		layer := &DissectedLayer{Name: "Ethernet II", Length: len(frame)}
+		layer.addProblem("frame truncated, %d bytes are shorter than an ethernet header", len(frame))
+		d.Layers = append(d.Layers, layer)
+		return d
+	}
+
+	offset := len(frame) - len(eth.Payload)
+	d.Layers = append(d.Layers, dissectEthernet(&eth, offset))
+
+	var next []*DissectedLayer
+
+	switch eth.EtherType {
+	case ethernet.EtherTypeARP:
+		next = dissectARP(eth.Payload, offset)
+	case ethernet.EtherTypeIPv4:
+		next = dissectIPv4(eth.Payload, offset)
+	default:
+		next = []*DissectedLayer{dissectData(eth.Payload, offset)}
+	}
+
+	d.Layers = append(d.Layers, next...)
+	return d
+}
+
+// Problems returns the problems of all layers
+func (d *Dissection) Problems() []string {
+	var problems []string
+	for _, l := range d.Layers {
+		problems = append(problems, l.Problems...)
+	}
+	return problems
+}
+
+// String renders the layer tree like the details pane of Wireshark.
+// Every field is prefixed with its offset in the frame.
+func (d *Dissection) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Frame: %d bytes\n", len(d.Data))
+
+	for _, l := range d.Layers {
+		fmt.Fprintf(&sb, "%04x  %s\n", l.Offset, l.Name)
+
+		for _, f := range l.Fields {
+			writeDissectedField(&sb, f, 1)
+		}
+
+		for _, p := range l.Problems {
+			fmt.Fprintf(&sb, "      [Problem: %s]\n", p)
+		}
+	}
+
+	return sb.String()
+}
+
+func writeDissectedField(sb *strings.Builder, f DissectedField, depth int) {
+	fmt.Fprintf(sb, "%04x  %s%s: %s\n", f.Offset, strings.Repeat("    ", depth), f.Name, f.Value)
+
+	for _, c := range f.Children {
+		writeDissectedField(sb, c, depth+1)
+	}
+}
+
+// HexDump renders b with 16 bytes per line, prefixed by the offset and followed by the printable characters
+func HexDump(b []byte) string {
+	var sb strings.Builder
+
+	for line := 0; line < len(b); line += 16 {
+		end := line + 16
+		if end > len(b) {
+			end = len(b)
+		}
+
+		fmt.Fprintf(&sb, "%04x ", line)
+
+		for i := line; i < line+16; i++ {
+			if i == line+8 {
+				sb.WriteString(" ")
+			}
+
+			if i < end {
+				fmt.Fprintf(&sb, " %02x", b[i])
+			} else {
+				sb.WriteString("   ")
+			}
+		}
+
+		sb.WriteString("   ")
+
+		for _, c := range b[line:end] {
+			if c >= 0x20 && c < 0x7f {
+				sb.WriteByte(c)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func dissectEthernet(eth *ethernet.Frame, headerLength int) *DissectedLayer {
+	l := &DissectedLayer{
+		Name:   fmt.Sprintf("Ethernet II, Src: %s, Dst: %s", eth.Source, eth.Destination),
+		Length: headerLength,
+	}
+
+	l.addField("Destination", 0, 6, "%s", eth.Destination)
+	l.addField("Source", 6, 6, "%s", eth.Source)
+
+	if eth.VLAN != nil {
+		l.addField("802.1Q Virtual LAN", 12, 4, "PRI: %d, DEI: %t, ID: %d", eth.VLAN.Priority, eth.VLAN.DropEligible, eth.VLAN.ID)
+	}
+
+	l.addField("Type", headerLength-2, 2, "%s (0x%04x)", etherTypeName(eth.EtherType), uint16(eth.EtherType))
+	return l
+}
+
+func dissectData(b []byte, offset int) *DissectedLayer {
+	l := &DissectedLayer{
+		Name:   fmt.Sprintf("Data (%d bytes)", len(b)),
+		Offset: offset,
+		Length: len(b),
+	}
+
+	if len(b) > 0 {
+		l.addField("Data", offset, len(b), "%x", b)
+	}
+	return l
+}
+
+func dissectARP(b []byte, offset int) []*DissectedLayer {
+	l := &DissectedLayer{
+		Name:   "Address Resolution Protocol",
+		Offset: offset,
+		Length: len(b),
+	}
+
+	var arp ARPv4Pdu
+	err := (&arp).UnmarshalBinary(b)
+	if errors.Is(err, ErrARPTruncated) {
+		l.addProblem("%v", err)
+		return []*DissectedLayer{l}
+	}
+
+	l.Length = arp.Length()
+
+	if arp.Operation.isKnown() {
+		l.Name += " (" + arp.Operation.String() + ")"
+	}
+
+	hardwareType := "unknown"
+	if arp.HTYPE == HTYPEEthernet {
+		hardwareType = "Ethernet"
+	}
+
+	hlen, plen := int(arp.HLEN), int(arp.PLEN)
+
+	l.addField("Hardware type", offset, 2, "%s (%d)", hardwareType, arp.HTYPE)
+	l.addField("Protocol type", offset+2, 2, "%s (0x%04x)", etherTypeName(arp.PTYPE), uint16(arp.PTYPE))
+	l.addField("Hardware size", offset+4, 1, "%d", arp.HLEN)
+	l.addField("Protocol size", offset+5, 1, "%d", arp.PLEN)
+	l.addField("Opcode", offset+6, 2, "%s (%d)", arp.Operation, arp.Operation)
+
+	n := offset + arpHeaderLength
+	l.addField("Sender MAC address", n, hlen, "%s", formatARPAddress(arp.SrcHardwareAddr, HardwareAddrLen))
+	l.addField("Sender IP address", n+hlen, plen, "%s", formatARPAddress(arp.SrcProtoAddr, net.IPv4len))
+	l.addField("Target MAC address", n+hlen+plen, hlen, "%s", formatARPAddress(arp.DstHardwareAddr, HardwareAddrLen))
+	l.addField("Target IP address", n+2*hlen+plen, plen, "%s", formatARPAddress(arp.DstProtoAddr, net.IPv4len))
+
+	if err != nil {
+		l.addProblem("unknown opcode %d", arp.Operation)
+	}
+
+	if err := arp.ValidateEthernetAndIPv4(); err != nil {
+		l.addProblem("%v", err)
+	}
+
+	layers := []*DissectedLayer{l}
+	if len(b) > l.Length {
+		padding := dissectData(b[l.Length:], offset+l.Length)
+		padding.Name = fmt.Sprintf("Padding (%d bytes)", len(b)-l.Length)
+		layers = append(layers, padding)
+	}
+	return layers
+}
+
+// formatARPAddress formats MAC and IPv4 addresses as usual, other addresses as hex bytes
+func formatARPAddress(addr []byte, length int) string {
+	switch {
+	case len(addr) != length:
+		return fmt.Sprintf("%x", addr)
+	case length == net.IPv4len:
+		return net.IP(addr).String()
+	default:
+		return net.HardwareAddr(addr).String()
+	}
+}
+
+func dissectIPv4(b []byte, offset int) []*DissectedLayer {
+	l := &DissectedLayer{
+		Name:   "Internet Protocol Version 4",
+		Offset: offset,
+		Length: IPv4HeaderLength,
+	}
+
+	if len(b) < IPv4HeaderLength {
+		l.Length = len(b)
+		l.addProblem("header truncated, %d of %d bytes", len(b), IPv4HeaderLength)
+		return []*DissectedLayer{l}
+	}
+
+	ihl := int(b[0] & 0x0f)
+	headerLength := ihl * 4
+
+	if ihl < IPv4IHL {
+		l.addProblem("wrong IHL %d, the header is at least %d bytes long", ihl, IPv4HeaderLength)
+		headerLength = IPv4HeaderLength
+	}
+
+	if headerLength > len(b) {
+		l.Length = len(b)
+		l.addProblem("header truncated, IHL announces %d bytes but only %d are present", headerLength, len(b))
+		return []*DissectedLayer{l}
+	}
+
+	var ip IPv4Pdu
+	if err := (&ip).UnmarshalBinary(b); err != nil {
+		l.addProblem("%v", err)
+		return []*DissectedLayer{l}
+	}
+
+	l.Name = fmt.Sprintf("Internet Protocol Version 4, Src: %s, Dst: %s", ip.SrcIP, ip.DstIP)
+	l.Length = headerLength
+
+	l.addField("Version", offset, 1, "%d", ip.Version)
+	l.addField("Header Length", offset, 1, "%d bytes (%d)", headerLength, ihl)
+	l.addField("Type of Service", offset+1, 1, "0x%02x", ip.TOS)
+	l.addField("Total Length", offset+2, 2, "%d", ip.TotalLength)
+	l.addField("Identification", offset+4, 2, "0x%04x (%d)", ip.Id, ip.Id)
+
+	flags := l.addField("Flags", offset+6, 1, "0x%x", ip.Flags>>5)
+	flags.Children = []DissectedField{
+		{Name: "Reserved bit", Offset: offset + 6, Length: 1, Value: ipv4FlagValue(ip.Flags, 0b1000_0000)},
+		{Name: "Don't fragment", Offset: offset + 6, Length: 1, Value: ipv4FlagValue(ip.Flags, 0b0100_0000)},
+		{Name: "More fragments", Offset: offset + 6, Length: 1, Value: ipv4FlagValue(ip.Flags, 0b0010_0000)},
+	}
+
+	// the fragment offset is read directly, to show the value as it is on the wire
+	fragOffset := binary.BigEndian.Uint16(b[6:8]) & 0x1fff
+	l.addField("Fragment Offset", offset+6, 2, "%d", fragOffset)
+	l.addField("Time to Live", offset+8, 1, "%d", ip.TTL)
+	l.addField("Protocol", offset+9, 1, "%s (%d)", ipProtocolName(ip.Protocol), ip.Protocol)
+
+	expectedChecksum := checksumOf(b[:headerLength], 10)
+	if expectedChecksum == ip.HeaderChecksum {
+		l.addField("Header Checksum", offset+10, 2, "0x%04x [correct]", ip.HeaderChecksum)
+	} else {
+		l.addField("Header Checksum", offset+10, 2, "0x%04x [incorrect, should be 0x%04x]", ip.HeaderChecksum, expectedChecksum)
+		l.addProblem("bad header checksum 0x%04x, should be 0x%04x", ip.HeaderChecksum, expectedChecksum)
+	}
+
+	l.addField("Source Address", offset+12, 4, "%s", ip.SrcIP)
+	l.addField("Destination Address", offset+16, 4, "%s", ip.DstIP)
+
+	if headerLength > IPv4HeaderLength {
+		options := l.addField("Options", offset+IPv4HeaderLength, headerLength-IPv4HeaderLength, "%x", b[IPv4HeaderLength:headerLength])
+
+		parsed, err := ParseIPv4Options(ip.Options)
+		for _, o := range parsed {
+			options.Children = append(options.Children, DissectedField{
+				Name:   o.Type.String(),
+				Offset: offset + IPv4HeaderLength + o.Offset,
+				Length: o.Length(),
+				Value:  o.describe(),
+			})
+		}
+		if err != nil {
+			l.addProblem("malformed option at byte %d", IPv4HeaderLength+malformedIPv4OptionOffset(parsed))
+		}
+	}
+
+	if ip.Version != DefaultIPv4Version {
+		l.addProblem("wrong version %d", ip.Version)
+	}
+
+	payload := b[headerLength:]
+
+	switch {
+	case int(ip.TotalLength) < headerLength:
+		l.addProblem("total length %d is shorter than the header", ip.TotalLength)
+	case int(ip.TotalLength) > len(b):
+		l.addProblem("packet truncated, total length announces %d bytes but only %d are present", ip.TotalLength, len(b))
+	default:
+		payload = b[headerLength:ip.TotalLength]
+	}
+
+	layers := []*DissectedLayer{l}
+
+	payloadOffset := offset + headerLength
+	switch ip.Protocol {
+	case IPProtocolICMPv4:
+		layers = append(layers, dissectICMPv4(payload, payloadOffset))
+	default:
+		layers = append(layers, dissectData(payload, payloadOffset))
+	}
+
+	if trailer := len(b) - headerLength - len(payload); trailer > 0 {
+		padding := dissectData(b[len(b)-trailer:], offset+len(b)-trailer)
+		padding.Name = fmt.Sprintf("Padding (%d bytes)", trailer)
+		layers = append(layers, padding)
+	}
+
+	return layers
+}
+
+func ipv4FlagValue(flags, bit byte) string {
+	if flags&bit != 0 {
+		return "set"
+	}
+	return "not set"
+}
+
+func dissectICMPv4(b []byte, offset int) *DissectedLayer {
+	l := &DissectedLayer{
+		Name:   "Internet Control Message Protocol",
+		Offset: offset,
+		Length: len(b),
+	}
+
+	if len(b) < icmpv4HeaderLength {
+		l.addProblem("header truncated, %d of %d bytes", len(b), icmpv4HeaderLength)
+		return l
+	}
+
+	// UnmarshalBinary clears the checksum field while verifying it and can not handle odd lengths,
+	// so it decodes a copy and the checksum is verified separately
+	var icmp ICMPPacket
+	evenLength := append([]byte{}, b...)
+	if len(evenLength)%2 != 0 {
+		evenLength = append(evenLength, 0)
+	}
+	_ = (&icmp).UnmarshalBinary(evenLength)
+	icmp.Data = icmp.Data[:len(b)-icmpv4HeaderLength]
+
+	checksum := binary.BigEndian.Uint16(b[2:4])
+	expectedChecksum := checksumOf(b, 2)
+
+	l.addField("Type", offset, 1, "%d (%s)", icmp.IcmpType, icmpTypeName(icmp.IcmpType))
+	l.addField("Code", offset+1, 1, "%d", icmp.IcmpCode)
+
+	if checksum == expectedChecksum {
+		l.addField("Checksum", offset+2, 2, "0x%04x [correct]", checksum)
+	} else {
+		l.addField("Checksum", offset+2, 2, "0x%04x [incorrect, should be 0x%04x]", checksum, expectedChecksum)
+		l.addProblem("bad checksum 0x%04x, should be 0x%04x", checksum, expectedChecksum)
+	}
+
+	if icmp.IcmpType == IcmpTypeEchoRequest || icmp.IcmpType == IcmpTypeEchoReply {
+		l.addField("Identifier", offset+4, 2, "0x%04x (%d)", icmp.Id, icmp.Id)
+		l.addField("Sequence Number", offset+6, 2, "%d", icmp.Seq)
+	} else {
+		l.addField("Rest of Header", offset+4, 4, "%x", b[4:8])
+	}
+
+	if len(icmp.Data) > 0 {
+		l.addField("Data", offset+icmpv4HeaderLength, len(icmp.Data), "%x", icmp.Data)
+	}
+
+	return l
+}
+
+func icmpTypeName(t IcmpType) string {
+	switch t {
+	case IcmpTypeEchoReply:
+		return "Echo reply"
+	case IcmpTypeEchoRequest:
+		return "Echo request"
+	case IcmpTypeDestinationUnreachable:
+		return "Destination unreachable"
+	case IcmpTypeTimeExceeded:
+		return "Time exceeded"
+	case IcmpTypeParameterProblem:
+		return "Parameter problem"
+	default:
+		return "unknown"
+	}
+}
+
+// checksumOf computes the checksum of b with the 16-bit checksum field at checksumOffset cleared.
+// Odd lengths are padded with a zero byte.
+func checksumOf(b []byte, checksumOffset int) uint16 {
+	c := make([]byte, len(b), len(b)+1)
+	copy(c, b)
+	c[checksumOffset] = 0
+	c[checksumOffset+1] = 0
+
+	if len(c)%2 != 0 {
+		c = append(c, 0)
+	}
+	return onesComplementChecksum(c)
+}
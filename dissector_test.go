@@ -0,0 +1,173 @@
+package edurouter_test
+
+import (
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"strings"
+	"testing"
+)
+
+func findField(t *testing.T, layer *edurouter.DissectedLayer, name string) edurouter.DissectedField {
+	for _, f := range layer.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	t.Fatalf("field %s not found in layer %s", name, layer.Name)
+	return edurouter.DissectedField{}
+}
+
+func TestDissect_ARP(t *testing.T) {
+	d := edurouter.Dissect(testARPRequestFrame(t).Data)
+
+	require.Len(t, d.Layers, 3)
+	assert.Empty(t, d.Problems())
+
+	assert.Equal(t, "Address Resolution Protocol (request)", d.Layers[1].Name)
+	assert.Equal(t, 14, d.Layers[1].Offset)
+
+	target := findField(t, d.Layers[1], "Target IP address")
+	assert.Equal(t, 38, target.Offset)
+	assert.Equal(t, 4, target.Length)
+	assert.Equal(t, "10.0.0.1", target.Value)
+
+	// minimum ethernet payload size is padded by the ethernet codec
+	assert.Equal(t, "Padding (18 bytes)", d.Layers[2].Name)
+}
+
+func TestDissect_ICMP(t *testing.T) {
+	d := edurouter.Dissect(testEchoReplyFrame(t).Data)
+
+	require.Len(t, d.Layers, 4)
+
+	ip := d.Layers[1]
+	assert.Equal(t, "Internet Protocol Version 4, Src: 10.0.1.1, Dst: 192.168.0.9", ip.Name)
+	assert.Equal(t, 34, ip.Offset+ip.Length)
+	assert.Contains(t, findField(t, ip, "Header Checksum").Value, "[correct]")
+	assert.Equal(t, "ICMP (1)", findField(t, ip, "Protocol").Value)
+
+	icmp := d.Layers[2]
+	assert.Equal(t, "Internet Control Message Protocol", icmp.Name)
+	assert.Equal(t, 34, icmp.Offset)
+	assert.Equal(t, 12, icmp.Length)
+	assert.Equal(t, "0 (Echo reply)", findField(t, icmp, "Type").Value)
+	assert.Equal(t, "3", findField(t, icmp, "Sequence Number").Value)
+	assert.Contains(t, findField(t, icmp, "Checksum").Value, "[correct]")
+
+	assert.Equal(t, "Padding (14 bytes)", d.Layers[3].Name)
+	assert.Empty(t, d.Problems())
+}
+
+func TestDissect_Problems(t *testing.T) {
+	tests := map[string]struct {
+		modify      func(b []byte) []byte
+		wantProblem string
+	}{
+		"FrameTruncated": {
+			modify:      func(b []byte) []byte { return b[:10] },
+			wantProblem: "frame truncated",
+		},
+		"BadHeaderChecksum": {
+			modify: func(b []byte) []byte {
+				b[24] ^= 0xff
+				return b
+			},
+			wantProblem: "bad header checksum",
+		},
+		"WrongIHL": {
+			modify: func(b []byte) []byte {
+				b[14] = 0x43
+				return b
+			},
+			wantProblem: "wrong IHL 3",
+		},
+		"HeaderTruncated": {
+			modify: func(b []byte) []byte {
+				b[14] = 0x4f
+				return b[:40]
+			},
+			wantProblem: "header truncated",
+		},
+		"PacketTruncated": {
+			modify:      func(b []byte) []byte { return b[:40] },
+			wantProblem: "packet truncated",
+		},
+		"BadICMPChecksum": {
+			modify: func(b []byte) []byte {
+				b[36] ^= 0xff
+				return b
+			},
+			wantProblem: "bad checksum",
+		},
+		"ICMPTruncated": {
+			modify: func(b []byte) []byte {
+				// total length of 24 leaves 4 bytes of ICMP
+				b[16] = 0
+				b[17] = 24
+				return b
+			},
+			wantProblem: "header truncated, 4 of 8 bytes",
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := edurouter.Dissect(v.modify(testEchoReplyFrame(t).Data))
+
+			problems := strings.Join(d.Problems(), "\n")
+			assert.Contains(t, problems, v.wantProblem)
+		})
+	}
+}
+
+func TestDissect_IPv4Options(t *testing.T) {
+	ip := testIPv4Fragment()
+	ip.Options = []byte{1, 7, 7, 8, 10, 0, 0, 1, 7, 1}
+	b, err := ip.MarshalBinary()
+	require.NoError(t, err)
+
+	d := edurouter.Dissect(marshalFrame(t, &ethernet.Frame{
+		Destination: net.HardwareAddr{2, 0, 0, 0, 0, 9},
+		Source:      net.HardwareAddr{2, 0, 0, 0, 1, 1},
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     b,
+	}))
+
+	options := findField(t, d.Layers[1], "Options")
+	require.Len(t, options.Children, 2)
+	assert.Equal(t, "No-Operation", options.Children[0].Name)
+	assert.Equal(t, "Record Route", options.Children[1].Name)
+	assert.Equal(t, 35, options.Children[1].Offset)
+	assert.Equal(t, "pointer 8, 10.0.0.1", options.Children[1].Value)
+
+	// the second record route option is too short
+	assert.Contains(t, d.Problems(), "malformed option at byte 28")
+}
+
+func TestDissect_DoesNotModifyFrame(t *testing.T) {
+	frame := testEchoReplyFrame(t).Data
+	original := append([]byte{}, frame...)
+
+	edurouter.Dissect(frame)
+	assert.Equal(t, original, frame)
+}
+
+func TestDissection_String(t *testing.T) {
+	s := edurouter.Dissect(testARPRequestFrame(t).Data).String()
+
+	assert.Contains(t, s, "Frame: 60 bytes\n")
+	assert.Contains(t, s, "000e  Address Resolution Protocol (request)\n")
+	assert.Contains(t, s, "0026      Target IP address: 10.0.0.1\n")
+}
+
+func TestHexDump(t *testing.T) {
+	b := []byte("0123456789abcdef\x00\x01")
+
+	want := "0000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66   0123456789abcdef\n" +
+		"0010  00 01                                              ..\n"
+	assert.Equal(t, want, edurouter.HexDump(b))
+}
@@ -6,15 +6,66 @@ var (
 	HandledPdu                = errors.New("this pdu is processed. this is intended behaviour")
 	ErrDropPdu                = errors.New("no action for given PDU found. dropping it")
 	ErrNoRoute                = errors.New("no route found")
+	ErrTTLExceeded            = errors.New("time to live exceeded in transit")
 	ErrNoLinkLayerHandler     = errors.New("no link layer handler for given etherType found")
 	ErrUnsupportedArpProtocol = errors.New("unsupported ARP Version. requires ethernet+IPv4")
 
+	ErrARPTruncated               = errors.New("ARP packet truncated")
+	ErrUnsupportedARPHardwareType = errors.New("unsupported ARP hardware type. requires ethernet")
+	ErrUnsupportedARPProtocolType = errors.New("unsupported ARP protocol type. requires IPv4")
+	ErrUnknownARPOperation        = errors.New("unknown ARP operation")
+	ErrARPAddressLength           = errors.New("ARP address length does not match HLEN or PLEN")
+
 	ErrNotAnMACHardwareAddress = errors.New("provided hardware address was no MAC address")
 
+	ErrIPv4Truncated      = errors.New("IPv4 packet truncated")
+	ErrIPv4Version        = errors.New("not an IPv4 packet, wrong version")
+	ErrIPv4HeaderLength   = errors.New("IPv4 header length is shorter than 20 bytes")
+	ErrIPv4TotalLength    = errors.New("IPv4 total length does not match the received packet")
+	ErrIPv4Checksum       = errors.New("bad IPv4 header checksum")
+	ErrIPv4OptionsTooLong = errors.New("IPv4 options are longer than 40 bytes")
+	ErrIPv4PacketTooLarge = errors.New("IPv4 packet is larger than 65535 bytes")
+	ErrIPv4BadOption      = errors.New("malformed IPv4 option")
+
 	ErrNotAnIPv4Address       = errors.New("ip address it not an IPv4 address")
 	ErrNoInternetLayerHandler = errors.New("no internet layer handler for given IPProtocol found")
 	ErrARPTimeout             = errors.New("ARP timeout. no MAC found for this IP Address")
-	ErrARPPacketConn          = errors.New("outbound PacketConn was nil")
+	ErrARPPacketConn          = errors.New("outbound frame transport was nil")
+	ErrARPEntryRemoved        = errors.New("ARP entry was removed while resolving it")
+	ErrUnsolicitedARPReply    = errors.New("ARP reply without an outstanding ARP request")
+	ErrARPLearningDisabled    = errors.New("learning ARP entries from this source is disabled")
+	ErrARPEntryLocked         = errors.New("static ARP entry is locked")
+	ErrNoSuchARPEntry         = errors.New("no ARP entry for this IP Address")
+	ErrARPQueueFull           = errors.New("too many packets waiting for ARP resolution of this IP Address")
+	ErrARPScanRangeTooLarge   = errors.New("too many addresses to scan, use a smaller network")
+
+	ErrUnsupportedProbeProtocol = errors.New("probes can only be sent with ICMP or UDP")
+	ErrPingSizeTooLarge         = errors.New("echo request does not fit into an IPv4 packet, use a smaller size")
+	ErrInvalidPingInterval      = errors.New("the interval between echo requests must be positive")
+	ErrInvalidPingTimeout       = errors.New("the time to wait for an echo reply must be positive")
+	ErrInvalidPingCount         = errors.New("the number of echo requests must not be negative")
+	ErrInvalidICMPRateLimit     = errors.New("the interval of the ICMP rate limit must be positive")
+	ErrInvalidTracerouteHops    = errors.New("the maximum number of hops must be between 1 and 255")
+	ErrInvalidTracerouteProbes  = errors.New("at least one probe must be sent per hop")
+	ErrInvalidProbeTimeout      = errors.New("the time to wait for the answer to a probe must be positive")
+
+	ErrFrameTransportClosed = errors.New("frame transport is closed")
+	ErrFrameTooShort        = errors.New("frame is shorter than an ethernet header")
+	ErrTapUnsupported       = errors.New("TAP devices are only supported on linux")
+	ErrUnknownInterface     = errors.New("no interface with this name configured")
+	ErrAddressConflict      = errors.New("address is already in use by another host")
+
+	ErrRouterIDExists = errors.New("router-id is already assigned to the loopback interface")
+	ErrNoSuchRouterID = errors.New("no such router-id on the loopback interface")
+
+	ErrCaptureAlreadyRunning = errors.New("a capture is already writing to this file")
+	ErrNoSuchCapture         = errors.New("no capture found")
+	ErrUnknownCaptureFormat  = errors.New("not a pcap or pcapng capture file")
+	ErrUnsupportedLinkType   = errors.New("only ethernet captures are supported")
+	ErrCaptureRecordTooLarge = errors.New("capture record exceeds the maximum snap length")
+	ErrInvalidCaptureFilter  = errors.New("invalid capture filter")
+	ErrNoBreakpoint          = errors.New("no packet is waiting in step mode")
+	ErrUnknownLogSubsystem   = errors.New("unknown log subsystem")
 
 	ErrNotANetworkAddress                 = errors.New("not a correct network address")
 	ErrNextHopNotOnLinkLocalNetwork       = errors.New("next hop is not on local network of the outbound interface")
@@ -0,0 +1,188 @@
+package edurouter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mdlayher/ethernet"
+	"net"
+	"strings"
+)
+
+// decodedFrame holds the layers of a CapturedFrame which are understood by the router.
+// Frames are decoded once and shared between the capture filter and the summary.
+type decodedFrame struct {
+	CapturedFrame
+	eth  *ethernet.Frame
+	arp  *ARPv4Pdu
+	ipv4 *IPv4Pdu
+}
+
+func decodeFrame(f CapturedFrame) *decodedFrame {
+	d := &decodedFrame{CapturedFrame: f}
+
+	var eth ethernet.Frame
+	if err := (&eth).UnmarshalBinary(f.Data); err != nil {
+		return d
+	}
+	d.eth = &eth
+
+	switch eth.EtherType {
+	case ethernet.EtherTypeARP:
+		var arp ARPv4Pdu
+		if (&arp).UnmarshalBinary(eth.Payload) == nil {
+			d.arp = &arp
+		}
+
+	case ethernet.EtherTypeIPv4:
+		var ipv4 IPv4Pdu
+		if (&ipv4).UnmarshalBinary(eth.Payload) == nil {
+			d.ipv4 = &ipv4
+		}
+	}
+
+	return d
+}
+
+// srcIP returns the sender protocol address of ARP packets and the source address of IPv4 packets
+func (d *decodedFrame) srcIP() net.IP {
+	switch {
+	case d.arp != nil && d.arp.PLEN == net.IPv4len:
+		return d.arp.SrcProtoAddr
+	case d.ipv4 != nil:
+		return d.ipv4.SrcIP
+	}
+	return nil
+}
+
+// dstIP returns the target protocol address of ARP packets and the destination address of IPv4 packets
+func (d *decodedFrame) dstIP() net.IP {
+	switch {
+	case d.arp != nil && d.arp.PLEN == net.IPv4len:
+		return d.arp.DstProtoAddr
+	case d.ipv4 != nil:
+		return d.ipv4.DstIP
+	}
+	return nil
+}
+
+// SummarizeFrame returns a one-line, tcpdump-like description of a frame, e.g.
+// "eth0 in ARP who-has 10.0.0.1 tell 10.0.0.5"
+func SummarizeFrame(f CapturedFrame) string {
+	return decodeFrame(f).summary()
+}
+
+func (d *decodedFrame) summary() string {
+	var sb strings.Builder
+
+	if d.InterfaceName != "" {
+		sb.WriteString(d.InterfaceName)
+		sb.WriteString(" ")
+	}
+	sb.WriteString(d.Direction.String())
+	sb.WriteString(" ")
+
+	switch {
+	case d.eth == nil:
+		fmt.Fprintf(&sb, "malformed frame, length %d", len(d.Data))
+
+	case d.arp != nil:
+		sb.WriteString(summarizeARP(d.arp))
+
+	case d.ipv4 != nil:
+		sb.WriteString(summarizeIPv4(d.ipv4))
+
+	case d.eth.EtherType == ethernet.EtherTypeARP, d.eth.EtherType == ethernet.EtherTypeIPv4:
+		fmt.Fprintf(&sb, "%s, truncated, length %d", etherTypeName(d.eth.EtherType), len(d.eth.Payload))
+
+	default:
+		fmt.Fprintf(&sb, "%s > %s, ethertype %s, length %d", d.eth.Source, d.eth.Destination, etherTypeName(d.eth.EtherType), len(d.eth.Payload))
+	}
+
+	return sb.String()
+}
+
+func summarizeARP(a *ARPv4Pdu) string {
+	if !a.IsEthernetAndIPv4() {
+		return fmt.Sprintf("ARP %s, hardware type %d, protocol type 0x%04x", a.Operation, a.HTYPE, uint16(a.PTYPE))
+	}
+
+	switch a.Operation {
+	case ARPOperationRequest:
+		return fmt.Sprintf("ARP who-has %s tell %s", net.IP(a.DstProtoAddr), net.IP(a.SrcProtoAddr))
+	case ARPOperationResponse:
+		return fmt.Sprintf("ARP %s is-at %s", net.IP(a.SrcProtoAddr), net.HardwareAddr(a.SrcHardwareAddr))
+	default:
+		return fmt.Sprintf("ARP %s (%d)", a.Operation, a.Operation)
+	}
+}
+
+func summarizeIPv4(ip *IPv4Pdu) string {
+	header := fmt.Sprintf("IP %s > %s: ", ip.SrcIP, ip.DstIP)
+
+	switch ip.Protocol {
+	case IPProtocolICMPv4:
+		return header + summarizeICMPv4(ip.Payload)
+	default:
+		return header + fmt.Sprintf("%s, length %d", ipProtocolName(ip.Protocol), len(ip.Payload))
+	}
+}
+
+// summarizeICMPv4 does not use ICMPPacket.UnmarshalBinary, because it modifies the data while verifying the checksum
+func summarizeICMPv4(b []byte) string {
+	if len(b) < icmpv4HeaderLength {
+		return fmt.Sprintf("ICMP, truncated, length %d", len(b))
+	}
+
+	icmpType := IcmpType(b[0])
+	code := b[1]
+	length := len(b)
+
+	switch icmpType {
+	case IcmpTypeEchoRequest, IcmpTypeEchoReply:
+		name := "echo request"
+		if icmpType == IcmpTypeEchoReply {
+			name = "echo reply"
+		}
+
+		return fmt.Sprintf("ICMP %s, id %d, seq %d, length %d", name, binary.BigEndian.Uint16(b[4:6]), binary.BigEndian.Uint16(b[6:8]), length)
+	case IcmpTypeDestinationUnreachable:
+		return fmt.Sprintf("ICMP destination unreachable, code %d, length %d", code, length)
+	case IcmpTypeTimeExceeded:
+		return fmt.Sprintf("ICMP time exceeded, code %d, length %d", code, length)
+	case IcmpTypeParameterProblem:
+		// the pointer is the first byte after the checksum
+		return fmt.Sprintf("ICMP parameter problem, pointer %d, length %d", b[4], length)
+	default:
+		return fmt.Sprintf("ICMP type %d, code %d, length %d", icmpType, code, length)
+	}
+}
+
+func etherTypeName(e ethernet.EtherType) string {
+	switch e {
+	case ethernet.EtherTypeARP:
+		return "ARP"
+	case ethernet.EtherTypeIPv4:
+		return "IPv4"
+	case ethernet.EtherTypeIPv6:
+		return "IPv6"
+	case ethernet.EtherTypeVLAN:
+		return "VLAN"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(e))
+	}
+}
+
+func ipProtocolName(p IPProtocol) string {
+	switch p {
+	case IPProtocolICMPv4:
+		return "ICMP"
+	case IPProtocolIPv4:
+		return "IPIP"
+	case IPProtocolTCP:
+		return "TCP"
+	case IPProtocolUDP:
+		return "UDP"
+	default:
+		return fmt.Sprintf("proto %d", p)
+	}
+}
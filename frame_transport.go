@@ -0,0 +1,193 @@
+package edurouter
+
+import (
+	"crypto/rand"
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+	"net"
+	"strings"
+	"sync"
+)
+
+//go:generate mockgen -destination ./internal/mocks/mock_frame_transport.go -package mocks github.com/davidkroell/edurouter FrameTransport
+
+const ethernetHeaderLength = 14
+
+// FrameTransport moves raw ethernet frames between an InterfaceConfig and the medium it is attached to.
+// The AF_PACKET based RawFrameTransport is used by default.
+type FrameTransport interface {
+	// Open starts receiving frames of the given ether types
+	Open(etherTypes []ethernet.EtherType) error
+	// ReadFrame blocks until a frame is received and copies it into b
+	ReadFrame(b []byte) (int, error)
+	// WriteFrame sends a complete, marshalled ethernet frame
+	WriteFrame(b []byte) error
+	HardwareAddr() net.HardwareAddr
+	MTU() int
+	Close() error
+}
+
+// RandomHardwareAddr returns a random unicast, locally administered MAC address
+func RandomHardwareAddr() net.HardwareAddr {
+	hwAddr := make(net.HardwareAddr, HardwareAddrLen)
+	_, _ = rand.Read(hwAddr)
+
+	// clear the group bit and set the locally administered bit
+	hwAddr[0] = (hwAddr[0] & 0b1111_1110) | 0b0000_0010
+	return hwAddr
+}
+
+// realIPAddrProvider is implemented by transports which share their interface with the kernel
+type realIPAddrProvider interface {
+	RealIPAddr() *net.IPNet
+}
+
+// interfaceNameProvider is implemented by transports which name their interface on Open
+type interfaceNameProvider interface {
+	InterfaceName() string
+}
+
+// RawFrameTransport attaches to an existing kernel interface using AF_PACKET sockets.
+// One socket per ether type is opened, frames of all sockets are read through ReadFrame.
+type RawFrameTransport struct {
+	interfaceName string
+	ifi           *net.Interface
+	conns         map[ethernet.EtherType]net.PacketConn
+	frames        chan []byte
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+func NewRawFrameTransport(interfaceName string) *RawFrameTransport {
+	return &RawFrameTransport{
+		interfaceName: interfaceName,
+		frames:        make(chan []byte, 128),
+		done:          make(chan struct{}),
+	}
+}
+
+func (t *RawFrameTransport) Open(etherTypes []ethernet.EtherType) error {
+	ifi, err := net.InterfaceByName(t.interfaceName)
+	if err != nil {
+		return err
+	}
+	t.ifi = ifi
+
+	t.conns = map[ethernet.EtherType]net.PacketConn{}
+
+	for _, etherType := range etherTypes {
+		conn, err := raw.ListenPacket(ifi, uint16(etherType), nil)
+		if err != nil {
+			_ = t.Close()
+			return err
+		}
+
+		t.conns[etherType] = conn
+		go t.readFromConn(conn)
+	}
+	return nil
+}
+
+func (t *RawFrameTransport) readFromConn(conn net.PacketConn) {
+	b := make([]byte, t.ifi.MTU+ethernetHeaderLength)
+
+	for {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+
+			Logger(LogSubsystemIface).Error().Msgf("failed to receive message: %v", err)
+			continue
+		}
+
+		frame := make([]byte, n)
+		copy(frame, b[:n])
+
+		select {
+		case t.frames <- frame:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *RawFrameTransport) ReadFrame(b []byte) (int, error) {
+	select {
+	case frame := <-t.frames:
+		return copy(b, frame), nil
+	case <-t.done:
+		return 0, ErrFrameTransportClosed
+	}
+}
+
+func (t *RawFrameTransport) WriteFrame(b []byte) error {
+	if len(b) < ethernetHeaderLength {
+		return ErrFrameTooShort
+	}
+
+	etherType := ethernet.EtherType(uint16(b[12])<<8 | uint16(b[13]))
+
+	conn, ok := t.conns[etherType]
+	if !ok {
+		// every AF_PACKET socket can send any ether type, the protocol only filters incoming frames
+		for _, c := range t.conns {
+			conn = c
+			break
+		}
+	}
+
+	if conn == nil {
+		return ErrFrameTransportClosed
+	}
+
+	_, err := conn.WriteTo(b, &raw.Addr{
+		HardwareAddr: b[0:6],
+	})
+	return err
+}
+
+func (t *RawFrameTransport) HardwareAddr() net.HardwareAddr {
+	if t.ifi == nil {
+		return nil
+	}
+	return t.ifi.HardwareAddr
+}
+
+func (t *RawFrameTransport) MTU() int {
+	if t.ifi == nil {
+		return 0
+	}
+	return t.ifi.MTU
+}
+
+// RealIPAddr returns the first IPv4 address the kernel has configured on this interface
+func (t *RawFrameTransport) RealIPAddr() *net.IPNet {
+	ifAddresses, err := t.ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+
+	for _, ipAddr := range ifAddresses {
+		if strings.Contains(ipAddr.String(), ".") {
+			// is IPv4, set real IP
+			realIPAddr := ipAddr.(*net.IPNet)
+			realIPAddr.IP = realIPAddr.IP.To4()
+			return realIPAddr
+		}
+	}
+	return nil
+}
+
+func (t *RawFrameTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		for _, conn := range t.conns {
+			_ = conn.Close()
+		}
+	})
+	return nil
+}
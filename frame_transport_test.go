@@ -0,0 +1,88 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/davidkroell/edurouter/internal/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestInterfaceConfig_SetupAndListenWithTransport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	hwAddr := net.HardwareAddr{10, 10, 10, 20, 20, 20}
+	etherTypes := []ethernet.EtherType{ethernet.EtherTypeARP}
+
+	inFrame := ethernet.Frame{
+		Destination: hwAddr,
+		Source:      net.HardwareAddr{10, 10, 10, 30, 30, 30},
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     make([]byte, 46),
+	}
+	inFrameBinary, err := inFrame.MarshalBinary()
+	require.NoError(t, err)
+
+	mockTransport := mocks.NewMockFrameTransport(ctrl)
+	mockTransport.EXPECT().Open(etherTypes).Return(nil)
+	mockTransport.EXPECT().HardwareAddr().Return(hwAddr)
+	mockTransport.EXPECT().MTU().Return(1500)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	delivered := false
+	mockTransport.EXPECT().ReadFrame(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+		if delivered {
+			// block until the listener is stopped
+			<-ctx.Done()
+			return 0, edurouter.ErrFrameTransportClosed
+		}
+		delivered = true
+		return copy(b, inFrameBinary), nil
+	}).MinTimes(1)
+	mockTransport.EXPECT().Close().Return(nil).AnyTimes()
+
+	config.Transport = mockTransport
+
+	frameChan := make(chan edurouter.FrameIn)
+	err = config.SetupAndListen(ctx, etherTypes, frameChan)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, hwAddr, *config.HardwareAddr)
+	assert.Nil(t, config.RealIPAddr)
+	assert.NotNil(t, config.ArpTable)
+
+	select {
+	case f := <-frameChan:
+		assert.Same(t, config, f.Interface)
+		assert.EqualValues(t, inFrame, *f.Frame)
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+	}
+
+	outFrame := &ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      hwAddr,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     make([]byte, 46),
+	}
+	outFrameBinary, err := outFrame.MarshalBinary()
+	require.NoError(t, err)
+
+	mockTransport.EXPECT().WriteFrame(outFrameBinary).Return(nil)
+
+	err = config.WriteFrame(outFrame)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,136 @@
+package edurouter
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ICMPRateLimit limits the ICMP error messages sent by the router with a token bucket
+type ICMPRateLimit struct {
+	// Interval is the time until another message may be sent
+	Interval time.Duration
+	// Burst is the number of messages which may be sent at once after a quiet period
+	Burst int
+}
+
+// DefaultICMPRateLimit allows bursts of traceroute probes, but not more than 10 messages per second on average
+var DefaultICMPRateLimit = ICMPRateLimit{
+	Interval: 100 * time.Millisecond,
+	Burst:    10,
+}
+
+// icmpRateLimiter is a token bucket, a token is earned every Interval up to Burst tokens
+type icmpRateLimiter struct {
+	limit  ICMPRateLimit
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newICMPRateLimiter(limit ICMPRateLimit) *icmpRateLimiter {
+	return &icmpRateLimiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+// setLimit returns ErrInvalidICMPRateLimit if no tokens would be earned
+func (l *icmpRateLimiter) setLimit(limit ICMPRateLimit) error {
+	if limit.Interval <= 0 {
+		return ErrInvalidICMPRateLimit
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.tokens = float64(limit.Burst)
+	return nil
+}
+
+// allow takes a token and reports whether a message may be sent
+func (l *icmpRateLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.limit.Interval)
+	if l.tokens > float64(l.limit.Burst) {
+		l.tokens = float64(l.limit.Burst)
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// icmpQueryTypes are the ICMP messages which may be answered with an ICMP error.
+// Errors and unknown types, which may be errors, are never answered.
+var icmpQueryTypes = map[IcmpType]bool{
+	IcmpTypeEchoReply:           true,
+	IcmpTypeEchoRequest:         true,
+	IcmpTypeRouterAdvertisement: true,
+	IcmpTypeRouterSolicitation:  true,
+	IcmpTypeTimestamp:           true,
+	IcmpTypeTimestampReply:      true,
+	IcmpTypeInformationRequest:  true,
+	IcmpTypeInformationReply:    true,
+	IcmpTypeAddressMaskRequest:  true,
+	IcmpTypeAddressMaskReply:    true,
+}
+
+// mayAnswerWithICMPError reports whether an ICMP error may be sent about packet, see RFC 1812 section 4.3.2.7
+func mayAnswerWithICMPError(packet *IPv4Pdu) bool {
+	src := packet.SrcIP
+	if src == nil || src.Equal(net.IPv4zero) || src.Equal(net.IPv4bcast) || src.IsMulticast() || src.IsLoopback() {
+		return false
+	}
+
+	if packet.DstIP.IsMulticast() || packet.DstIP.Equal(net.IPv4bcast) {
+		// directed broadcasts depend on the networks of the router and are checked by its handler
+		return false
+	}
+
+	if packet.FragOffset != 0 {
+		// only the first fragment is answered
+		return false
+	}
+
+	if packet.Protocol == IPProtocolICMPv4 && (len(packet.Payload) == 0 || !icmpQueryTypes[IcmpType(packet.Payload[0])]) {
+		return false
+	}
+
+	return true
+}
+
+// newICMPErrorPdu builds an ICMP error message about packet from srcIP.
+// It quotes the IP header including options and the first 8 bytes of the payload of packet.
+// pointer names the bad byte of the header in a parameter problem, it is ignored by other types.
+func newICMPErrorPdu(srcIP net.IP, packet *IPv4Pdu, icmpType IcmpType, code uint8, pointer uint8) *IPv4Pdu {
+	// packets were received, so their options fit into the header
+	quote, _ := packet.MarshalBinary()
+	if n := packet.HeaderLength() + 8; len(quote) > n {
+		quote = quote[:n]
+	}
+
+	icmpPacket := ICMPPacket{
+		IcmpType: icmpType,
+		IcmpCode: code,
+		Data:     quote,
+	}
+
+	if icmpType == IcmpTypeParameterProblem {
+		// the pointer is the first byte after the checksum
+		icmpPacket.Id = uint16(pointer) << 8
+	}
+
+	// never returns an error
+	icmpBinary, _ := icmpPacket.MarshalBinary()
+
+	return NewIPv4Pdu(srcIP, packet.SrcIP, IPProtocolICMPv4, icmpBinary)
+}
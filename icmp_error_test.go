@@ -0,0 +1,355 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+// nextIPv4 returns the next IPv4 packet received on frameCh within timeout, skipping other frames
+func nextIPv4(frameCh <-chan *ethernet.Frame, timeout time.Duration) *edurouter.IPv4Pdu {
+	deadline := time.Now().Add(timeout)
+	for {
+		f := receiveFrame(frameCh, time.Until(deadline))
+		if f == nil {
+			return nil
+		}
+
+		var packet edurouter.IPv4Pdu
+		if f.EtherType == ethernet.EtherTypeIPv4 && (&packet).UnmarshalBinary(f.Payload) == nil {
+			return &packet
+		}
+	}
+}
+
+// icmpErrorSetup is a twoSegmentSetup with the receiver 10.0.1.9 as the next hop to 10.0.2.0/24
+type icmpErrorSetup struct {
+	*twoSegmentSetup
+}
+
+func newICMPErrorSetup(t *testing.T, ctx context.Context) *icmpErrorSetup {
+	s := newTwoSegmentSetup(t, ctx, net.IP{10, 0, 1, 9})
+	s.router.addStaticRoute(t, "10.0.2.0/24", s.receiverIP.String(), 1)
+
+	return &icmpErrorSetup{s}
+}
+
+// send writes an echo request with options from the host to dstIP with the given TTL and returns the IP packet.
+// With another protocol than ICMP, the echo request is sent as opaque payload.
+func (s *icmpErrorSetup) send(t *testing.T, dstIP net.IP, ttl uint8, protocol edurouter.IPProtocol, options []byte) *edurouter.IPv4Pdu {
+	icmpRequest := edurouter.ICMPPacket{
+		IcmpType: edurouter.IcmpTypeEchoRequest,
+		Id:       1,
+		Seq:      1,
+		Data:     []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	icmpBinary, err := icmpRequest.MarshalBinary()
+	require.NoError(t, err)
+
+	ipPdu := edurouter.NewIPv4Pdu(s.hostIP, dstIP, protocol, icmpBinary)
+	ipPdu.TTL = ttl
+	ipPdu.Options = options
+	s.sendPdu(t, ipPdu)
+	return ipPdu
+}
+
+func TestICMPError_TimeExceeded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newICMPErrorSetup(t, ctx)
+	sent := s.send(t, net.IP{10, 0, 1, 50}, 1, edurouter.IPProtocolICMPv4, nil)
+
+	reply := nextIPv4(s.hostFrames, time.Second)
+	require.NotNil(t, reply, "no time exceeded received")
+
+	// sourced from the ingress interface
+	assert.EqualValues(t, s.router.interfaces[0].Addr.IP, reply.SrcIP)
+	assert.EqualValues(t, s.hostIP, reply.DstIP)
+	assert.EqualValues(t, edurouter.DefaultIPv4TTL, reply.TTL)
+
+	var icmpPacket edurouter.ICMPPacket
+	require.NoError(t, (&icmpPacket).UnmarshalBinary(reply.Payload))
+	assert.Equal(t, edurouter.IcmpTypeTimeExceeded, icmpPacket.IcmpType)
+	assert.EqualValues(t, edurouter.IcmpCodeTTLExceeded, icmpPacket.IcmpCode)
+
+	// the original header and 8 bytes of its payload are quoted
+	require.Len(t, icmpPacket.Data, edurouter.IPv4HeaderLength+8)
+
+	var quoted edurouter.IPv4Pdu
+	require.NoError(t, (&quoted).UnmarshalBinary(icmpPacket.Data))
+	assert.EqualValues(t, sent.TotalLength, quoted.TotalLength)
+	assert.EqualValues(t, 1, quoted.TTL)
+	assert.EqualValues(t, sent.DstIP, quoted.DstIP)
+	assert.EqualValues(t, sent.Payload[:8], quoted.Payload)
+}
+
+func TestICMPError_RateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newICMPErrorSetup(t, ctx)
+	require.NoError(t, s.router.listener.SetICMPRateLimit(edurouter.ICMPRateLimit{Interval: time.Hour, Burst: 1}))
+
+	s.send(t, net.IP{10, 0, 1, 50}, 1, edurouter.IPProtocolICMPv4, nil)
+	require.NotNil(t, nextIPv4(s.hostFrames, time.Second), "no time exceeded received")
+
+	s.send(t, net.IP{10, 0, 1, 50}, 1, edurouter.IPProtocolICMPv4, nil)
+	assert.Nil(t, nextIPv4(s.hostFrames, 100*time.Millisecond), "time exceeded not rate limited")
+}
+
+func TestICMPError_InvalidRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newICMPErrorSetup(t, ctx)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := s.router.listener.SetICMPRateLimit(edurouter.ICMPRateLimit{Interval: interval, Burst: 1})
+		assert.ErrorIs(t, err, edurouter.ErrInvalidICMPRateLimit)
+	}
+
+	// the previous limit is kept
+	s.send(t, net.IP{10, 0, 1, 50}, 1, edurouter.IPProtocolICMPv4, nil)
+	assert.NotNil(t, nextIPv4(s.hostFrames, time.Second), "no time exceeded received")
+}
+
+func TestICMPError_DestinationUnreachable(t *testing.T) {
+	tests := map[string]struct {
+		dstIP    net.IP
+		protocol edurouter.IPProtocol
+		wantSrc  net.IP
+		wantCode uint8
+	}{
+		"NetUnreachable": {
+			dstIP:    net.IP{172, 16, 0, 1},
+			protocol: edurouter.IPProtocolICMPv4,
+			wantSrc:  net.IP{10, 0, 0, 1},
+			wantCode: edurouter.IcmpCodeNetUnreachable,
+		},
+		"HostUnreachable": {
+			dstIP:    net.IP{10, 0, 1, 50},
+			protocol: edurouter.IPProtocolICMPv4,
+			wantSrc:  net.IP{10, 0, 0, 1},
+			wantCode: edurouter.IcmpCodeHostUnreachable,
+		},
+		"ProtocolUnreachable": {
+			dstIP:    net.IP{10, 0, 0, 1},
+			protocol: edurouter.IPProtocolUDP,
+			wantSrc:  net.IP{10, 0, 0, 1},
+			wantCode: edurouter.IcmpCodeProtocolUnreachable,
+		},
+		"ProtocolUnreachableOtherInterface": {
+			// sourced from the address the packet was delivered to, not from the ingress interface
+			dstIP:    net.IP{10, 0, 1, 1},
+			protocol: edurouter.IPProtocolUDP,
+			wantSrc:  net.IP{10, 0, 1, 1},
+			wantCode: edurouter.IcmpCodeProtocolUnreachable,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newICMPErrorSetup(t, ctx)
+
+			timeouts := edurouter.DefaultARPTimeouts
+			timeouts.MaxProbes = 2
+			timeouts.RetransTime = 10 * time.Millisecond
+			s.router.interfaces[1].ArpTable.SetTimeouts(timeouts)
+
+			recordRoute := []byte{7, 7, 4, 0, 0, 0, 0, 0}
+			sent := s.send(t, v.dstIP, edurouter.DefaultIPv4TTL, v.protocol, recordRoute)
+
+			reply := nextIPv4(s.hostFrames, time.Second)
+			require.NotNil(t, reply, "no destination unreachable received")
+			assert.EqualValues(t, v.wantSrc, reply.SrcIP)
+			assert.EqualValues(t, s.hostIP, reply.DstIP)
+
+			var icmpPacket edurouter.ICMPPacket
+			require.NoError(t, (&icmpPacket).UnmarshalBinary(reply.Payload))
+			assert.Equal(t, edurouter.IcmpTypeDestinationUnreachable, icmpPacket.IcmpType)
+			assert.Equal(t, v.wantCode, icmpPacket.IcmpCode)
+
+			var quoted edurouter.IPv4Pdu
+			require.NoError(t, (&quoted).UnmarshalBinary(icmpPacket.Data))
+			// the datagram is quoted as received, before its TTL and options were changed
+			assert.EqualValues(t, sent.DstIP, quoted.DstIP)
+			assert.EqualValues(t, sent.Protocol, quoted.Protocol)
+			assert.EqualValues(t, sent.TTL, quoted.TTL)
+			assert.EqualValues(t, recordRoute, quoted.Options)
+			assert.EqualValues(t, sent.Payload[:8], quoted.Payload)
+		})
+	}
+}
+
+func TestICMPError_OddLength(t *testing.T) {
+	tests := map[string]struct {
+		dstIP    net.IP
+		ttl      uint8
+		wantType edurouter.IcmpType
+		wantCode uint8
+	}{
+		"TimeExceeded": {
+			dstIP:    net.IP{10, 0, 1, 50},
+			ttl:      1,
+			wantType: edurouter.IcmpTypeTimeExceeded,
+			wantCode: edurouter.IcmpCodeTTLExceeded,
+		},
+		"NetUnreachable": {
+			dstIP:    net.IP{172, 16, 0, 1},
+			ttl:      edurouter.DefaultIPv4TTL,
+			wantType: edurouter.IcmpTypeDestinationUnreachable,
+			wantCode: edurouter.IcmpCodeNetUnreachable,
+		},
+		"ProtocolUnreachable": {
+			dstIP:    net.IP{10, 0, 0, 1},
+			ttl:      edurouter.DefaultIPv4TTL,
+			wantType: edurouter.IcmpTypeDestinationUnreachable,
+			wantCode: edurouter.IcmpCodeProtocolUnreachable,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newICMPErrorSetup(t, ctx)
+
+			// a single byte of payload makes the quote odd in length
+			ipPdu := edurouter.NewIPv4Pdu(s.hostIP, v.dstIP, edurouter.IPProtocolUDP, []byte{0x42})
+			ipPdu.TTL = v.ttl
+			s.sendPdu(t, ipPdu)
+
+			reply := nextIPv4(s.hostFrames, time.Second)
+			require.NotNil(t, reply, "no ICMP error received")
+
+			var icmpPacket edurouter.ICMPPacket
+			require.NoError(t, (&icmpPacket).UnmarshalBinary(reply.Payload))
+			assert.Equal(t, v.wantType, icmpPacket.IcmpType)
+			assert.Equal(t, v.wantCode, icmpPacket.IcmpCode)
+			require.Len(t, icmpPacket.Data, edurouter.IPv4HeaderLength+1)
+			assert.EqualValues(t, 0x42, icmpPacket.Data[edurouter.IPv4HeaderLength])
+		})
+	}
+}
+
+func TestICMPError_NotAboutICMPErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newICMPErrorSetup(t, ctx)
+
+	timeExceeded := edurouter.ICMPPacket{
+		IcmpType: edurouter.IcmpTypeTimeExceeded,
+		Data:     make([]byte, edurouter.IPv4HeaderLength+8),
+	}
+	icmpBinary, err := timeExceeded.MarshalBinary()
+	require.NoError(t, err)
+
+	s.sendPdu(t, edurouter.NewIPv4Pdu(s.hostIP, net.IP{172, 16, 0, 1}, edurouter.IPProtocolICMPv4, icmpBinary))
+
+	assert.Nil(t, nextIPv4(s.hostFrames, 100*time.Millisecond), "ICMP error sent about an ICMP error")
+}
+
+func TestICMPError_ICMPTypes(t *testing.T) {
+	tests := map[string]struct {
+		icmpType  edurouter.IcmpType
+		wantError bool
+	}{
+		"EchoRequest": {
+			icmpType:  edurouter.IcmpTypeEchoRequest,
+			wantError: true,
+		},
+		"Timestamp": {
+			icmpType:  edurouter.IcmpTypeTimestamp,
+			wantError: true,
+		},
+		"ParameterProblem": {
+			icmpType:  edurouter.IcmpTypeParameterProblem,
+			wantError: false,
+		},
+		"Redirect": {
+			icmpType:  5,
+			wantError: false,
+		},
+		"Unknown": {
+			icmpType:  42,
+			wantError: false,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newICMPErrorSetup(t, ctx)
+
+			icmpPacket := edurouter.ICMPPacket{
+				IcmpType: v.icmpType,
+				Data:     make([]byte, 8),
+			}
+			icmpBinary, err := icmpPacket.MarshalBinary()
+			require.NoError(t, err)
+
+			s.sendPdu(t, edurouter.NewIPv4Pdu(s.hostIP, net.IP{172, 16, 0, 1}, edurouter.IPProtocolICMPv4, icmpBinary))
+
+			reply := nextIPv4(s.hostFrames, 100*time.Millisecond)
+			if v.wantError {
+				assert.NotNil(t, reply, "no net unreachable received")
+			} else {
+				assert.Nil(t, reply, "ICMP error sent about ICMP type %d", v.icmpType)
+			}
+		})
+	}
+}
+
+func TestICMPError_NotAboutBroadcasts(t *testing.T) {
+	tests := map[string]struct {
+		dstIP     net.IP
+		wantError bool
+	}{
+		"Unicast": {
+			dstIP:     net.IP{10, 0, 1, 50},
+			wantError: true,
+		},
+		"LimitedBroadcast": {
+			dstIP:     net.IPv4bcast,
+			wantError: false,
+		},
+		"DirectedBroadcast": {
+			dstIP:     net.IP{10, 0, 1, 255},
+			wantError: false,
+		},
+		"Multicast": {
+			dstIP:     net.IP{224, 0, 0, 9},
+			wantError: false,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newICMPErrorSetup(t, ctx)
+			s.send(t, v.dstIP, 1, edurouter.IPProtocolICMPv4, nil)
+
+			reply := nextIPv4(s.hostFrames, 100*time.Millisecond)
+			if v.wantError {
+				assert.NotNil(t, reply, "no ICMP error received")
+			} else {
+				assert.Nil(t, reply, "ICMP error sent about a packet to %s", v.dstIP)
+			}
+		})
+	}
+}
@@ -15,6 +15,34 @@ type IcmpType uint8
 const (
 	IcmpTypeEchoRequest IcmpType = 8
 	IcmpTypeEchoReply   IcmpType = 0
+	// IcmpTypeDestinationUnreachable is sent back when a packet can not be delivered
+	IcmpTypeDestinationUnreachable IcmpType = 3
+	// IcmpTypeTimeExceeded is sent back when the TTL of a forwarded packet expired
+	IcmpTypeTimeExceeded IcmpType = 11
+	// IcmpTypeParameterProblem is sent back when a packet has a malformed header, the pointer names the bad byte
+	IcmpTypeParameterProblem IcmpType = 12
+
+	// query messages other than echo, see RFC 792, RFC 950 and RFC 1256
+	IcmpTypeRouterAdvertisement IcmpType = 9
+	IcmpTypeRouterSolicitation  IcmpType = 10
+	IcmpTypeTimestamp           IcmpType = 13
+	IcmpTypeTimestampReply      IcmpType = 14
+	IcmpTypeInformationRequest  IcmpType = 15
+	IcmpTypeInformationReply    IcmpType = 16
+	IcmpTypeAddressMaskRequest  IcmpType = 17
+	IcmpTypeAddressMaskReply    IcmpType = 18
+)
+
+const (
+	// codes of IcmpTypeDestinationUnreachable
+	IcmpCodeNetUnreachable      uint8 = 0
+	IcmpCodeHostUnreachable     uint8 = 1
+	IcmpCodeProtocolUnreachable uint8 = 2
+	IcmpCodePortUnreachable     uint8 = 3
+	IcmpCodeSourceRouteFailed   uint8 = 5
+
+	// codes of IcmpTypeTimeExceeded
+	IcmpCodeTTLExceeded uint8 = 0
 )
 
 type ICMPPacket struct {
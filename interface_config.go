@@ -1,13 +1,11 @@
 package edurouter
 
 import (
+	"bytes"
 	"context"
 	"github.com/mdlayher/ethernet"
-	"github.com/mdlayher/raw"
-	"github.com/rs/zerolog/log"
 	"net"
 	"strings"
-	"time"
 )
 
 const (
@@ -16,12 +14,28 @@ const (
 )
 
 type InterfaceConfig struct {
-	InterfaceName      string
-	HardwareAddr       *net.HardwareAddr
-	Addr               *net.IPNet
-	RealIPAddr         *net.IPNet
-	ArpTable           *ARPv4Table
-	managedConnections map[ethernet.EtherType]net.PacketConn
+	InterfaceName string
+	HardwareAddr  *net.HardwareAddr
+	Addr          *net.IPNet
+	RealIPAddr    *net.IPNet
+	ArpTable      *ARPv4Table
+	Transport     FrameTransport
+	// ARPTimeouts configure the aging of the ARP table, DefaultARPTimeouts are used if nil
+	ARPTimeouts *ARPTimeouts
+	// ARPLearning decides which received packets update the ARP table, DefaultARPLearningPolicy is used if nil
+	ARPLearning *ARPLearningPolicy
+	// ProxyARP answers ARP requests for addresses which are routed through other interfaces
+	ProxyARP bool
+	// ConflictDetection probes the emulated address before it is used, no probing is done if nil
+	ConflictDetection *ConflictDetection
+
+	// transport is the Transport in use, wrapped if frames are observed
+	transport     FrameTransport
+	frameObserver FrameObserver
+	tracer        *Tracer
+	acd           *addressConflictDetector
+	// stop closes the interface
+	stop context.CancelFunc
 }
 
 func ParseInterfaceConfig(config string) (*InterfaceConfig, error) {
@@ -56,92 +70,128 @@ func NewInterfaceConfig(name string, addr *net.IPNet) (*InterfaceConfig, error)
 	}, nil
 }
 
-func (i *InterfaceConfig) SetupAndListen(ctx context.Context, supportedEtherTypes []ethernet.EtherType, frameChan chan<- FrameIn) {
-	arpWriter := NewARPv4Writer(i)
-
-	i.ArpTable = NewARPv4Table(i, arpWriter)
+// SetupAndListen opens the interface's FrameTransport and starts reading frames into frameChan.
+// If no transport was configured, the interface is attached to the kernel interface of the same name.
+func (i *InterfaceConfig) SetupAndListen(ctx context.Context, supportedEtherTypes []ethernet.EtherType, frameChan chan<- FrameIn) error {
+	if i.Transport == nil {
+		i.Transport = NewRawFrameTransport(i.InterfaceName)
+	}
 
-	// Select the interface to use for Ethernet traffic
-	ifi, err := net.InterfaceByName(i.InterfaceName)
+	err := i.Transport.Open(supportedEtherTypes)
 	if err != nil {
-		log.Error().Msgf("failed to open interface: %v", err)
-		return
+		return err
 	}
 
-	// map real hardware and IP addresses
-	i.HardwareAddr = &ifi.HardwareAddr
-	ifAddresses, err := ifi.Addrs()
-	for _, ipAddr := range ifAddresses {
-		if strings.Contains(ipAddr.String(), ".") {
-
-			// is IPv4, set real IP
-			i.RealIPAddr = ipAddr.(*net.IPNet)
-			i.RealIPAddr.IP = i.RealIPAddr.IP.To4()
-			break
+	i.transport = i.Transport
+	if i.frameObserver != nil {
+		i.transport = &observedFrameTransport{
+			FrameTransport: i.Transport,
+			iface:          i,
+			observer:       i.frameObserver,
 		}
 	}
 
-	i.managedConnections = map[ethernet.EtherType]net.PacketConn{}
+	arpWriter := NewARPv4Writer(i)
+	arpWriter.Initialize(i.transport)
 
-	for _, etherType := range supportedEtherTypes {
-		conn, err := raw.ListenPacket(ifi, uint16(etherType), nil)
-		if err != nil {
-			log.Error().Msgf("failed to listen: %v", err)
-		}
+	i.ArpTable = NewARPv4Table(i, arpWriter)
+	if i.ARPTimeouts != nil {
+		i.ArpTable.SetTimeouts(*i.ARPTimeouts)
+	}
+	if i.ARPLearning != nil {
+		i.ArpTable.SetLearningPolicy(*i.ARPLearning)
+	}
+	i.ArpTable.RunExpiry(ctx)
 
-		if etherType == ethernet.EtherTypeARP {
-			// inject ARP PacketConn into arpWriter
-			arpWriter.Initialize(conn)
-		}
+	// map real hardware and IP addresses
+	hwAddr := i.Transport.HardwareAddr()
+	i.HardwareAddr = &hwAddr
+
+	if p, ok := i.Transport.(realIPAddrProvider); ok {
+		i.RealIPAddr = p.RealIPAddr()
+	}
+
+	if p, ok := i.Transport.(interfaceNameProvider); ok {
+		i.InterfaceName = p.InterfaceName()
+	}
 
-		i.managedConnections[etherType] = conn
-		go i.readFramesFromConn(ctx, ifi.MTU, conn, frameChan)
+	if i.ConflictDetection != nil {
+		i.acd = newAddressConflictDetector(i, *i.ConflictDetection)
 	}
+
+	go func() {
+		<-ctx.Done()
+		_ = i.transport.Close()
+	}()
+
+	go i.readFrames(ctx, frameChan)
+	return nil
 }
 
-func (i *InterfaceConfig) readFramesFromConn(ctx context.Context, mtu int, conn net.PacketConn, outChan chan<- FrameIn) {
+func (i *InterfaceConfig) readFrames(ctx context.Context, outChan chan<- FrameIn) {
 	// Accept frames up to interface's MTU in size
-	b := make([]byte, mtu)
-	var f ethernet.Frame
+	b := make([]byte, i.transport.MTU()+ethernetHeaderLength)
 
 	// Keep reading frames
 	for {
-		select {
-		case <-ctx.Done():
-			_ = conn.Close()
+		n, err := i.transport.ReadFrame(b)
+		if err == ErrFrameTransportClosed || ctx.Err() != nil {
 			return
-		case <-time.After(time.Nanosecond):
-			// fall-through
 		}
-
-		n, _, err := conn.ReadFrom(b)
 		if err != nil {
-			log.Error().Msgf("failed to receive message: %v", err)
+			Logger(LogSubsystemIface).Error().Msgf("failed to receive message: %v", err)
 			continue
 		}
 
 		// Unpack Ethernet frame into Go representation.
-		if err := (&f).UnmarshalBinary(b[:n]); err != nil {
-			log.Error().Msgf("failed to unmarshal ethernet frame: %v", err)
+		// The frame is handed over to other goroutines, so it must not share memory with the read buffer.
+		data := bytes.Clone(b[:n])
+
+		f := &ethernet.Frame{}
+		if err := f.UnmarshalBinary(data); err != nil {
+			Logger(LogSubsystemIface).Error().Msgf("failed to unmarshal ethernet frame: %v", err)
+			continue
+		}
+
+		Logger(LogSubsystemIface).Debug().
+			Str("iface", i.InterfaceName).
+			Stringer("src", f.Source).
+			Stringer("dst", f.Destination).
+			Str("ether_type", etherTypeName(f.EtherType)).
+			Int("length", n).
+			Msg("frame received")
+
+		trace := i.tracer.NewTrace(i.InterfaceName)
+		trace.Record(TraceStageLinkLayer, "received %s > %s, ethertype %s, %d bytes", f.Source, f.Destination, etherTypeName(f.EtherType), n)
+
+		captured := CapturedFrame{InterfaceName: i.InterfaceName, Direction: FrameDirectionIn, Data: data}
+		trace.selectForStepping(captured)
+
+		if !trace.Checkpoint(ctx, TraceStageLinkLayer, func() string { return SummarizeFrame(captured) }) {
 			continue
 		}
 
-		outChan <- FrameIn{
-			Frame:     &f,
+		select {
+		case outChan <- FrameIn{
+			Frame:     f,
 			Interface: i,
+			Trace:     trace,
+		}:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
 func (i *InterfaceConfig) WriteFrame(f *ethernet.Frame) error {
+	if i.transport == nil {
+		return ErrFrameTransportClosed
+	}
+
 	frameBinary, err := f.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	_, err = i.managedConnections[f.EtherType].WriteTo(frameBinary, &raw.Addr{
-		HardwareAddr: f.Destination,
-	})
-
-	return err
+	return i.transport.WriteFrame(frameBinary)
 }
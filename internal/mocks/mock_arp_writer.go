@@ -47,3 +47,17 @@ func (mr *MockARPWriterMockRecorder) SendArpRequest(arg0 interface{}) *gomock.Ca
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendArpRequest", reflect.TypeOf((*MockARPWriter)(nil).SendArpRequest), arg0)
 }
+
+// SendUnicastArpRequest mocks base method.
+func (m *MockARPWriter) SendUnicastArpRequest(arg0 net.IP, arg1 net.HardwareAddr) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendUnicastArpRequest", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendUnicastArpRequest indicates an expected call of SendUnicastArpRequest.
+func (mr *MockARPWriterMockRecorder) SendUnicastArpRequest(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendUnicastArpRequest", reflect.TypeOf((*MockARPWriter)(nil).SendUnicastArpRequest), arg0, arg1)
+}
@@ -0,0 +1,121 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/davidkroell/edurouter (interfaces: FrameTransport)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	net "net"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	ethernet "github.com/mdlayher/ethernet"
+)
+
+// MockFrameTransport is a mock of FrameTransport interface.
+type MockFrameTransport struct {
+	ctrl     *gomock.Controller
+	recorder *MockFrameTransportMockRecorder
+}
+
+// MockFrameTransportMockRecorder is the mock recorder for MockFrameTransport.
+type MockFrameTransportMockRecorder struct {
+	mock *MockFrameTransport
+}
+
+// NewMockFrameTransport creates a new mock instance.
+func NewMockFrameTransport(ctrl *gomock.Controller) *MockFrameTransport {
+	mock := &MockFrameTransport{ctrl: ctrl}
+	mock.recorder = &MockFrameTransportMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFrameTransport) EXPECT() *MockFrameTransportMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockFrameTransport) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockFrameTransportMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockFrameTransport)(nil).Close))
+}
+
+// HardwareAddr mocks base method.
+func (m *MockFrameTransport) HardwareAddr() net.HardwareAddr {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HardwareAddr")
+	ret0, _ := ret[0].(net.HardwareAddr)
+	return ret0
+}
+
+// HardwareAddr indicates an expected call of HardwareAddr.
+func (mr *MockFrameTransportMockRecorder) HardwareAddr() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HardwareAddr", reflect.TypeOf((*MockFrameTransport)(nil).HardwareAddr))
+}
+
+// MTU mocks base method.
+func (m *MockFrameTransport) MTU() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MTU")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// MTU indicates an expected call of MTU.
+func (mr *MockFrameTransportMockRecorder) MTU() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MTU", reflect.TypeOf((*MockFrameTransport)(nil).MTU))
+}
+
+// Open mocks base method.
+func (m *MockFrameTransport) Open(arg0 []ethernet.EtherType) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Open", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Open indicates an expected call of Open.
+func (mr *MockFrameTransportMockRecorder) Open(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Open", reflect.TypeOf((*MockFrameTransport)(nil).Open), arg0)
+}
+
+// ReadFrame mocks base method.
+func (m *MockFrameTransport) ReadFrame(arg0 []byte) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadFrame", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadFrame indicates an expected call of ReadFrame.
+func (mr *MockFrameTransportMockRecorder) ReadFrame(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFrame", reflect.TypeOf((*MockFrameTransport)(nil).ReadFrame), arg0)
+}
+
+// WriteFrame mocks base method.
+func (m *MockFrameTransport) WriteFrame(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteFrame", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteFrame indicates an expected call of WriteFrame.
+func (mr *MockFrameTransportMockRecorder) WriteFrame(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteFrame", reflect.TypeOf((*MockFrameTransport)(nil).WriteFrame), arg0)
+}
@@ -3,7 +3,9 @@ package edurouter
 import (
 	"bytes"
 	"context"
-	"github.com/rs/zerolog/log"
+	"net"
+	"sync"
+	"time"
 )
 
 type InternetLayerHandler interface {
@@ -18,6 +20,12 @@ type Internetv4LayerHandler struct {
 
 	internetLayerStrategy InternetLayerStrategy
 	routeTable            *RouteTable
+	tracer                *Tracer
+	icmpRateLimiter       *icmpRateLimiter
+	loopback              *Loopback
+	interfaces            func() []*InterfaceConfig
+	sourceRoutePolicy     SourceRoutePolicy
+	policyMu              sync.RWMutex
 }
 
 func (h *Internetv4LayerHandler) SupplierC() chan *InternetV4PacketIn {
@@ -31,11 +39,17 @@ func (h *Internetv4LayerHandler) SupplierLocalC() chan *IPv4Pdu {
 type InternetV4PacketIn struct {
 	Packet   *IPv4Pdu
 	Ifconfig *InterfaceConfig
+	Trace    *PacketTrace
 }
 
 type InternetV4PacketOut struct {
 	Packet    *IPv4Pdu
 	RouteInfo *RouteInfo
+	Trace     *PacketTrace
+	// Ingress is the interface a forwarded packet was received on, it is nil for locally originated packets
+	Ingress *InterfaceConfig
+	// Received is the packet before routing changed its TTL and options, ICMP errors about it quote this packet
+	Received *IPv4Pdu
 }
 
 func NewInternetLayerHandler(publishCh chan<- *InternetV4PacketOut, routeTable *RouteTable) *Internetv4LayerHandler {
@@ -44,6 +58,9 @@ func NewInternetLayerHandler(publishCh chan<- *InternetV4PacketOut, routeTable *
 		supplierLocalCh: make(chan *IPv4Pdu, 128),
 		publishCh:       publishCh,
 		routeTable:      routeTable,
+		icmpRateLimiter: newICMPRateLimiter(DefaultICMPRateLimit),
+		loopback:        NewLoopback(),
+		interfaces:      func() []*InterfaceConfig { return nil },
 	}
 }
 
@@ -51,6 +68,82 @@ func (h *Internetv4LayerHandler) SetStrategy(s InternetLayerStrategy) {
 	h.internetLayerStrategy = s
 }
 
+// SetTracer enables tracing of locally originated packets
+func (h *Internetv4LayerHandler) SetTracer(t *Tracer) {
+	h.tracer = t
+}
+
+// SetLoopback sets the emulated loopback interface, whose addresses are local
+func (h *Internetv4LayerHandler) SetLoopback(lo *Loopback) {
+	h.loopback = lo
+}
+
+// SetInterfaces sets the function returning the interfaces of the router, their addresses are local
+func (h *Internetv4LayerHandler) SetInterfaces(interfaces func() []*InterfaceConfig) {
+	h.interfaces = interfaces
+}
+
+// isLocal reports whether ip is an address of the router, on one of its interfaces or the loopback interface
+func (h *Internetv4LayerHandler) isLocal(ip net.IP) bool {
+	if h.loopback.Owns(ip) {
+		return true
+	}
+
+	for _, iface := range h.interfaces() {
+		if iface.Addr.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBroadcast reports whether ip is the limited broadcast address or the broadcast address of a network of the router
+func (h *Internetv4LayerHandler) isBroadcast(ip net.IP) bool {
+	if ip.Equal(net.IPv4bcast) {
+		return true
+	}
+
+	for _, iface := range h.interfaces() {
+		ones, bits := iface.Addr.Mask.Size()
+		if bits-ones < 2 {
+			// /31 and /32 networks have no broadcast address
+			continue
+		}
+
+		network := iface.Addr.IP.Mask(iface.Addr.Mask)
+		broadcast := make(net.IP, len(network))
+		for n := range network {
+			broadcast[n] = network[n] | ^iface.Addr.Mask[n]
+		}
+		if broadcast.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSourceRoutePolicy decides whether packets with source route options are accepted,
+// both in transit and addressed to the router. Rejected packets are answered with destination unreachable.
+func (h *Internetv4LayerHandler) SetSourceRoutePolicy(p SourceRoutePolicy) {
+	h.policyMu.Lock()
+	defer h.policyMu.Unlock()
+
+	h.sourceRoutePolicy = p
+}
+
+func (h *Internetv4LayerHandler) SourceRoutePolicy() SourceRoutePolicy {
+	h.policyMu.RLock()
+	defer h.policyMu.RUnlock()
+
+	return h.sourceRoutePolicy
+}
+
+// SetICMPRateLimit limits the ICMP error messages sent about dropped packets.
+// It returns ErrInvalidICMPRateLimit if the interval is not positive.
+func (h *Internetv4LayerHandler) SetICMPRateLimit(limit ICMPRateLimit) error {
+	return h.icmpRateLimiter.setLimit(limit)
+}
+
 func (h *Internetv4LayerHandler) RunHandler(ctx context.Context) {
 	go h.runHandler(ctx)
 }
@@ -61,48 +154,344 @@ func (h *Internetv4LayerHandler) runHandler(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case inPkg := <-h.supplierCh:
-			if bytes.Equal(inPkg.Packet.DstIP, inPkg.Ifconfig.RealIPAddr.IP) {
-				// this packet is for the real interface, not for the simulated one
+			if !inPkg.Trace.Checkpoint(ctx, TraceStageInternet, func() string { return describeIPv4(inPkg.Packet) }) {
 				continue
 			}
 
-			if bytes.Equal(inPkg.Packet.DstIP, inPkg.Ifconfig.Addr.IP) {
-				// this packet has to be handled at the simulated IP address
-				err := h.handleLocal(inPkg.Packet)
-				if err != nil {
-					log.Error().Msgf("error during handleLocal: %v", err)
-				}
+			if inPkg.Ifconfig.RealIPAddr != nil && bytes.Equal(inPkg.Packet.DstIP, inPkg.Ifconfig.RealIPAddr.IP) {
+				// this packet is for the real interface, not for the simulated one
+				inPkg.Trace.Record(TraceStageInternet, "%s is the address of the real interface, left to the host", inPkg.Packet.DstIP)
 				continue
 			}
 
-			outPdu, routeInfo, err := h.routeTable.RoutePacket(*inPkg.Packet)
+			if LoopbackNetwork.Contains(inPkg.Packet.DstIP) {
+				// loopback addresses never appear on a link
+				Logger(LogSubsystemIPv4).Debug().
+					Stringer("dst", inPkg.Packet.DstIP).
+					Str("iface", inPkg.Ifconfig.InterfaceName).
+					Msg("loopback destination received on a link, packet dropped")
+				inPkg.Trace.Record(TraceStageInternet, "%s is a loopback address, not accepted on %s, dropped", inPkg.Packet.DstIP, inPkg.Ifconfig.InterfaceName)
+				continue
+			}
 
-			if err != nil && err != ErrDropPdu {
-				log.Error().Msgf("error during packet routing: %v", err)
+			if len(inPkg.Packet.Options) > 0 && !h.checkOptions(inPkg.Packet, inPkg.Ifconfig, inPkg.Trace) {
 				continue
 			}
 
-			h.publishCh <- &InternetV4PacketOut{
-				Packet:    outPdu,
-				RouteInfo: routeInfo,
+			if bytes.Equal(inPkg.Packet.DstIP, inPkg.Ifconfig.Addr.IP) || h.isLocal(inPkg.Packet.DstIP) {
+				if len(inPkg.Packet.Options) > 0 && h.sourceRoute(inPkg.Packet, inPkg.Ifconfig, inPkg.Trace) {
+					continue
+				}
+
+				// this packet has to be handled at the simulated IP address
+				inPkg.Trace.Record(TraceStageInternet, "%s is local, delivering to %s handler", inPkg.Packet.DstIP, ipProtocolName(inPkg.Packet.Protocol))
+				h.deliverLocal(ctx, inPkg.Packet, inPkg.Ifconfig, inPkg.Trace)
+				continue
 			}
 
+			inPkg.Trace.Record(TraceStageInternet, "%s is not local, forwarding", inPkg.Packet.DstIP)
+			h.route(inPkg.Packet, inPkg.Ifconfig, inPkg.Trace)
+
 		case inPkg := <-h.supplierLocalCh:
-			outPdu, routeInfo, err := h.routeTable.RoutePacket(*inPkg)
+			trace := h.tracer.NewTrace("local")
+			trace.Record(TraceStageInternet, "locally originated %s packet to %s", ipProtocolName(inPkg.Protocol), inPkg.DstIP)
+
+			if trace != nil && trace.stepper != nil && trace.stepper.Enabled() {
+				trace.selectForStepping(localCapturedFrame(inPkg))
+			}
 
-			if err != nil && err != ErrDropPdu {
-				log.Error().Msgf("error during packet routing: %v", err)
+			if !trace.Checkpoint(ctx, TraceStageInternet, func() string { return describeIPv4(inPkg) }) {
 				continue
 			}
 
-			h.publishCh <- &InternetV4PacketOut{
-				Packet:    outPdu,
-				RouteInfo: routeInfo,
+			if h.isLocal(inPkg.DstIP) {
+				h.loopBack(ctx, inPkg, trace)
+				continue
 			}
+
+			h.route(inPkg, nil, trace)
 		}
 	}
 }
 
+// deliverLocal hands a packet addressed to the router to the handler of its protocol.
+// ingress is the interface the packet was received on, it is nil for looped back packets.
+func (h *Internetv4LayerHandler) deliverLocal(ctx context.Context, packet *IPv4Pdu, ingress *InterfaceConfig, trace *PacketTrace) {
+	Logger(LogSubsystemIPv4).Debug().
+		Stringer("src", packet.SrcIP).
+		Stringer("dst", packet.DstIP).
+		Str("protocol", ipProtocolName(packet.Protocol)).
+		Msg("delivering packet locally")
+
+	if !trace.Checkpoint(ctx, TraceStageTransport, func() string { return describeIPv4(packet) }) {
+		return
+	}
+
+	err := h.handleLocal(packet)
+	if err == ErrNoInternetLayerHandler {
+		Logger(LogSubsystemIPv4).Debug().Str("protocol", ipProtocolName(packet.Protocol)).Msg("no handler for protocol, packet dropped")
+		trace.Record(TraceStageTransport, "no handler for %s, dropped", ipProtocolName(packet.Protocol))
+		// the error is about the packet delivered to this address, not about forwarding it
+		h.sendICMPErrorFrom(packet.DstIP, packet, ingress, IcmpTypeDestinationUnreachable, IcmpCodeProtocolUnreachable, 0, trace)
+	} else if err != nil {
+		Logger(LogSubsystemIPv4).Error().Msgf("error during handleLocal: %v", err)
+	}
+}
+
+// loopBack delivers a locally originated packet to an address of the router, without sending it on a link.
+// The source address defaults to the destination address, or to LoopbackAddr for LoopbackNetwork.
+func (h *Internetv4LayerHandler) loopBack(ctx context.Context, packet *IPv4Pdu, trace *PacketTrace) {
+	out := *packet
+
+	if out.SrcIP == nil {
+		out.SrcIP = out.DstIP
+		if LoopbackNetwork.Contains(out.DstIP) {
+			out.SrcIP = LoopbackAddr
+		}
+	}
+
+	if out.TTL == 0 {
+		out.TTL = DefaultIPv4TTL
+	}
+
+	trace.Record(TraceStageRoute, "%s is local, looped back on %s", out.DstIP, LoopbackInterfaceName)
+	h.deliverLocal(ctx, &out, nil, trace)
+}
+
+// route looks up the outgoing route of the packet and hands it to the link layer.
+// ingress is the interface a forwarded packet was received on, it is nil for locally originated packets.
+func (h *Internetv4LayerHandler) route(packet *IPv4Pdu, ingress *InterfaceConfig, trace *PacketTrace) {
+	var outPdu *IPv4Pdu
+	var routeInfo *RouteInfo
+	var err error
+
+	if ingress == nil {
+		outPdu, routeInfo, err = h.routeTable.RouteLocalPacket(*packet)
+	} else {
+		outPdu, routeInfo, err = h.routeTable.RoutePacket(*packet)
+	}
+
+	if err == ErrNoRoute {
+		Logger(LogSubsystemRoute).Debug().Stringer("dst", packet.DstIP).Msg("no route, packet dropped")
+		trace.Record(TraceStageRoute, "no route to %s, dropped", packet.DstIP)
+		h.sendICMPError(packet, ingress, IcmpTypeDestinationUnreachable, IcmpCodeNetUnreachable, trace)
+		return
+	}
+	if err == ErrTTLExceeded {
+		Logger(LogSubsystemRoute).Debug().Stringer("dst", packet.DstIP).Msg("ttl expired, packet dropped")
+		trace.Record(TraceStageTTL, "ttl of %d expired, dropped", packet.TTL)
+		h.sendICMPError(packet, ingress, IcmpTypeTimeExceeded, IcmpCodeTTLExceeded, trace)
+		return
+	}
+	if err != nil {
+		Logger(LogSubsystemRoute).Error().Msgf("error during packet routing: %v", err)
+		return
+	}
+
+	Logger(LogSubsystemRoute).Debug().
+		Stringer("dst", packet.DstIP).
+		Stringer("route", &routeInfo.DstNet).
+		Str("iface", routeInfo.OutInterface.InterfaceName).
+		Msg("route found")
+
+	if routeInfo.RouteType == LinkLocalRouteType {
+		trace.Record(TraceStageRoute, "matched %s, directly connected on %s", &routeInfo.DstNet, routeInfo.OutInterface.InterfaceName)
+	} else {
+		trace.Record(TraceStageRoute, "matched %s via %s on %s", &routeInfo.DstNet, routeInfo.NextHop, routeInfo.OutInterface.InterfaceName)
+	}
+
+	switch {
+	case packet.SrcIP == nil:
+		trace.Record(TraceStageTTL, "source set to %s, ttl set to %d", outPdu.SrcIP, outPdu.TTL)
+	case ingress != nil:
+		trace.Record(TraceStageTTL, "ttl decremented from %d to %d", packet.TTL, outPdu.TTL)
+	}
+
+	if len(outPdu.Options) > 0 {
+		h.processOptions(outPdu, routeInfo.OutInterface.Addr.IP, trace)
+	}
+
+	h.publishCh <- &InternetV4PacketOut{
+		Packet:    outPdu,
+		RouteInfo: routeInfo,
+		Trace:     trace,
+		Ingress:   ingress,
+		Received:  packet,
+	}
+}
+
+// checkOptions answers a packet with malformed options with a parameter problem,
+// and a packet with a source route rejected by the SourceRoutePolicy with destination unreachable.
+// This applies to forwarded packets as well as to packets addressed to the router.
+// It returns false if the packet was dropped.
+func (h *Internetv4LayerHandler) checkOptions(packet *IPv4Pdu, ingress *InterfaceConfig, trace *PacketTrace) bool {
+	parsed, err := ParseIPv4Options(packet.Options)
+	if err == nil {
+		policy := h.SourceRoutePolicy()
+
+		for _, o := range parsed {
+			if o.Type != IPv4OptionNop {
+				trace.Record(TraceStageOptions, "%s", o)
+			}
+
+			if (o.Type == IPv4OptionLSRR || o.Type == IPv4OptionSSRR) && !policy.allows(o.Type) {
+				Logger(LogSubsystemIPv4).Debug().
+					Stringer("src", packet.SrcIP).
+					Str("option", o.Type.String()).
+					Msg("source route rejected by policy, packet dropped")
+				trace.Record(TraceStageOptions, "%s rejected by policy, dropped", o.Type)
+				h.sendICMPError(packet, ingress, IcmpTypeDestinationUnreachable, IcmpCodeSourceRouteFailed, trace)
+				return false
+			}
+		}
+		return true
+	}
+
+	pointer := IPv4HeaderLength + malformedIPv4OptionOffset(parsed)
+
+	Logger(LogSubsystemIPv4).Debug().
+		Stringer("src", packet.SrcIP).
+		Int("pointer", pointer).
+		Msg("malformed ipv4 option, packet dropped")
+	trace.Record(TraceStageOptions, "malformed option at byte %d, dropped", pointer)
+	h.sendICMPErrorWithPointer(packet, ingress, IcmpTypeParameterProblem, 0, uint8(pointer), trace)
+	return false
+}
+
+// sourceRoute forwards a packet addressed to the router to the next address of its source route option,
+// which was allowed by checkOptions. The address of the outgoing interface is recorded in the option, see RFC 791.
+// It returns false if the packet has no source route, or the route is completed, and is delivered locally.
+func (h *Internetv4LayerHandler) sourceRoute(packet *IPv4Pdu, ingress *InterfaceConfig, trace *PacketTrace) bool {
+	parsed, _ := ParseIPv4Options(packet.Options)
+
+	for _, o := range parsed {
+		if o.Type != IPv4OptionLSRR && o.Type != IPv4OptionSSRR {
+			continue
+		}
+
+		nextHop, ok := o.nextSourceRouteHop()
+		if !ok {
+			trace.Record(TraceStageOptions, "%s completed", o.Type)
+			return false
+		}
+
+		egress := ingress.Addr.IP
+		routeInfo, err := h.routeTable.getRouteInfoForIP(nextHop)
+		if err == nil {
+			if o.Type == IPv4OptionSSRR && routeInfo.RouteType != LinkLocalRouteType {
+				trace.Record(TraceStageOptions, "%s: %s is not directly connected, dropped", o.Type, nextHop)
+				h.sendICMPError(packet, ingress, IcmpTypeDestinationUnreachable, IcmpCodeSourceRouteFailed, trace)
+				return true
+			}
+			egress = routeInfo.OutInterface.Addr.IP
+		}
+
+		// the options of the received packet are left untouched
+		out := *packet
+		out.Options = append([]byte(nil), packet.Options...)
+		out.DstIP = nextHop
+
+		routed, _ := ParseIPv4Options(out.Options)
+		for _, r := range routed {
+			if r.Offset == o.Offset {
+				r.recordAddress(egress)
+			}
+		}
+
+		trace.Record(TraceStageOptions, "%s: destination rewritten to %s, recorded %s", o.Type, nextHop, egress)
+		h.route(&out, ingress, trace)
+		return true
+	}
+
+	return false
+}
+
+// processOptions records the router in the record route and timestamp options of a packet leaving from egress
+func (h *Internetv4LayerHandler) processOptions(packet *IPv4Pdu, egress net.IP, trace *PacketTrace) {
+	// the options may be shared with the received packet
+	packet.Options = append([]byte(nil), packet.Options...)
+
+	parsed, err := ParseIPv4Options(packet.Options)
+	if err != nil {
+		// locally originated packets are not checked, their options are left as they are
+		return
+	}
+
+	for _, o := range parsed {
+		switch o.Type {
+		case IPv4OptionRecordRoute:
+			if o.recordAddress(egress) {
+				trace.Record(TraceStageOptions, "%s: recorded %s", o.Type, egress)
+			} else {
+				trace.Record(TraceStageOptions, "%s is full", o.Type)
+			}
+
+		case IPv4OptionTimestamp:
+			if o.addTimestamp(egress, time.Now(), h.isLocal) {
+				trace.Record(TraceStageOptions, "%s: added an entry for %s", o.Type, egress)
+			} else {
+				trace.Record(TraceStageOptions, "%s: no entry added, overflow %d", o.Type, o.Data[1]>>4)
+			}
+		}
+	}
+}
+
+// HostUnreachable answers a forwarded packet, whose next hop did not answer ARP requests, with ICMP host unreachable.
+// It is the HostUnreachableFunc of the IPv4LinkLayerOutputHandler.
+func (h *Internetv4LayerHandler) HostUnreachable(pdu *InternetV4PacketOut, err error) {
+	if err != ErrARPTimeout {
+		// the packet was dropped locally, e.g. because too many packets wait for the next hop
+		return
+	}
+
+	h.sendICMPError(pdu.Received, pdu.Ingress, IcmpTypeDestinationUnreachable, IcmpCodeHostUnreachable, pdu.Trace)
+}
+
+// sendICMPError answers a packet dropped while forwarding with an ICMP error from the address of the ingress interface.
+// The message is routed like other locally originated packets. Errors about locally originated packets are not sent.
+func (h *Internetv4LayerHandler) sendICMPError(packet *IPv4Pdu, ingress *InterfaceConfig, icmpType IcmpType, code uint8, trace *PacketTrace) {
+	h.sendICMPErrorWithPointer(packet, ingress, icmpType, code, 0, trace)
+}
+
+// sendICMPErrorWithPointer is sendICMPError with the pointer of a parameter problem
+func (h *Internetv4LayerHandler) sendICMPErrorWithPointer(packet *IPv4Pdu, ingress *InterfaceConfig, icmpType IcmpType, code uint8, pointer uint8, trace *PacketTrace) {
+	if ingress == nil {
+		return
+	}
+
+	h.sendICMPErrorFrom(ingress.Addr.IP, packet, ingress, icmpType, code, pointer, trace)
+}
+
+// sendICMPErrorFrom is sendICMPErrorWithPointer with the source address srcIP
+func (h *Internetv4LayerHandler) sendICMPErrorFrom(srcIP net.IP, packet *IPv4Pdu, ingress *InterfaceConfig, icmpType IcmpType, code uint8, pointer uint8, trace *PacketTrace) {
+	if ingress == nil || !mayAnswerWithICMPError(packet) || h.isBroadcast(packet.DstIP) {
+		return
+	}
+
+	if !h.icmpRateLimiter.allow() {
+		Logger(LogSubsystemICMP).Debug().
+			Stringer("dst", packet.SrcIP).
+			Uint8("type", uint8(icmpType)).
+			Msg("icmp error rate limited")
+		trace.Record(TraceStageTransport, "ICMP %s to %s rate limited, not sent", icmpTypeName(icmpType), packet.SrcIP)
+		return
+	}
+
+	errorPdu := newICMPErrorPdu(srcIP, packet, icmpType, code, pointer)
+
+	select {
+	case h.supplierLocalCh <- errorPdu:
+		Logger(LogSubsystemICMP).Debug().
+			Stringer("dst", packet.SrcIP).
+			Uint8("type", uint8(icmpType)).
+			Uint8("code", code).
+			Msg("sending icmp error")
+		trace.Record(TraceStageTransport, "ICMP %s sent to %s from %s", icmpTypeName(icmpType), packet.SrcIP, srcIP)
+	default:
+		Logger(LogSubsystemICMP).Warn().Stringer("dst", packet.SrcIP).Msg("icmp error dropped, local queue full")
+	}
+}
+
 func (h *Internetv4LayerHandler) handleLocal(packet *IPv4Pdu) error {
 	nextHandler, err := h.internetLayerStrategy.GetHandler(packet.Protocol)
 	if err != nil {
@@ -0,0 +1,302 @@
+package edurouter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// IPv4OptionType is the first byte of an IPv4 option
+type IPv4OptionType uint8
+
+const (
+	IPv4OptionEndOfList   IPv4OptionType = 0
+	IPv4OptionNop         IPv4OptionType = 1
+	IPv4OptionRecordRoute IPv4OptionType = 7
+	IPv4OptionTimestamp   IPv4OptionType = 68
+	// IPv4OptionLSRR is the loose source and record route, the packet may pass other routers between the listed ones
+	IPv4OptionLSRR IPv4OptionType = 131
+	// IPv4OptionSSRR is the strict source and record route, the listed routers must be directly connected
+	IPv4OptionSSRR IPv4OptionType = 137
+)
+
+// flags of IPv4OptionTimestamp
+const (
+	IPv4TimestampOnly         uint8 = 0
+	IPv4TimestampWithAddress  uint8 = 1
+	IPv4TimestampPrespecified uint8 = 3
+)
+
+// ipv4RecordRouteSlots is the number of addresses fitting into a record route option of the maximum length
+const ipv4RecordRouteSlots = (ipv4MaxOptionsLength - 3) / 4
+
+func (t IPv4OptionType) String() string {
+	switch t {
+	case IPv4OptionEndOfList:
+		return "End of Option List"
+	case IPv4OptionNop:
+		return "No-Operation"
+	case IPv4OptionRecordRoute:
+		return "Record Route"
+	case IPv4OptionTimestamp:
+		return "Timestamp"
+	case IPv4OptionLSRR:
+		return "Loose Source Route"
+	case IPv4OptionSSRR:
+		return "Strict Source Route"
+	default:
+		return fmt.Sprintf("Unknown (%d)", uint8(t))
+	}
+}
+
+// IPv4Option is a single option of an IPv4 header
+type IPv4Option struct {
+	Type IPv4OptionType
+	// Offset is the position of the option within the options
+	Offset int
+	// Data is the option after the type and length bytes. It aliases the options it was parsed from,
+	// so processing the option changes them in place.
+	Data []byte
+}
+
+// Length returns the number of bytes of the option including type and length
+func (o IPv4Option) Length() int {
+	if o.Type == IPv4OptionEndOfList || o.Type == IPv4OptionNop {
+		return 1
+	}
+	return len(o.Data) + 2
+}
+
+// ParseIPv4Options splits raw options into single options, parsing stops at the end of option list.
+// If an option is malformed, ErrIPv4BadOption is returned with the options before it,
+// the malformed option starts where the last returned option ends.
+func ParseIPv4Options(b []byte) ([]IPv4Option, error) {
+	var options []IPv4Option
+
+	for offset := 0; offset < len(b); {
+		t := IPv4OptionType(b[offset])
+
+		switch t {
+		case IPv4OptionEndOfList:
+			return options, nil
+		case IPv4OptionNop:
+			options = append(options, IPv4Option{Type: t, Offset: offset})
+			offset++
+			continue
+		}
+
+		if offset+2 > len(b) {
+			return options, ErrIPv4BadOption
+		}
+
+		length := int(b[offset+1])
+		if length < 2 || offset+length > len(b) {
+			return options, ErrIPv4BadOption
+		}
+
+		o := IPv4Option{Type: t, Offset: offset, Data: b[offset+2 : offset+length]}
+		if !o.valid() {
+			return options, ErrIPv4BadOption
+		}
+
+		options = append(options, o)
+		offset += length
+	}
+
+	return options, nil
+}
+
+// malformedIPv4OptionOffset returns the offset of the malformed option following the options parsed
+func malformedIPv4OptionOffset(parsed []IPv4Option) int {
+	if len(parsed) == 0 {
+		return 0
+	}
+	last := parsed[len(parsed)-1]
+	return last.Offset + last.Length()
+}
+
+// valid checks the pointer of the options processed by the router
+func (o IPv4Option) valid() bool {
+	switch o.Type {
+	case IPv4OptionRecordRoute, IPv4OptionLSRR, IPv4OptionSSRR:
+		// the pointer starts at 4, after type, length and pointer
+		return len(o.Data) >= 1 && o.Data[0] >= 4
+	case IPv4OptionTimestamp:
+		// the pointer starts at 5, after type, length, pointer and overflow/flags
+		if len(o.Data) < 2 || o.Data[0] < 5 {
+			return false
+		}
+		flags := o.Data[1] & 0x0f
+		return flags == IPv4TimestampOnly || flags == IPv4TimestampWithAddress || flags == IPv4TimestampPrespecified
+	}
+	return true
+}
+
+// pointer returns the position the option pointer refers to within Data
+func (o IPv4Option) pointer() int {
+	return int(o.Data[0]) - 3
+}
+
+// hasRoom reports whether n bytes fit at the pointer
+func (o IPv4Option) hasRoom(n int) bool {
+	return o.pointer()+n <= len(o.Data)
+}
+
+// recordAddress writes addr at the pointer and advances it. It returns false if the option is full.
+func (o IPv4Option) recordAddress(addr net.IP) bool {
+	if !o.hasRoom(net.IPv4len) {
+		return false
+	}
+
+	copy(o.Data[o.pointer():], addr.To4())
+	o.Data[0] += net.IPv4len
+	return true
+}
+
+// Addresses returns the addresses recorded before the pointer of a route option
+func (o IPv4Option) Addresses() []net.IP {
+	var addrs []net.IP
+	for n := 1; n+net.IPv4len <= o.pointer() && n+net.IPv4len <= len(o.Data); n += net.IPv4len {
+		addrs = append(addrs, net.IP(append([]byte(nil), o.Data[n:n+net.IPv4len]...)))
+	}
+	return addrs
+}
+
+// nextSourceRouteHop returns the next address of a source route option, it returns false if the route is completed
+func (o IPv4Option) nextSourceRouteHop() (net.IP, bool) {
+	if !o.hasRoom(net.IPv4len) {
+		return nil, false
+	}
+
+	p := o.pointer()
+	return net.IP(append([]byte(nil), o.Data[p:p+net.IPv4len]...)), true
+}
+
+// addTimestamp adds an entry to a timestamp option, addr is the address of the router.
+// With prespecified addresses, the timestamp is only added if the next address is local.
+// If the option is full, the overflow counter is incremented.
+func (o IPv4Option) addTimestamp(addr net.IP, now time.Time, isLocal func(net.IP) bool) bool {
+	flags := o.Data[1] & 0x0f
+
+	size := 4
+	if flags != IPv4TimestampOnly {
+		size += net.IPv4len
+	}
+
+	if !o.hasRoom(size) {
+		overflow := o.Data[1] >> 4
+		if overflow < 15 {
+			o.Data[1] = (overflow+1)<<4 | flags
+		}
+		return false
+	}
+
+	p := o.pointer()
+	switch flags {
+	case IPv4TimestampWithAddress:
+		copy(o.Data[p:], addr.To4())
+		p += net.IPv4len
+	case IPv4TimestampPrespecified:
+		if !isLocal(net.IP(o.Data[p : p+net.IPv4len])) {
+			return false
+		}
+		p += net.IPv4len
+	}
+
+	binary.BigEndian.PutUint32(o.Data[p:], ipv4Timestamp(now))
+	o.Data[0] += uint8(size)
+	return true
+}
+
+// ipv4Timestamp returns the milliseconds since midnight UT
+func ipv4Timestamp(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight).Milliseconds())
+}
+
+func (o IPv4Option) String() string {
+	if d := o.describe(); d != "" {
+		return fmt.Sprintf("%s, %s", o.Type, d)
+	}
+	return o.Type.String()
+}
+
+// describe returns the pointer and contents of the options processed by the router
+func (o IPv4Option) describe() string {
+	switch o.Type {
+	case IPv4OptionRecordRoute, IPv4OptionLSRR, IPv4OptionSSRR:
+		return fmt.Sprintf("pointer %d, %s", o.Data[0], formatIPv4Addresses(o.Addresses()))
+	case IPv4OptionTimestamp:
+		return fmt.Sprintf("pointer %d, overflow %d, flags %d", o.Data[0], o.Data[1]>>4, o.Data[1]&0x0f)
+	}
+	return ""
+}
+
+func formatIPv4Addresses(addrs []net.IP) string {
+	if len(addrs) == 0 {
+		return "no addresses"
+	}
+
+	s := make([]string, len(addrs))
+	for n, a := range addrs {
+		s[n] = a.String()
+	}
+	return strings.Join(s, " ")
+}
+
+// NewRecordRouteOption returns an empty record route option with room for the maximum of 9 addresses
+func NewRecordRouteOption() []byte {
+	b := make([]byte, 3+ipv4RecordRouteSlots*net.IPv4len)
+	b[0] = byte(IPv4OptionRecordRoute)
+	b[1] = byte(len(b))
+	b[2] = 4
+	return b
+}
+
+// RecordedRoute returns the addresses of the record route option in options, or nil if there is none
+func RecordedRoute(options []byte) []net.IP {
+	parsed, _ := ParseIPv4Options(options)
+	for _, o := range parsed {
+		if o.Type == IPv4OptionRecordRoute {
+			return o.Addresses()
+		}
+	}
+	return nil
+}
+
+// echoReplyOptions returns the record route and timestamp options of an echo request,
+// which are returned in the echo reply, see RFC 1122 section 3.2.2.6
+func echoReplyOptions(options []byte) []byte {
+	parsed, _ := ParseIPv4Options(options)
+
+	var reply []byte
+	for _, o := range parsed {
+		if o.Type == IPv4OptionRecordRoute || o.Type == IPv4OptionTimestamp {
+			reply = append(reply, options[o.Offset:o.Offset+o.Length()]...)
+		}
+	}
+	return reply
+}
+
+// SourceRoutePolicy decides whether packets with source route options are accepted.
+// Rejected packets are answered with destination unreachable, whether they are addressed to the router or in transit.
+type SourceRoutePolicy struct {
+	AllowLoose  bool
+	AllowStrict bool
+}
+
+// DefaultSourceRoutePolicy rejects source routed packets, like most routers do
+var DefaultSourceRoutePolicy = SourceRoutePolicy{}
+
+func (p SourceRoutePolicy) allows(t IPv4OptionType) bool {
+	switch t {
+	case IPv4OptionLSRR:
+		return p.AllowLoose
+	case IPv4OptionSSRR:
+		return p.AllowStrict
+	}
+	return false
+}
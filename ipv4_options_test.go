@@ -0,0 +1,262 @@
+package edurouter_test
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseIPv4Options(t *testing.T) {
+	tests := map[string]struct {
+		options   []byte
+		wantTypes []edurouter.IPv4OptionType
+		wantErr   error
+	}{
+		"RecordRouteAndTimestamp": {
+			options:   []byte{1, 7, 7, 4, 0, 0, 0, 0, 68, 4, 5, 1, 0, 0, 0},
+			wantTypes: []edurouter.IPv4OptionType{edurouter.IPv4OptionNop, edurouter.IPv4OptionRecordRoute, edurouter.IPv4OptionTimestamp},
+		},
+		"StopsAtEndOfList": {
+			options:   []byte{7, 3, 4, 0, 0xff, 0xff},
+			wantTypes: []edurouter.IPv4OptionType{edurouter.IPv4OptionRecordRoute},
+		},
+		"LengthBeyondOptions": {
+			options: []byte{1, 7, 11, 4, 0, 0, 0, 0},
+			wantErr: edurouter.ErrIPv4BadOption,
+		},
+		"LengthTooShort": {
+			options: []byte{131, 1, 0, 0},
+			wantErr: edurouter.ErrIPv4BadOption,
+		},
+		"MissingLength": {
+			options: []byte{1, 1, 1, 137},
+			wantErr: edurouter.ErrIPv4BadOption,
+		},
+		"PointerTooSmall": {
+			options: []byte{7, 7, 3, 0, 0, 0, 0},
+			wantErr: edurouter.ErrIPv4BadOption,
+		},
+		"UnknownTimestampFlags": {
+			options: []byte{68, 8, 5, 2, 0, 0, 0, 0},
+			wantErr: edurouter.ErrIPv4BadOption,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := edurouter.ParseIPv4Options(v.options)
+			if v.wantErr != nil {
+				assert.ErrorIs(t, err, v.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var types []edurouter.IPv4OptionType
+			for _, o := range parsed {
+				types = append(types, o.Type)
+			}
+			assert.Equal(t, v.wantTypes, types)
+		})
+	}
+}
+
+func TestRecordedRoute(t *testing.T) {
+	option := edurouter.NewRecordRouteOption()
+	require.Len(t, option, 39)
+	assert.Empty(t, edurouter.RecordedRoute(option))
+
+	option[2] = 12
+	copy(option[3:], []byte{10, 0, 0, 1, 10, 0, 1, 1})
+	assert.Equal(t, []net.IP{{10, 0, 0, 1}, {10, 0, 1, 1}}, edurouter.RecordedRoute(option))
+}
+
+func TestIcmpHandler_PingRecordRoute(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1 := newRouterChain(t, ctx)
+
+	opts := edurouter.DefaultPingOptions
+	opts.Count = 2
+	opts.Interval = 10 * time.Millisecond
+	opts.RecordRoute = true
+
+	var replies []edurouter.PingReply
+	stats, err := r1.listener.Ping(ctx, net.IP{10, 0, 2, 2}, opts, func(r edurouter.PingReply) {
+		replies = append(replies, r)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Received)
+
+	// the egress addresses on the way to r3 and back
+	wantRoute := []net.IP{{10, 0, 1, 1}, {10, 0, 2, 1}, {10, 0, 2, 2}, {10, 0, 1, 2}}
+	for _, r := range replies {
+		assert.Equal(t, wantRoute, r.Route)
+	}
+}
+
+// nextICMPError returns the next ICMP message received by the host
+func (s *icmpErrorSetup) nextICMPError(t *testing.T) *edurouter.ICMPPacket {
+	reply := nextIPv4(s.hostFrames, time.Second)
+	require.NotNil(t, reply, "no ICMP error received")
+
+	var icmpPacket edurouter.ICMPPacket
+	require.NoError(t, (&icmpPacket).UnmarshalBinary(reply.Payload))
+	return &icmpPacket
+}
+
+func TestInternetLayerHandler_RecordRouteAndTimestamp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newICMPErrorSetup(t, ctx)
+
+	recordRoute := []byte{7, 11, 8, 10, 0, 0, 2, 0, 0, 0, 0}
+	timestamp := []byte{68, 20, 5, byte(edurouter.IPv4TimestampWithAddress), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	full := []byte{68, 8, 9, byte(edurouter.IPv4TimestampOnly), 0, 0, 0, 0}
+
+	before := time.Now()
+	options := append(append(append([]byte{}, recordRoute...), timestamp...), full...)
+	s.send(t, s.receiverIP, edurouter.DefaultIPv4TTL, edurouter.IPProtocolUDP, options)
+
+	forwarded := nextIPv4(s.receiverFrames, time.Second)
+	require.NotNil(t, forwarded, "packet not forwarded")
+
+	parsed, err := edurouter.ParseIPv4Options(forwarded.Options)
+	require.NoError(t, err)
+	require.Len(t, parsed, 3)
+
+	assert.Equal(t, []net.IP{{10, 0, 0, 2}, {10, 0, 1, 1}}, parsed[0].Addresses())
+
+	// an address and a timestamp were added
+	ts := parsed[1].Data
+	assert.EqualValues(t, 13, ts[0])
+	assert.EqualValues(t, net.IP{10, 0, 1, 1}, net.IP(ts[2:6]))
+	midnight := time.Date(before.UTC().Year(), before.UTC().Month(), before.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	assert.InDelta(t, before.Sub(midnight).Milliseconds(), binary.BigEndian.Uint32(ts[6:10]), 5000)
+
+	// the full option counts the overflow
+	assert.EqualValues(t, 1, parsed[2].Data[1]>>4)
+}
+
+func TestInternetLayerHandler_SourceRoute(t *testing.T) {
+	tests := map[string]struct {
+		option   edurouter.IPv4OptionType
+		route    net.IP
+		policy   edurouter.SourceRoutePolicy
+		transit  bool
+		wantDst  net.IP
+		wantCode uint8
+	}{
+		"LooseAllowed": {
+			option:  edurouter.IPv4OptionLSRR,
+			route:   net.IP{10, 0, 2, 9},
+			policy:  edurouter.SourceRoutePolicy{AllowLoose: true},
+			wantDst: net.IP{10, 0, 2, 9},
+		},
+		"LooseRejected": {
+			option:   edurouter.IPv4OptionLSRR,
+			route:    net.IP{10, 0, 2, 9},
+			policy:   edurouter.SourceRoutePolicy{AllowStrict: true},
+			wantCode: edurouter.IcmpCodeSourceRouteFailed,
+		},
+		"StrictDirectlyConnected": {
+			option:  edurouter.IPv4OptionSSRR,
+			route:   net.IP{10, 0, 1, 9},
+			policy:  edurouter.SourceRoutePolicy{AllowStrict: true},
+			wantDst: net.IP{10, 0, 1, 9},
+		},
+		"StrictNotDirectlyConnected": {
+			option:   edurouter.IPv4OptionSSRR,
+			route:    net.IP{10, 0, 2, 9},
+			policy:   edurouter.SourceRoutePolicy{AllowStrict: true},
+			wantCode: edurouter.IcmpCodeSourceRouteFailed,
+		},
+		"DefaultPolicyRejects": {
+			option:   edurouter.IPv4OptionSSRR,
+			route:    net.IP{10, 0, 1, 9},
+			policy:   edurouter.DefaultSourceRoutePolicy,
+			wantCode: edurouter.IcmpCodeSourceRouteFailed,
+		},
+		"TransitRejected": {
+			option:   edurouter.IPv4OptionLSRR,
+			route:    net.IP{10, 0, 2, 9},
+			policy:   edurouter.DefaultSourceRoutePolicy,
+			transit:  true,
+			wantCode: edurouter.IcmpCodeSourceRouteFailed,
+		},
+		"TransitAllowed": {
+			option:  edurouter.IPv4OptionLSRR,
+			route:   net.IP{10, 0, 2, 9},
+			policy:  edurouter.SourceRoutePolicy{AllowLoose: true},
+			transit: true,
+			wantDst: net.IP{10, 0, 1, 9},
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newICMPErrorSetup(t, ctx)
+			s.router.listener.SetSourceRoutePolicy(v.policy)
+
+			// a transit packet is addressed to the receiver, not to the next address of the route
+			dstIP := net.IP{10, 0, 0, 1}
+			if v.transit {
+				dstIP = s.receiverIP
+			}
+
+			option := append([]byte{byte(v.option), 7, 4}, v.route...)
+			s.send(t, dstIP, edurouter.DefaultIPv4TTL, edurouter.IPProtocolUDP, option)
+
+			if v.wantDst == nil {
+				icmpPacket := s.nextICMPError(t)
+				assert.Equal(t, edurouter.IcmpTypeDestinationUnreachable, icmpPacket.IcmpType)
+				assert.Equal(t, v.wantCode, icmpPacket.IcmpCode)
+				assert.Nil(t, receiveFrame(s.receiverFrames, 50*time.Millisecond), "rejected source route forwarded")
+				return
+			}
+
+			forwarded := nextIPv4(s.receiverFrames, time.Second)
+			require.NotNil(t, forwarded, "packet not forwarded along the source route")
+			assert.EqualValues(t, v.wantDst, forwarded.DstIP)
+			assert.EqualValues(t, edurouter.DefaultIPv4TTL-1, forwarded.TTL)
+
+			parsed, err := edurouter.ParseIPv4Options(forwarded.Options)
+			require.NoError(t, err)
+			require.Len(t, parsed, 1)
+
+			if v.transit {
+				// only the router the packet is addressed to follows the route
+				assert.Empty(t, parsed[0].Addresses())
+				return
+			}
+
+			// the route is completed, the outgoing address replaced the next hop
+			assert.Equal(t, []net.IP{{10, 0, 1, 1}}, parsed[0].Addresses())
+		})
+	}
+}
+
+func TestInternetLayerHandler_MalformedOption(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newICMPErrorSetup(t, ctx)
+
+	// the record route option after the no-operation has a pointer below 4
+	s.send(t, s.receiverIP, edurouter.DefaultIPv4TTL, edurouter.IPProtocolUDP, []byte{1, 7, 7, 2, 0, 0, 0, 0})
+
+	icmpPacket := s.nextICMPError(t)
+	assert.Equal(t, edurouter.IcmpTypeParameterProblem, icmpPacket.IcmpType)
+	assert.EqualValues(t, edurouter.IPv4HeaderLength+1, icmpPacket.Id>>8)
+
+	assert.Nil(t, receiveFrame(s.receiverFrames, 50*time.Millisecond), "packet with malformed option forwarded")
+}
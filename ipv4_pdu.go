@@ -2,7 +2,7 @@ package edurouter
 
 import (
 	"encoding/binary"
-	"io"
+	"math"
 	"net"
 )
 
@@ -22,25 +22,39 @@ const (
 	IPProtocolUDP    IPProtocol = 17
 )
 
+// Flags of the IPv4 header, in the bit positions of IPv4Pdu.Flags
+const (
+	IPv4FlagDontFragment  byte = 0b0100_0000
+	IPv4FlagMoreFragments byte = 0b0010_0000
+)
+
+// ipv4MaxOptionsLength is the space left for options by the largest IHL of 15
+const ipv4MaxOptionsLength = 40
+
 type IPv4Pdu struct {
-	Version        uint8
-	TOS            uint8
-	TotalLength    uint16
-	Id             uint16
-	Flags          byte
+	Version     uint8
+	TOS         uint8
+	TotalLength uint16
+	Id          uint16
+	// Flags holds the three flag bits in its most significant bits
+	Flags byte
+	// FragOffset is the offset of a fragment in units of 8 bytes
 	FragOffset     uint16
 	TTL            uint8
 	Protocol       IPProtocol
 	HeaderChecksum uint16
 	SrcIP          net.IP
 	DstIP          net.IP
-	Payload        []byte
+	// Options are the raw options after the fixed header, padded to a multiple of 4 bytes when marshalled
+	Options []byte
+	Payload []byte
 }
 
 func NewIPv4Pdu(srcIp, dstIp net.IP, ipProto IPProtocol, payload []byte) *IPv4Pdu {
 	return &IPv4Pdu{
 		Version:     DefaultIPv4Version,
 		TotalLength: IPv4HeaderLength + uint16(len(payload)),
+		TTL:         DefaultIPv4TTL,
 		Protocol:    ipProto,
 		SrcIP:       srcIp,
 		DstIP:       dstIp,
@@ -48,83 +62,128 @@ func NewIPv4Pdu(srcIp, dstIp net.IP, ipProto IPProtocol, payload []byte) *IPv4Pd
 	}
 }
 
+// HeaderLength returns the length of the marshalled header including the padded options
+func (ip *IPv4Pdu) HeaderLength() int {
+	return IPv4HeaderLength + (len(ip.Options)+3)/4*4
+}
+
 func (ip *IPv4Pdu) MarshalBinary() ([]byte, error) {
-	length := IPv4HeaderLength + uint16(len(ip.Payload))
+	if len(ip.Options) > ipv4MaxOptionsLength {
+		return nil, ErrIPv4OptionsTooLong
+	}
+
+	headerLength := ip.HeaderLength()
+	length := headerLength + len(ip.Payload)
+	if length > math.MaxUint16 {
+		return nil, ErrIPv4PacketTooLarge
+	}
 
 	b := make([]byte, length)
 
-	b[0] = (ip.Version << 4) | IPv4IHL
+	// IHL is the length of the header in 32-bit words
+	b[0] = (ip.Version << 4) | uint8(headerLength/4)
 	b[1] = ip.TOS
 
-	binary.BigEndian.PutUint16(b[2:4], length)
+	binary.BigEndian.PutUint16(b[2:4], uint16(length))
 	binary.BigEndian.PutUint16(b[4:6], ip.Id)
 
-	b[6] = ip.Flags & 0b1110_0000
+	// three flag bits followed by 13 bits of fragment offset
+	binary.BigEndian.PutUint16(b[6:8], uint16(ip.Flags&0b1110_0000)<<8|ip.FragOffset&0x1fff)
 
 	b[8] = ip.TTL
 	b[9] = uint8(ip.Protocol)
 
-	copy(b[12:16], ip.SrcIP)
-	copy(b[16:20], ip.DstIP)
+	copy(b[12:16], ip.SrcIP.To4())
+	copy(b[16:20], ip.DstIP.To4())
 
-	// Clear checksum bytes
-	b[10] = 0
-	b[11] = 0
-	checksum := onesComplementChecksum(b[:20])
-	// write checksum back
+	// the padding after the options is zero, which is the end of option list
+	copy(b[IPv4HeaderLength:headerLength], ip.Options)
+
+	checksum := onesComplementChecksum(b[:headerLength])
 	binary.BigEndian.PutUint16(b[10:12], checksum)
 
-	copy(b[20:], ip.Payload)
+	copy(b[headerLength:], ip.Payload)
 
 	return b, nil
 }
 
-func (ip *IPv4Pdu) UnmarshalBinary(payload []byte) error {
-	if len(payload) < IPv4HeaderLength {
-		return io.ErrUnexpectedEOF
+// UnmarshalBinary decodes the header and options of an IPv4 packet.
+// The payload ends at TotalLength, so ethernet padding is left out. If TotalLength points beyond the end of b,
+// e.g. for the truncated packet quoted in an ICMP error, the payload is the rest of b.
+// UnmarshalBinary does not validate the header, received packets are checked with VerifyIPv4Header first.
+func (ip *IPv4Pdu) UnmarshalBinary(b []byte) error {
+	if len(b) < IPv4HeaderLength {
+		return ErrIPv4Truncated
 	}
 
 	// Version and IHL share first byte
-	// select first 4 bits and shift right 4 times is the result
-	ip.Version = (payload[0] & 0b1111_0000) >> 4
+	ip.Version = b[0] >> 4
 
-	// take only last 4 bits
-	// ihl is parsed, but not used
-	ihl := payload[0] & 0b0000_1111
+	// IHL is the length of the header in 32-bit words, a wrong IHL below 5 is read as 5
+	headerLength := int(b[0]&0b0000_1111) * 4
+	if headerLength < IPv4HeaderLength {
+		headerLength = IPv4HeaderLength
+	}
+	if headerLength > len(b) {
+		return ErrIPv4Truncated
+	}
 
-	ip.TOS = payload[1]
+	ip.TOS = b[1]
+	ip.TotalLength = binary.BigEndian.Uint16(b[2:4])
+	ip.Id = binary.BigEndian.Uint16(b[4:6])
 
-	ip.TotalLength = binary.BigEndian.Uint16(payload[2:4])
+	// three flag bits followed by 13 bits of fragment offset
+	ip.Flags = b[6] & 0b1110_0000
+	ip.FragOffset = binary.BigEndian.Uint16(b[6:8]) & 0x1fff
 
-	ip.Id = binary.BigEndian.Uint16(payload[4:6])
+	ip.TTL = b[8]
+	ip.Protocol = IPProtocol(b[9])
+	ip.HeaderChecksum = binary.BigEndian.Uint16(b[10:12])
+	ip.SrcIP = b[12:16]
+	ip.DstIP = b[16:20]
 
-	// only first three bits
-	ip.Flags = payload[6] & 0b1110_0000
-	// 5 bits from 6-th byte, full byte from 7th byte
-	ip.FragOffset = (uint16((payload[6]&0b0001_1111)>>3) << 8) + uint16(payload[7])
+	ip.Options = nil
+	if headerLength > IPv4HeaderLength {
+		ip.Options = b[IPv4HeaderLength:headerLength]
+	}
 
-	ip.TTL = payload[8]
+	payloadEnd := len(b)
+	if total := int(ip.TotalLength); total >= headerLength && total < payloadEnd {
+		payloadEnd = total
+	}
 
-	ip.Protocol = IPProtocol(payload[9])
-	ip.HeaderChecksum = binary.BigEndian.Uint16(payload[10:12])
-	ip.SrcIP = payload[12:16]
-	ip.DstIP = payload[16:20]
+	ip.Payload = b[headerLength:payloadEnd]
+	return nil
+}
 
-	// the default starting byte of the Payload without options.
-	// options are only rarely used
-	payloadStartByte := uint8(IPv4HeaderLength)
+// VerifyIPv4Header checks the header of a received IPv4 packet: the version, header length, total length and
+// header checksum. Packets failing the check must not be forwarded.
+func VerifyIPv4Header(b []byte) error {
+	if len(b) < IPv4HeaderLength {
+		return ErrIPv4Truncated
+	}
 
-	if ihl > 5 {
-		// internetHeaderLength is the length of the header in 32-bits words
-		// minimal size: 5 -> 5 * 32 = 160 bits = 20 bytes
-		// maximal size is 15 (due to length of 4 bits)
-		// maximal size: 15 -> 15 * 32 = 480 bits = 60 bytes
+	if b[0]>>4 != DefaultIPv4Version {
+		return ErrIPv4Version
+	}
+
+	headerLength := int(b[0]&0b0000_1111) * 4
+	if headerLength < IPv4HeaderLength {
+		return ErrIPv4HeaderLength
+	}
+	if headerLength > len(b) {
+		return ErrIPv4Truncated
+	}
+
+	totalLength := int(binary.BigEndian.Uint16(b[2:4]))
+	if totalLength < headerLength || totalLength > len(b) {
+		return ErrIPv4TotalLength
+	}
 
-		// 32 bits = 4 bytes
-		payloadStartByte = ihl * 4
+	// the checksum over a header including a correct checksum is zero
+	if onesComplementChecksum(b[:headerLength]) != 0 {
+		return ErrIPv4Checksum
 	}
 
-	// rest of the packet is the Payload
-	ip.Payload = payload[payloadStartByte:]
 	return nil
 }
@@ -0,0 +1,167 @@
+package edurouter_test
+
+import (
+	"encoding/binary"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+)
+
+// testIPv4Fragment is a middle fragment with type of service and a record route option
+func testIPv4Fragment() edurouter.IPv4Pdu {
+	ip := *edurouter.NewIPv4Pdu(net.IP{10, 0, 0, 2}, net.IP{10, 0, 1, 50}, edurouter.IPProtocolUDP, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	ip.TOS = 0xb8
+	ip.Id = 0x4242
+	ip.Flags = edurouter.IPv4FlagMoreFragments
+	ip.FragOffset = 0x1234
+	ip.Options = []byte{7, 7, 4, 0, 0, 0, 0, 0}
+	return ip
+}
+
+func TestIPv4Pdu_RoundTrip(t *testing.T) {
+	ip := testIPv4Fragment()
+
+	b, err := ip.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, b, 36)
+
+	// IHL of 7 words with the options
+	assert.EqualValues(t, 0x47, b[0])
+	assert.EqualValues(t, 0xb8, b[1])
+	assert.EqualValues(t, 36, binary.BigEndian.Uint16(b[2:4]))
+	// more fragments flag and fragment offset share bytes 6 and 7
+	assert.EqualValues(t, 0x3234, binary.BigEndian.Uint16(b[6:8]))
+	assert.NoError(t, edurouter.VerifyIPv4Header(b))
+
+	var decoded edurouter.IPv4Pdu
+	require.NoError(t, (&decoded).UnmarshalBinary(b))
+
+	assert.EqualValues(t, ip.TOS, decoded.TOS)
+	assert.EqualValues(t, 36, decoded.TotalLength)
+	assert.EqualValues(t, ip.Id, decoded.Id)
+	assert.EqualValues(t, ip.Flags, decoded.Flags)
+	assert.EqualValues(t, ip.FragOffset, decoded.FragOffset)
+	assert.EqualValues(t, ip.Options, decoded.Options)
+	assert.EqualValues(t, ip.Payload, decoded.Payload)
+	assert.Equal(t, 28, decoded.HeaderLength())
+
+	again, err := decoded.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, b, again)
+}
+
+func TestIPv4Pdu_Options(t *testing.T) {
+	ip := testIPv4Fragment()
+
+	// options are padded with end of option list
+	ip.Options = []byte{1, 1, 1, 1, 1}
+	b, err := ip.MarshalBinary()
+	require.NoError(t, err)
+	assert.EqualValues(t, 0x47, b[0])
+	assert.Equal(t, []byte{1, 1, 1, 1, 1, 0, 0, 0}, b[20:28])
+
+	ip.Options = make([]byte, 41)
+	_, err = ip.MarshalBinary()
+	assert.ErrorIs(t, err, edurouter.ErrIPv4OptionsTooLong)
+
+	ip.Options = nil
+	ip.Payload = make([]byte, 65535)
+	_, err = ip.MarshalBinary()
+	assert.ErrorIs(t, err, edurouter.ErrIPv4PacketTooLarge)
+}
+
+func TestIPv4Pdu_UnmarshalBinary(t *testing.T) {
+	ip := testIPv4Fragment()
+	b, err := ip.MarshalBinary()
+	require.NoError(t, err)
+
+	// ethernet pads short frames to 46 bytes of payload
+	padded := append(append([]byte{}, b...), make([]byte, 10)...)
+
+	var decoded edurouter.IPv4Pdu
+	require.NoError(t, (&decoded).UnmarshalBinary(padded))
+	assert.EqualValues(t, ip.Payload, decoded.Payload)
+
+	// the quote of an ICMP error ends before TotalLength
+	require.NoError(t, (&decoded).UnmarshalBinary(b[:32]))
+	assert.EqualValues(t, ip.Payload[:4], decoded.Payload)
+	assert.ErrorIs(t, edurouter.VerifyIPv4Header(b[:32]), edurouter.ErrIPv4TotalLength)
+
+	assert.ErrorIs(t, (&decoded).UnmarshalBinary(b[:19]), edurouter.ErrIPv4Truncated)
+	// the options are cut off
+	assert.ErrorIs(t, (&decoded).UnmarshalBinary(b[:24]), edurouter.ErrIPv4Truncated)
+}
+
+func TestVerifyIPv4Header(t *testing.T) {
+	tests := map[string]struct {
+		modify  func(b []byte) []byte
+		wantErr error
+	}{
+		"Valid": {
+			modify: func(b []byte) []byte { return b },
+		},
+		"EthernetPadding": {
+			modify: func(b []byte) []byte { return append(b, make([]byte, 10)...) },
+		},
+		"BadChecksum": {
+			modify: func(b []byte) []byte {
+				b[10] ^= 0xff
+				return b
+			},
+			wantErr: edurouter.ErrIPv4Checksum,
+		},
+		"ChangedTTL": {
+			modify: func(b []byte) []byte {
+				b[8]--
+				return b
+			},
+			wantErr: edurouter.ErrIPv4Checksum,
+		},
+		"WrongVersion": {
+			modify: func(b []byte) []byte {
+				b[0] = 0x67
+				return b
+			},
+			wantErr: edurouter.ErrIPv4Version,
+		},
+		"WrongIHL": {
+			modify: func(b []byte) []byte {
+				b[0] = 0x44
+				return b
+			},
+			wantErr: edurouter.ErrIPv4HeaderLength,
+		},
+		"TruncatedHeader": {
+			modify:  func(b []byte) []byte { return b[:16] },
+			wantErr: edurouter.ErrIPv4Truncated,
+		},
+		"TruncatedOptions": {
+			modify:  func(b []byte) []byte { return b[:24] },
+			wantErr: edurouter.ErrIPv4Truncated,
+		},
+		"TotalLengthShorterThanHeader": {
+			modify: func(b []byte) []byte {
+				binary.BigEndian.PutUint16(b[2:4], 24)
+				return b
+			},
+			wantErr: edurouter.ErrIPv4TotalLength,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ip := testIPv4Fragment()
+			b, err := ip.MarshalBinary()
+			require.NoError(t, err)
+
+			err = edurouter.VerifyIPv4Header(v.modify(b))
+			if v.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, v.wantErr)
+			}
+		})
+	}
+}
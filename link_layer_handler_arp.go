@@ -1,14 +1,16 @@
 package edurouter
 
 import (
+	"bytes"
 	"context"
 	"github.com/mdlayher/ethernet"
-	"github.com/rs/zerolog/log"
+	"net"
 )
 
 type ARPv4LinkLayerHandler struct {
 	supplierCh chan FrameIn
 	publishCh  chan<- *ethernet.Frame
+	routeTable *RouteTable
 }
 
 func (llh *ARPv4LinkLayerHandler) SupplierC() chan<- FrameIn {
@@ -22,6 +24,11 @@ func NewARPv4LinkLayerHandler(publishCh chan<- *ethernet.Frame) *ARPv4LinkLayerH
 	}
 }
 
+// SetRouteTable enables proxy ARP on the interfaces configured for it
+func (llh *ARPv4LinkLayerHandler) SetRouteTable(routeTable *RouteTable) {
+	llh.routeTable = routeTable
+}
+
 func (llh *ARPv4LinkLayerHandler) RunHandler(ctx context.Context) {
 	go llh.runHandler(ctx)
 }
@@ -37,37 +44,112 @@ func (llh *ARPv4LinkLayerHandler) runHandler(ctx context.Context) {
 			// ARP logic
 			err := (&packet).UnmarshalBinary(f.Frame.Payload)
 			if err != nil {
-				log.Error().Msgf("error during arp unmarshall: %v", err)
+				Logger(LogSubsystemARP).Error().Msgf("error during arp unmarshall: %v", err)
+				f.Trace.Record(TraceStageARP, "malformed ARP packet, dropped: %v", err)
 				continue
 			}
 
-			if !packet.IsEthernetAndIPv4() {
+			if !f.Trace.Checkpoint(ctx, TraceStageARP, func() string { return summarizeARP(&packet) }) {
 				continue
 			}
 
-			if packet.IsArpResponse() {
-				err = f.Interface.ArpTable.Store(packet.SrcProtoAddr, packet.SrcHardwareAddr)
-				if err != nil {
-					log.Error().Msgf("error during arp arp table store: %v", err)
-				}
+			if err := packet.ValidateEthernetAndIPv4(); err != nil {
+				f.Trace.Record(TraceStageARP, "not an ethernet and IPv4 ARP packet, dropped: %v", err)
 				continue
 			}
 
-			if packet.IsArpRequestForConfig(f.Interface) {
-				arpResponse := packet.BuildARPResponseWithConfig(f.Interface)
+			if packet.Operation != ARPOperationRequest && packet.Operation != ARPOperationResponse {
+				f.Trace.Record(TraceStageARP, "ARP %s is not handled, dropped", packet.Operation)
+				continue
+			}
 
-				arpBinary, err := arpResponse.MarshalBinary()
-				if err != nil {
+			if f.Interface.acd != nil {
+				if f.Interface.acd.observe(&packet) {
+					f.Trace.Record(TraceStageARP, "%s claims %s, address conflict", net.HardwareAddr(packet.SrcHardwareAddr), f.Interface.Addr.IP)
 					continue
 				}
 
-				llh.publishCh <- &ethernet.Frame{
-					Destination: f.Frame.Source,
-					Source:      *f.Interface.HardwareAddr,
-					EtherType:   ethernet.EtherTypeARP,
-					Payload:     arpBinary,
+				if f.Interface.acd.isProbing() {
+					f.Trace.Record(TraceStageARP, "%s is still being probed, ignored", f.Interface.Addr.IP)
+					continue
 				}
 			}
+
+			if packet.IsArpResponse() {
+				err = f.Interface.ArpTable.StoreReply(packet.SrcProtoAddr, packet.SrcHardwareAddr)
+				if err == ErrUnsolicitedARPReply || err == ErrARPEntryLocked {
+					Logger(LogSubsystemARP).Debug().
+						Str("iface", f.Interface.InterfaceName).
+						Stringer("ip", net.IP(packet.SrcProtoAddr)).
+						Stringer("hw_addr", net.HardwareAddr(packet.SrcHardwareAddr)).
+						Err(err).
+						Msg("reply rejected")
+					f.Trace.Record(TraceStageARP, "reply %s is-at %s rejected by the learning policy: %v", net.IP(packet.SrcProtoAddr), net.HardwareAddr(packet.SrcHardwareAddr), err)
+					continue
+				}
+				if err != nil {
+					Logger(LogSubsystemARP).Error().Msgf("error during arp arp table store: %v", err)
+				}
+				Logger(LogSubsystemARP).Debug().
+					Str("iface", f.Interface.InterfaceName).
+					Stringer("ip", net.IP(packet.SrcProtoAddr)).
+					Stringer("hw_addr", net.HardwareAddr(packet.SrcHardwareAddr)).
+					Msg("reply stored")
+				f.Trace.Record(TraceStageARP, "reply %s is-at %s, stored in ARP table", net.IP(packet.SrcProtoAddr), net.HardwareAddr(packet.SrcHardwareAddr))
+				continue
+			}
+
+			var arpResponse *ARPv4Pdu
+
+			switch {
+			case packet.IsArpRequestForConfig(f.Interface):
+				arpResponse = packet.BuildARPResponseWithConfig(f.Interface)
+			case llh.proxies(&packet, f.Interface):
+				arpResponse = packet.BuildProxyARPResponseWithConfig(f.Interface)
+				f.Trace.Record(TraceStageARP, "who-has %s is reachable through another interface, answered by proxy ARP", net.IP(packet.DstProtoAddr))
+			default:
+				f.Trace.Record(TraceStageARP, "who-has %s does not ask for %s, ignored", net.IP(packet.DstProtoAddr), f.Interface.Addr.IP)
+				continue
+			}
+
+			arpBinary, err := arpResponse.MarshalBinary()
+			if err != nil {
+				continue
+			}
+
+			outFrame := &ethernet.Frame{
+				Destination: f.Frame.Source,
+				Source:      *f.Interface.HardwareAddr,
+				EtherType:   ethernet.EtherTypeARP,
+				Payload:     arpBinary,
+			}
+
+			if !f.Trace.Checkpoint(ctx, TraceStageOutput, func() string { return describeOutFrame(outFrame, f.Interface) }) {
+				continue
+			}
+
+			Logger(LogSubsystemARP).Debug().
+				Str("iface", f.Interface.InterfaceName).
+				Stringer("ip", net.IP(packet.SrcProtoAddr)).
+				Stringer("hw_addr", net.HardwareAddr(packet.SrcHardwareAddr)).
+				Msg("answering request")
+			f.Trace.Record(TraceStageOutput, "replying %s is-at %s to %s on %s", net.IP(arpResponse.SrcProtoAddr), net.HardwareAddr(arpResponse.SrcHardwareAddr), f.Frame.Source, f.Interface.InterfaceName)
+			llh.publishCh <- outFrame
 		}
 	}
 }
+
+// proxies reports whether a request is answered by proxy ARP, because the requested address is reachable through another interface
+func (llh *ARPv4LinkLayerHandler) proxies(packet *ARPv4Pdu, iface *InterfaceConfig) bool {
+	if !iface.ProxyARP || llh.routeTable == nil || !packet.IsArpRequestForIP(packet.DstProtoAddr) {
+		return false
+	}
+
+	if net.IP(packet.SrcProtoAddr).Equal(net.IPv4zero) || bytes.Equal(packet.SrcProtoAddr, packet.DstProtoAddr) {
+		// address probes and announcements are never answered on behalf of others
+		return false
+	}
+
+	ri, err := llh.routeTable.getRouteInfoForIP(packet.DstProtoAddr)
+	return err == nil && ri.OutInterface != iface
+}
@@ -35,7 +35,7 @@ func TestARPv4LinkLayerHandler_HandleARPRequests(t *testing.T) {
 		"ARPRequestSuccessfulResponse": {
 			inputArp: edurouter.ARPv4Pdu{
 				HTYPE:           edurouter.HTYPEEthernet,
-				PTYPE:           ethernet.EtherTypeARP,
+				PTYPE:           ethernet.EtherTypeIPv4,
 				HLEN:            edurouter.HardwareAddrLen,
 				PLEN:            net.IPv4len,
 				Operation:       edurouter.ARPOperationRequest,
@@ -46,7 +46,7 @@ func TestARPv4LinkLayerHandler_HandleARPRequests(t *testing.T) {
 			},
 			wantArpResult: &edurouter.ARPv4Pdu{
 				HTYPE:           edurouter.HTYPEEthernet,
-				PTYPE:           ethernet.EtherTypeARP,
+				PTYPE:           ethernet.EtherTypeIPv4,
 				HLEN:            edurouter.HardwareAddrLen,
 				PLEN:            net.IPv4len,
 				Operation:       edurouter.ARPOperationResponse,
@@ -59,6 +59,20 @@ func TestARPv4LinkLayerHandler_HandleARPRequests(t *testing.T) {
 		"ErrUnsupportedArpProtocol": {
 			inputArp: edurouter.ARPv4Pdu{
 				HTYPE:           2,
+				PTYPE:           ethernet.EtherTypeIPv4,
+				HLEN:            edurouter.HardwareAddrLen,
+				PLEN:            net.IPv4len,
+				Operation:       edurouter.ARPOperationRequest,
+				SrcHardwareAddr: []byte{1, 1, 1, 3, 3, 3},
+				SrcProtoAddr:    []byte{192, 168, 100, 100},
+				DstHardwareAddr: edurouter.EmptyHardwareAddr,
+				DstProtoAddr:    []byte{192, 168, 100, 1},
+			},
+			wantArpResult: nil,
+		},
+		"ProtocolTypeARPRejected": {
+			inputArp: edurouter.ARPv4Pdu{
+				HTYPE:           edurouter.HTYPEEthernet,
 				PTYPE:           ethernet.EtherTypeARP,
 				HLEN:            edurouter.HardwareAddrLen,
 				PLEN:            net.IPv4len,
@@ -70,10 +84,24 @@ func TestARPv4LinkLayerHandler_HandleARPRequests(t *testing.T) {
 			},
 			wantArpResult: nil,
 		},
+		"RARPRequestNotHandled": {
+			inputArp: edurouter.ARPv4Pdu{
+				HTYPE:           edurouter.HTYPEEthernet,
+				PTYPE:           ethernet.EtherTypeIPv4,
+				HLEN:            edurouter.HardwareAddrLen,
+				PLEN:            net.IPv4len,
+				Operation:       edurouter.ARPOperationRARPRequest,
+				SrcHardwareAddr: []byte{1, 1, 1, 3, 3, 3},
+				SrcProtoAddr:    []byte{192, 168, 100, 100},
+				DstHardwareAddr: edurouter.EmptyHardwareAddr,
+				DstProtoAddr:    []byte{192, 168, 100, 1},
+			},
+			wantArpResult: nil,
+		},
 		"ARPRequestNotForInterfaceConfig": {
 			inputArp: edurouter.ARPv4Pdu{
 				HTYPE:           edurouter.HTYPEEthernet,
-				PTYPE:           ethernet.EtherTypeARP,
+				PTYPE:           ethernet.EtherTypeIPv4,
 				HLEN:            edurouter.HardwareAddrLen,
 				PLEN:            net.IPv4len,
 				Operation:       edurouter.ARPOperationRequest,
@@ -142,7 +170,7 @@ func TestARPv4LinkLayerHandler_HandleARPResponse(t *testing.T) {
 	srcHardwareAddr := []byte{1, 1, 1, 3, 3, 3}
 	inputArp := edurouter.ARPv4Pdu{
 		HTYPE:           edurouter.HTYPEEthernet,
-		PTYPE:           ethernet.EtherTypeARP,
+		PTYPE:           ethernet.EtherTypeIPv4,
 		HLEN:            edurouter.HardwareAddrLen,
 		PLEN:            net.IPv4len,
 		Operation:       edurouter.ARPOperationResponse,
@@ -174,3 +202,111 @@ func TestARPv4LinkLayerHandler_HandleARPResponse(t *testing.T) {
 		// no answer expected
 	}
 }
+
+func TestARPv4LinkLayerHandler_ProxyARP(t *testing.T) {
+	publishCh := make(chan *ethernet.Frame, 1)
+	handler := edurouter.NewARPv4LinkLayerHandler(publishCh)
+
+	routeTable := edurouter.NewRouteTable()
+	handler.SetRouteTable(routeTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler.RunHandler(ctx)
+	defer cancel()
+
+	newConfig := func(name string, ip net.IP, hwa net.HardwareAddr) *edurouter.InterfaceConfig {
+		config, err := edurouter.NewInterfaceConfig(name, &net.IPNet{IP: ip, Mask: net.CIDRMask(24, 32)})
+		require.NoError(t, err)
+		config.HardwareAddr = &hwa
+
+		routeTable.MustAddRoute(edurouter.RouteInfo{
+			RouteType:    edurouter.LinkLocalRouteType,
+			DstNet:       net.IPNet{IP: ip.Mask(config.Addr.Mask), Mask: config.Addr.Mask},
+			OutInterface: config,
+		})
+		return config
+	}
+
+	proxyConfig := newConfig("veth0", net.IP{192, 168, 100, 1}, net.HardwareAddr{1, 1, 1, 2, 2, 2})
+	proxyConfig.ProxyARP = true
+	otherConfig := newConfig("veth1", net.IP{192, 168, 200, 1}, net.HardwareAddr{1, 1, 1, 4, 4, 4})
+
+	tests := map[string]struct {
+		config       *edurouter.InterfaceConfig
+		srcProtoAddr []byte
+		dstProtoAddr []byte
+		wantAnswer   bool
+	}{
+		"ReachableThroughOtherInterface": {
+			config:       proxyConfig,
+			srcProtoAddr: []byte{192, 168, 100, 100},
+			dstProtoAddr: []byte{192, 168, 200, 7},
+			wantAnswer:   true,
+		},
+		"OnSameSegment": {
+			config:       proxyConfig,
+			srcProtoAddr: []byte{192, 168, 100, 100},
+			dstProtoAddr: []byte{192, 168, 100, 7},
+		},
+		"NoRoute": {
+			config:       proxyConfig,
+			srcProtoAddr: []byte{192, 168, 100, 100},
+			dstProtoAddr: []byte{10, 0, 0, 7},
+		},
+		"AddressProbe": {
+			config:       proxyConfig,
+			srcProtoAddr: []byte{0, 0, 0, 0},
+			dstProtoAddr: []byte{192, 168, 200, 7},
+		},
+		"ProxyARPDisabled": {
+			config:       otherConfig,
+			srcProtoAddr: []byte{192, 168, 200, 100},
+			dstProtoAddr: []byte{192, 168, 100, 7},
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			request := edurouter.ARPv4Pdu{
+				HTYPE:           edurouter.HTYPEEthernet,
+				PTYPE:           ethernet.EtherTypeIPv4,
+				HLEN:            edurouter.HardwareAddrLen,
+				PLEN:            net.IPv4len,
+				Operation:       edurouter.ARPOperationRequest,
+				SrcHardwareAddr: []byte{1, 1, 1, 3, 3, 3},
+				SrcProtoAddr:    v.srcProtoAddr,
+				DstHardwareAddr: edurouter.EmptyHardwareAddr,
+				DstProtoAddr:    v.dstProtoAddr,
+			}
+
+			arpBinary, err := request.MarshalBinary()
+			require.NoError(t, err)
+
+			handler.SupplierC() <- edurouter.FrameIn{
+				Frame: &ethernet.Frame{
+					Destination: ethernet.Broadcast,
+					Source:      request.SrcHardwareAddr,
+					EtherType:   ethernet.EtherTypeARP,
+					Payload:     arpBinary,
+				},
+				Interface: v.config,
+			}
+
+			outFrame := receiveFrame(publishCh, 50*time.Millisecond)
+			if !v.wantAnswer {
+				assert.Nil(t, outFrame)
+				return
+			}
+			require.NotNil(t, outFrame)
+
+			var response edurouter.ARPv4Pdu
+			require.NoError(t, (&response).UnmarshalBinary(outFrame.Payload))
+
+			assert.EqualValues(t, edurouter.ARPOperationResponse, response.Operation)
+			assert.EqualValues(t, *v.config.HardwareAddr, response.SrcHardwareAddr)
+			assert.EqualValues(t, v.dstProtoAddr, response.SrcProtoAddr)
+			assert.EqualValues(t, request.SrcHardwareAddr, response.DstHardwareAddr)
+			assert.EqualValues(t, v.srcProtoAddr, response.DstProtoAddr)
+		})
+	}
+}
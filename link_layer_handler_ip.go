@@ -3,7 +3,8 @@ package edurouter
 import (
 	"context"
 	"github.com/mdlayher/ethernet"
-	"github.com/rs/zerolog/log"
+	"net"
+	"sync"
 )
 
 type IPv4LinkLayerInputHandler struct {
@@ -14,6 +15,7 @@ type IPv4LinkLayerInputHandler struct {
 type FrameIn struct {
 	Frame     *ethernet.Frame
 	Interface *InterfaceConfig
+	Trace     *PacketTrace
 }
 
 type FrameOut struct {
@@ -43,30 +45,76 @@ func (llh *IPv4LinkLayerInputHandler) runHandler(ctx context.Context) {
 			return
 
 		case f := <-llh.supplierCh:
+			err := VerifyIPv4Header(f.Frame.Payload)
+			if err != nil {
+				Logger(LogSubsystemIPv4).Debug().
+					Str("iface", f.Interface.InterfaceName).
+					Err(err).
+					Msg("invalid ipv4 header, packet dropped")
+				f.Trace.Record(TraceStageIPv4Input, "invalid IPv4 header, dropped: %v", err)
+				continue
+			}
+
 			var ipv4Packet IPv4Pdu
 
-			err := (&ipv4Packet).UnmarshalBinary(f.Frame.Payload)
+			err = (&ipv4Packet).UnmarshalBinary(f.Frame.Payload)
 			if err != nil {
-				log.Error().Msgf("error during arp unmarshall: %v", err)
+				Logger(LogSubsystemIPv4).Error().Msgf("error during ipv4 unmarshall: %v", err)
+				f.Trace.Record(TraceStageIPv4Input, "malformed IPv4 packet, dropped: %v", err)
 				continue
 			}
 
-			err = f.Interface.ArpTable.Store(ipv4Packet.SrcIP, f.Frame.Source)
-			if err != nil {
-				log.Error().Msgf("error during arp table store: %v", err)
+			f.Trace.Record(TraceStageIPv4Input, "IPv4 %s > %s, %s, ttl %d", ipv4Packet.SrcIP, ipv4Packet.DstIP, ipProtocolName(ipv4Packet.Protocol), ipv4Packet.TTL)
+			Logger(LogSubsystemIPv4).Debug().
+				Str("iface", f.Interface.InterfaceName).
+				Stringer("src", ipv4Packet.SrcIP).
+				Stringer("dst", ipv4Packet.DstIP).
+				Str("protocol", ipProtocolName(ipv4Packet.Protocol)).
+				Uint8("ttl", ipv4Packet.TTL).
+				Msg("packet received")
+
+			if !f.Trace.Checkpoint(ctx, TraceStageIPv4Input, func() string { return describeIPv4(&ipv4Packet) }) {
+				continue
+			}
+
+			err = f.Interface.ArpTable.StoreFromIPv4(ipv4Packet.SrcIP, f.Frame.Source)
+			if err == ErrARPEntryLocked {
+				f.Trace.Record(TraceStageIPv4Input, "source %s does not match the static ARP entry of %s", f.Frame.Source, ipv4Packet.SrcIP)
+			} else if err != nil && err != ErrARPLearningDisabled {
+				Logger(LogSubsystemARP).Error().Msgf("error during arp table store: %v", err)
 			}
 
 			llh.publishCh <- &InternetV4PacketIn{
 				Packet:   &ipv4Packet,
 				Ifconfig: f.Interface,
+				Trace:    f.Trace,
 			}
 		}
 	}
 }
 
+// HostUnreachableFunc is called for every packet which is dropped because its next hop could not be resolved
+type HostUnreachableFunc func(pdu *InternetV4PacketOut, err error)
+
 type IPv4LinkLayerOutputHandler struct {
-	supplierCh chan *InternetV4PacketOut
-	publishCh  chan<- *ethernet.Frame
+	supplierCh      chan *InternetV4PacketOut
+	publishCh       chan<- *ethernet.Frame
+	hostUnreachable HostUnreachableFunc
+
+	// resolved holds the packets whose next hop was resolved since the handler last sent them.
+	// The ARP table calls back while storing an entry, so the callback must never wait for the handler.
+	resolved       []*resolvedPacketOut
+	resolvedMu     sync.Mutex
+	resolvedSignal chan struct{}
+}
+
+// resolvedPacketOut is a packet whose next hop was resolved, or failed to resolve
+type resolvedPacketOut struct {
+	pdu      *InternetV4PacketOut
+	outFrame *ethernet.Frame
+	nextHop  net.IP
+	hwAddr   net.HardwareAddr
+	err      error
 }
 
 func (h *IPv4LinkLayerOutputHandler) SupplierC() chan *InternetV4PacketOut {
@@ -75,11 +123,17 @@ func (h *IPv4LinkLayerOutputHandler) SupplierC() chan *InternetV4PacketOut {
 
 func NewIPv4LinkLayerOutputHandler(publishCh chan<- *ethernet.Frame) *IPv4LinkLayerOutputHandler {
 	return &IPv4LinkLayerOutputHandler{
-		supplierCh: make(chan *InternetV4PacketOut, 128),
-		publishCh:  publishCh,
+		supplierCh:     make(chan *InternetV4PacketOut, 128),
+		publishCh:      publishCh,
+		resolvedSignal: make(chan struct{}, 1),
 	}
 }
 
+// SetHostUnreachableHandler is called for packets dropped after ARP resolution failed
+func (h *IPv4LinkLayerOutputHandler) SetHostUnreachableHandler(f HostUnreachableFunc) {
+	h.hostUnreachable = f
+}
+
 func (h *IPv4LinkLayerOutputHandler) RunHandler(ctx context.Context) {
 	go h.runHandler(ctx)
 }
@@ -93,7 +147,7 @@ func (h *IPv4LinkLayerOutputHandler) runHandler(ctx context.Context) {
 		case pdu := <-h.supplierCh:
 			framePayload, err := pdu.Packet.MarshalBinary()
 			if err != nil {
-				log.Error().Msgf("error during ipv4 marshall: %v", err)
+				Logger(LogSubsystemIPv4).Error().Msgf("error during ipv4 marshall: %v", err)
 				continue
 			}
 
@@ -103,13 +157,73 @@ func (h *IPv4LinkLayerOutputHandler) runHandler(ctx context.Context) {
 				Payload:   framePayload,
 			}
 
-			if pdu.RouteInfo.RouteType == LinkLocalRouteType {
-				outFrame.Destination, err = pdu.RouteInfo.OutInterface.ArpTable.Resolve(pdu.Packet.DstIP)
-			} else {
-				outFrame.Destination, err = pdu.RouteInfo.OutInterface.ArpTable.Resolve(*pdu.RouteInfo.NextHop)
+			nextHop := pdu.Packet.DstIP
+			if pdu.RouteInfo.RouteType != LinkLocalRouteType {
+				nextHop = *pdu.RouteInfo.NextHop
+			}
+
+			// unresolved packets wait in the ARP table, so they do not stall packets to other next hops
+			hwAddr, queued, err := pdu.RouteInfo.OutInterface.ArpTable.ResolveAsync(nextHop, func(hwAddr net.HardwareAddr, err error) {
+				h.queueResolved(&resolvedPacketOut{pdu: pdu, outFrame: outFrame, nextHop: nextHop, hwAddr: hwAddr, err: err})
+			})
+			if queued {
+				pdu.Trace.Record(TraceStageResolve, "resolving %s, packet queued", nextHop)
+				continue
 			}
 
-			h.publishCh <- outFrame
+			h.send(ctx, &resolvedPacketOut{pdu: pdu, outFrame: outFrame, nextHop: nextHop, hwAddr: hwAddr, err: err})
+
+		case <-h.resolvedSignal:
+			h.resolvedMu.Lock()
+			resolved := h.resolved
+			h.resolved = nil
+			h.resolvedMu.Unlock()
+
+			for _, r := range resolved {
+				h.send(ctx, r)
+			}
 		}
 	}
 }
+
+// queueResolved hands a resolved packet to the handler goroutine without blocking the caller
+func (h *IPv4LinkLayerOutputHandler) queueResolved(r *resolvedPacketOut) {
+	h.resolvedMu.Lock()
+	h.resolved = append(h.resolved, r)
+	h.resolvedMu.Unlock()
+
+	select {
+	case h.resolvedSignal <- struct{}{}:
+	default:
+		// the handler was signalled already and takes this packet too
+	}
+}
+
+func (h *IPv4LinkLayerOutputHandler) send(ctx context.Context, r *resolvedPacketOut) {
+	if r.err != nil {
+		Logger(LogSubsystemARP).Debug().Stringer("ip", r.nextHop).Err(r.err).Msg("resolving next hop failed")
+		r.pdu.Trace.Record(TraceStageResolve, "resolving %s failed, dropped: %v", r.nextHop, r.err)
+
+		if h.hostUnreachable != nil {
+			h.hostUnreachable(r.pdu, r.err)
+		}
+		return
+	}
+
+	r.outFrame.Destination = r.hwAddr
+	r.pdu.Trace.Record(TraceStageResolve, "%s is at %s", r.nextHop, r.hwAddr)
+
+	outIface := r.pdu.RouteInfo.OutInterface
+	if !r.pdu.Trace.Checkpoint(ctx, TraceStageOutput, func() string { return describeOutFrame(r.outFrame, outIface) }) {
+		return
+	}
+
+	r.pdu.Trace.Record(TraceStageOutput, "sending %s > %s on %s", r.outFrame.Source, r.outFrame.Destination, outIface.InterfaceName)
+	Logger(LogSubsystemIPv4).Debug().
+		Str("iface", outIface.InterfaceName).
+		Stringer("dst", r.pdu.Packet.DstIP).
+		Stringer("next_hop", r.nextHop).
+		Stringer("hw_addr", r.outFrame.Destination).
+		Msg("packet sent")
+	h.publishCh <- r.outFrame
+}
@@ -6,9 +6,12 @@ import (
 	"github.com/davidkroell/edurouter/internal/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestIPv4LinkLayerHandler_HandleICMPRequest(t *testing.T) {
@@ -80,3 +83,243 @@ func TestIPv4LinkLayerHandler_HandleICMPRequest(t *testing.T) {
 	//
 	//assert.EqualValues(t, *wantIPResult, actualIPResult)
 }
+
+func TestIPv4LinkLayerOutputHandler_ResolveAsync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctrl := gomock.NewController(t)
+	mockArpWriter := mocks.NewMockARPWriter(ctrl)
+
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	hwAddr := net.HardwareAddr{1, 1, 1, 2, 2, 2}
+	config.HardwareAddr = &hwAddr
+	config.ArpTable = edurouter.NewARPv4Table(config, mockArpWriter)
+
+	timeouts := edurouter.DefaultARPTimeouts
+	timeouts.RetransTime = 50 * time.Millisecond
+	timeouts.MaxProbes = 3
+	config.ArpTable.SetTimeouts(timeouts)
+
+	publishCh := make(chan *ethernet.Frame, 8)
+	handler := edurouter.NewIPv4LinkLayerOutputHandler(publishCh)
+
+	unreachable := make(chan *edurouter.InternetV4PacketOut, 1)
+	handler.SetHostUnreachableHandler(func(pdu *edurouter.InternetV4PacketOut, err error) {
+		assert.ErrorIs(t, err, edurouter.ErrARPTimeout)
+		unreachable <- pdu
+	})
+	handler.RunHandler(ctx)
+
+	routeInfo := &edurouter.RouteInfo{
+		RouteType:    edurouter.LinkLocalRouteType,
+		DstNet:       net.IPNet{IP: net.IP{192, 168, 100, 0}, Mask: net.CIDRMask(24, 32)},
+		OutInterface: config,
+	}
+
+	send := func(dstIP net.IP) *edurouter.InternetV4PacketOut {
+		pdu := &edurouter.InternetV4PacketOut{
+			Packet:    edurouter.NewIPv4Pdu(config.Addr.IP, dstIP, edurouter.IPProtocolUDP, []byte{1, 2, 3, 4}),
+			RouteInfo: routeInfo,
+		}
+		handler.SupplierC() <- pdu
+		return pdu
+	}
+
+	silentIP := net.IP{192, 168, 100, 98}
+	lateIP := net.IP{192, 168, 100, 99}
+	knownIP := net.IP{192, 168, 100, 100}
+	lateHwAddr := net.HardwareAddr{1, 1, 1, 4, 4, 4}
+	knownHwAddr := net.HardwareAddr{1, 1, 1, 3, 3, 3}
+
+	require.NoError(t, config.ArpTable.Store(knownIP, knownHwAddr))
+
+	mockArpWriter.EXPECT().SendArpRequest(silentIP).Return(nil).Times(timeouts.MaxProbes)
+	lateRequest := make(chan struct{})
+	var lateOnce sync.Once
+	mockArpWriter.EXPECT().SendArpRequest(lateIP).DoAndReturn(func(ip net.IP) error {
+		lateOnce.Do(func() { close(lateRequest) })
+		return nil
+	}).MinTimes(1)
+
+	unreachablePdu := send(silentIP)
+	send(lateIP)
+	send(lateIP)
+	send(knownIP)
+
+	// packets to unresolved next hops do not delay others
+	f := receiveFrame(publishCh, time.Second)
+	require.NotNil(t, f)
+	assert.EqualValues(t, knownHwAddr, f.Destination)
+
+	<-lateRequest
+	require.NoError(t, config.ArpTable.Store(lateIP, lateHwAddr))
+
+	for i := 0; i < 2; i++ {
+		f = receiveFrame(publishCh, time.Second)
+		require.NotNil(t, f)
+		assert.EqualValues(t, lateHwAddr, f.Destination)
+	}
+
+	select {
+	case pdu := <-unreachable:
+		assert.Same(t, unreachablePdu, pdu)
+	case <-time.After(time.Second):
+		t.Fatal("host unreachable handler not called")
+	}
+
+	// no frame without a destination is sent
+	assert.Nil(t, receiveFrame(publishCh, 50*time.Millisecond))
+}
+
+func TestIPv4LinkLayerInputHandler_Forwarding(t *testing.T) {
+	tests := map[string]struct {
+		corrupt     bool
+		wantForward bool
+	}{
+		"Lossless": {
+			wantForward: true,
+		},
+		"BadChecksumDropped": {
+			corrupt: true,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ip := testIPv4Fragment()
+			s := newTwoSegmentSetup(t, ctx, ip.DstIP)
+
+			sent, err := ip.MarshalBinary()
+			require.NoError(t, err)
+			if v.corrupt {
+				sent[10] ^= 0xff
+			}
+
+			writeFrame(t, s.host, &ethernet.Frame{
+				Destination: *s.router.interfaces[0].HardwareAddr,
+				Source:      s.host.HardwareAddr(),
+				EtherType:   ethernet.EtherTypeIPv4,
+				Payload:     sent,
+			})
+
+			f := receiveFrame(s.receiverFrames, 200*time.Millisecond)
+			if !v.wantForward {
+				assert.Nil(t, f, "packet with bad checksum forwarded")
+				return
+			}
+
+			require.NotNil(t, f, "packet not forwarded")
+			assert.NoError(t, edurouter.VerifyIPv4Header(f.Payload))
+
+			// the frame is padded to the ethernet minimum
+			require.GreaterOrEqual(t, len(f.Payload), len(sent))
+			f.Payload = f.Payload[:len(sent)]
+
+			// only the TTL, the checksum and the record route option change on the way
+			assert.Equal(t, sent[8]-1, f.Payload[8])
+			assert.Equal(t, sent[:8], f.Payload[:8])
+			assert.Equal(t, sent[9], f.Payload[9])
+			assert.Equal(t, sent[12:20], f.Payload[12:20])
+			assert.Equal(t, []byte{7, 7, 8, 10, 0, 1, 1, 0}, f.Payload[20:28])
+			assert.Equal(t, sent[28:], f.Payload[28:])
+		})
+	}
+}
+
+func TestIPv4LinkLayerInputHandler_OddLengthEchoRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newICMPErrorSetup(t, ctx)
+
+	// the 9 bytes of ICMP are padded to the ethernet minimum on the wire
+	icmpRequest := edurouter.ICMPPacket{
+		IcmpType: edurouter.IcmpTypeEchoRequest,
+		Id:       1,
+		Seq:      1,
+		Data:     []byte{0x42},
+	}
+	icmpBinary, err := icmpRequest.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, icmpBinary, 9)
+
+	s.sendPdu(t, edurouter.NewIPv4Pdu(s.hostIP, s.router.interfaces[0].Addr.IP, edurouter.IPProtocolICMPv4, icmpBinary))
+
+	reply := nextIPv4(s.hostFrames, time.Second)
+	require.NotNil(t, reply, "no echo reply received")
+
+	var icmpReply edurouter.ICMPPacket
+	require.NoError(t, (&icmpReply).UnmarshalBinary(reply.Payload))
+	assert.Equal(t, edurouter.IcmpTypeEchoReply, icmpReply.IcmpType)
+	assert.EqualValues(t, []byte{0x42}, icmpReply.Data)
+}
+
+func TestIPv4LinkLayerOutputHandler_ResolvedDoesNotBlockStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctrl := gomock.NewController(t)
+	mockArpWriter := mocks.NewMockARPWriter(ctrl)
+	mockArpWriter.EXPECT().SendArpRequest(gomock.Any()).Return(nil).AnyTimes()
+
+	config, err := edurouter.NewInterfaceConfig("veth0", &net.IPNet{
+		IP:   []byte{192, 168, 100, 1},
+		Mask: net.CIDRMask(24, 32),
+	})
+	require.NoError(t, err)
+
+	hwAddr := net.HardwareAddr{1, 1, 1, 2, 2, 2}
+	config.HardwareAddr = &hwAddr
+	config.ArpTable = edurouter.NewARPv4Table(config, mockArpWriter)
+
+	// nobody reads the frames, so the handler blocks on the first resolved packet
+	publishCh := make(chan *ethernet.Frame)
+	handler := edurouter.NewIPv4LinkLayerOutputHandler(publishCh)
+	handler.RunHandler(ctx)
+
+	routeInfo := &edurouter.RouteInfo{
+		RouteType:    edurouter.LinkLocalRouteType,
+		DstNet:       net.IPNet{IP: net.IP{192, 168, 100, 0}, Mask: net.CIDRMask(24, 32)},
+		OutInterface: config,
+	}
+
+	// more next hops than any channel between the handlers buffers
+	const nextHops = 200
+	for i := 0; i < nextHops; i++ {
+		handler.SupplierC() <- &edurouter.InternetV4PacketOut{
+			Packet:    edurouter.NewIPv4Pdu(config.Addr.IP, net.IP{192, 168, byte(101 + i/250), byte(1 + i%250)}, edurouter.IPProtocolUDP, []byte{1, 2, 3, 4}),
+			RouteInfo: routeInfo,
+		}
+	}
+
+	// wait until all packets are queued in the ARP table
+	assert.Eventually(t, func() bool { return len(config.ArpTable.Entries()) == nextHops }, time.Second, 10*time.Millisecond)
+
+	stored := make(chan struct{})
+	go func() {
+		defer close(stored)
+		for i := 0; i < nextHops; i++ {
+			assert.NoError(t, config.ArpTable.Store(net.IP{192, 168, byte(101 + i/250), byte(1 + i%250)}, net.HardwareAddr{1, 1, 1, 3, 3, byte(i)}))
+		}
+	}()
+
+	select {
+	case <-stored:
+	case <-time.After(time.Second):
+		t.Fatal("storing ARP entries blocked on the output handler")
+	}
+
+	// all packets are sent once the frames are read
+	for i := 0; i < nextHops; i++ {
+		require.NotNil(t, receiveFrame(publishCh, time.Second))
+	}
+}
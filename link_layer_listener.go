@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"context"
 	"github.com/mdlayher/ethernet"
-	"github.com/rs/zerolog/log"
 	"net"
+	"sync"
 )
 
 type handler interface {
@@ -18,9 +18,16 @@ type LinkLayerListener struct {
 	toInterfaceChannel chan *ethernet.Frame
 	handlers           []handler
 	routeTable         *RouteTable
+	internet           *Internetv4LayerHandler
 	icmp               *IcmpHandler
+	loopback           *Loopback
 	fromInterfaceCh    chan FrameIn
+	observers          *frameObservers
+	captures           []*Capture
+	tracer             *Tracer
+	stepper            *Stepper
 	ctx                context.Context
+	mu                 sync.RWMutex
 }
 
 func NewLinkLayerListener(interfaces ...*InterfaceConfig) *LinkLayerListener {
@@ -29,10 +36,17 @@ func NewLinkLayerListener(interfaces ...*InterfaceConfig) *LinkLayerListener {
 	toInterfaceCh := make(chan *ethernet.Frame, 128)
 
 	arpHandler := NewARPv4LinkLayerHandler(toInterfaceCh)
+	arpHandler.SetRouteTable(routeTable)
 
 	ipv4OutputHandler := NewIPv4LinkLayerOutputHandler(toInterfaceCh)
 
 	internetLayerHandler := NewInternetLayerHandler(ipv4OutputHandler.SupplierC(), routeTable)
+	ipv4OutputHandler.SetHostUnreachableHandler(internetLayerHandler.HostUnreachable)
+
+	stepper := NewStepper()
+	tracer := NewTracer(DefaultTracerCapacity)
+	tracer.SetStepper(stepper)
+	internetLayerHandler.SetTracer(tracer)
 
 	icmp := NewIcmpHandler(internetLayerHandler.SupplierLocalC())
 	internetLayerStrategy := NewInternetLayerStrategy(icmp)
@@ -40,11 +54,20 @@ func NewLinkLayerListener(interfaces ...*InterfaceConfig) *LinkLayerListener {
 
 	ipv4InputHandler := NewIPv4LinkLayerInputHandler(internetLayerHandler.SupplierC())
 
-	return &LinkLayerListener{
+	loopback := NewLoopback()
+	internetLayerHandler.SetLoopback(loopback)
+
+	l := &LinkLayerListener{
 		routeTable:         routeTable,
+		internet:           internetLayerHandler,
 		icmp:               icmp,
+		loopback:           loopback,
 		interfaces:         interfaces,
 		toInterfaceChannel: toInterfaceCh,
+		fromInterfaceCh:    make(chan FrameIn),
+		observers:          newFrameObservers(),
+		tracer:             tracer,
+		stepper:            stepper,
 		strategy: NewLinkLayerStrategy(map[ethernet.EtherType]LinkLayerHandler{
 			ethernet.EtherTypeARP:  arpHandler,
 			ethernet.EtherTypeIPv4: ipv4InputHandler,
@@ -61,18 +84,77 @@ func NewLinkLayerListener(interfaces ...*InterfaceConfig) *LinkLayerListener {
 			arpHandler,
 		},
 	}
+
+	internetLayerHandler.SetInterfaces(l.Interfaces)
+	return l
 }
 
 func (l *LinkLayerListener) RouteTable() *RouteTable {
 	return l.routeTable
 }
 
-func (l *LinkLayerListener) IcmpPing(ip net.IP, numPings uint16) {
-	l.icmp.Ping(ip, numPings)
+// Loopback is the emulated loopback interface, owning 127.0.0.0/8 and the router-id addresses
+func (l *LinkLayerListener) Loopback() *Loopback {
+	return l.loopback
+}
+
+// Tracer keeps the journeys of the most recent frames through the router
+func (l *LinkLayerListener) Tracer() *Tracer {
+	return l.tracer
+}
+
+// Stepper pauses packets at the handler boundaries while step mode is enabled
+func (l *LinkLayerListener) Stepper() *Stepper {
+	return l.stepper
+}
+
+// SetICMPRateLimit limits the ICMP error messages sent about dropped packets, see Internetv4LayerHandler.SetICMPRateLimit
+func (l *LinkLayerListener) SetICMPRateLimit(limit ICMPRateLimit) error {
+	return l.internet.SetICMPRateLimit(limit)
+}
+
+// SetSourceRoutePolicy decides whether packets with source route options are accepted, see Internetv4LayerHandler.SetSourceRoutePolicy
+func (l *LinkLayerListener) SetSourceRoutePolicy(p SourceRoutePolicy) {
+	l.internet.SetSourceRoutePolicy(p)
+}
+
+func (l *LinkLayerListener) SourceRoutePolicy() SourceRoutePolicy {
+	return l.internet.SourceRoutePolicy()
+}
+
+// Ping sends echo requests to ip, see IcmpHandler.Ping
+func (l *LinkLayerListener) Ping(ctx context.Context, ip net.IP, opts PingOptions, replyFn func(PingReply)) (PingStatistics, error) {
+	return l.icmp.Ping(ctx, ip, opts, replyFn)
+}
+
+// Traceroute probes the path to ip, see IcmpHandler.Traceroute
+func (l *LinkLayerListener) Traceroute(ctx context.Context, ip net.IP, opts TracerouteOptions, hopDone func(TracerouteHop)) ([]TracerouteHop, error) {
+	return l.icmp.Traceroute(ctx, ip, opts, hopDone)
 }
 
-func (l *LinkLayerListener) AddInterface(iface *InterfaceConfig) {
-	iface.SetupAndListen(l.ctx, l.strategy.GetSupportedEtherTypes(), l.fromInterfaceCh)
+func (l *LinkLayerListener) AddInterface(iface *InterfaceConfig) error {
+	iface.frameObserver = l.observers
+	iface.tracer = l.tracer
+
+	ctx, cancel := context.WithCancel(l.ctx)
+	iface.stop = cancel
+
+	err := iface.SetupAndListen(ctx, l.strategy.GetSupportedEtherTypes(), l.fromInterfaceCh)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	if iface.acd != nil {
+		// the address is not used before probing found no other host owning it
+		err = iface.acd.probe(ctx)
+		if err != nil {
+			cancel()
+			return err
+		}
+
+		go iface.acd.announce(ctx)
+	}
 
 	l.routeTable.MustAddRoute(RouteInfo{
 		RouteType: LinkLocalRouteType,
@@ -83,31 +165,41 @@ func (l *LinkLayerListener) AddInterface(iface *InterfaceConfig) {
 		OutInterface: iface,
 	})
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.interfaces = append(l.interfaces, iface)
+
+	Logger(LogSubsystemIface).Info().
+		Str("iface", iface.InterfaceName).
+		Stringer("addr", iface.Addr).
+		Stringer("hw_addr", iface.HardwareAddr).
+		Msg("interface added")
+	return nil
 }
 
 func (l *LinkLayerListener) ListenAndServe(ctx context.Context) {
 	l.ctx = ctx
 
-	l.fromInterfaceCh = make(chan FrameIn)
-	supportedEtherTypes := l.strategy.GetSupportedEtherTypes()
-
 	for _, h := range l.handlers {
 		h.RunHandler(ctx)
 	}
 
-	for _, iface := range l.interfaces {
-		iface.SetupAndListen(ctx, supportedEtherTypes, l.fromInterfaceCh)
-
-		l.routeTable.MustAddRoute(RouteInfo{
-			RouteType: LinkLocalRouteType,
-			DstNet: net.IPNet{
-				IP:   iface.Addr.IP.Mask(iface.Addr.Mask),
-				Mask: iface.Addr.Mask,
-			},
-			OutInterface: iface,
-		})
-	}
+	// interfaces passed to the constructor are set up now, failing ones are left out.
+	// Probing for address conflicts needs the frames read below, so they are set up concurrently.
+	l.mu.Lock()
+	initialInterfaces := l.interfaces
+	l.interfaces = nil
+	l.mu.Unlock()
+
+	go func() {
+		for _, iface := range initialInterfaces {
+			err := l.AddInterface(iface)
+			if err != nil {
+				Logger(LogSubsystemIface).Error().Msgf("failed to set up interface %s: %v", iface.InterfaceName, err)
+			}
+		}
+	}()
 
 	// read frames from supplier channel
 	for {
@@ -117,10 +209,17 @@ func (l *LinkLayerListener) ListenAndServe(ctx context.Context) {
 		case f := <-l.fromInterfaceCh:
 			handler, err := l.strategy.GetHandler(f.Frame.EtherType)
 			if err != nil {
-				log.Error().Msgf("error during strategy GetHandler: %v", err)
+				Logger(LogSubsystemIface).Error().Msgf("error during strategy GetHandler: %v", err)
+				f.Trace.Record(TraceStageLinkLayer, "no handler for ethertype %s, dropped", etherTypeName(f.Frame.EtherType))
 				continue
 			}
 
+			f.Trace.Record(TraceStageLinkLayer, "dispatched to the %s handler", etherTypeName(f.Frame.EtherType))
+			Logger(LogSubsystemIface).Debug().
+				Str("iface", f.Interface.InterfaceName).
+				Str("ether_type", etherTypeName(f.Frame.EtherType)).
+				Msg("frame dispatched")
+
 			handler.SupplierC() <- f
 			if err == ErrDropPdu || err != nil {
 				continue
@@ -128,7 +227,7 @@ func (l *LinkLayerListener) ListenAndServe(ctx context.Context) {
 		case frame := <-l.toInterfaceChannel:
 			var err error
 
-			for _, iface := range l.interfaces {
+			for _, iface := range l.Interfaces() {
 				if bytes.Equal(*iface.HardwareAddr, frame.Source) {
 					err = iface.WriteFrame(frame)
 					break
@@ -136,7 +235,7 @@ func (l *LinkLayerListener) ListenAndServe(ctx context.Context) {
 			}
 
 			if err != nil {
-				log.Error().Msgf("error writing ethernet frame: %v", err)
+				Logger(LogSubsystemIface).Error().Msgf("error writing ethernet frame: %v", err)
 				continue
 			}
 		}
@@ -144,5 +243,94 @@ func (l *LinkLayerListener) ListenAndServe(ctx context.Context) {
 }
 
 func (l *LinkLayerListener) Interfaces() []*InterfaceConfig {
-	return l.interfaces
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	interfaces := make([]*InterfaceConfig, len(l.interfaces))
+	copy(interfaces, l.interfaces)
+	return interfaces
+}
+
+// AddFrameObserver registers an observer for all frames entering and leaving the router.
+// The returned id is used to remove the observer again.
+func (l *LinkLayerListener) AddFrameObserver(observer FrameObserver) uint64 {
+	return l.observers.add(observer)
+}
+
+func (l *LinkLayerListener) RemoveFrameObserver(id uint64) {
+	l.observers.remove(id)
+}
+
+// StartCapture writes all frames of the given interface into a pcapng file at path.
+// An empty interfaceName captures the frames of all interfaces.
+func (l *LinkLayerListener) StartCapture(interfaceName, path string) (*Capture, error) {
+	if interfaceName != "" && l.interfaceByName(interfaceName) == nil {
+		return nil, ErrUnknownInterface
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, c := range l.captures {
+		if c.Path == path {
+			return nil, ErrCaptureAlreadyRunning
+		}
+	}
+
+	c, err := NewCapture(interfaceName, path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.observerID = l.observers.add(c)
+	l.captures = append(l.captures, c)
+	return c, nil
+}
+
+// StopCapture stops the capture writing to path. An empty path stops all captures.
+func (l *LinkLayerListener) StopCapture(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var stopped bool
+	var err error
+
+	captures := l.captures[:0]
+	for _, c := range l.captures {
+		if path != "" && c.Path != path {
+			captures = append(captures, c)
+			continue
+		}
+
+		// no frames are delivered to the capture after the observer is removed
+		l.observers.remove(c.observerID)
+		if stopErr := c.Stop(); stopErr != nil {
+			err = stopErr
+		}
+		stopped = true
+	}
+	l.captures = captures
+
+	if !stopped {
+		return ErrNoSuchCapture
+	}
+	return err
+}
+
+func (l *LinkLayerListener) Captures() []*Capture {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	captures := make([]*Capture, len(l.captures))
+	copy(captures, l.captures)
+	return captures
+}
+
+func (l *LinkLayerListener) interfaceByName(name string) *InterfaceConfig {
+	for _, iface := range l.Interfaces() {
+		if iface.InterfaceName == name {
+			return iface
+		}
+	}
+	return nil
 }
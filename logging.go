@@ -0,0 +1,142 @@
+package edurouter
+
+import (
+	"github.com/rs/zerolog"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// LogSubsystem is a part of the router with its own log level
+type LogSubsystem string
+
+const (
+	LogSubsystemARP   LogSubsystem = "arp"
+	LogSubsystemIPv4  LogSubsystem = "ipv4"
+	LogSubsystemICMP  LogSubsystem = "icmp"
+	LogSubsystemRoute LogSubsystem = "route"
+	LogSubsystemIface LogSubsystem = "iface"
+)
+
+// LogSubsystems lists all subsystems in a stable order
+var LogSubsystems = []LogSubsystem{
+	LogSubsystemARP,
+	LogSubsystemIPv4,
+	LogSubsystemICMP,
+	LogSubsystemRoute,
+	LogSubsystemIface,
+}
+
+// logConfig is the configuration all subsystem loggers are built from
+type logConfig struct {
+	output io.Writer
+	json   bool
+	levels map[LogSubsystem]zerolog.Level
+}
+
+var (
+	logConfigMu sync.Mutex
+	currentLog  = logConfig{
+		output: os.Stderr,
+		levels: map[LogSubsystem]zerolog.Level{},
+	}
+
+	// loggers are rebuilt on every configuration change, so logging itself needs no lock
+	loggers atomic.Pointer[map[LogSubsystem]*zerolog.Logger]
+)
+
+func init() {
+	for _, s := range LogSubsystems {
+		currentLog.levels[s] = zerolog.ErrorLevel
+	}
+	rebuildLoggers()
+}
+
+// rebuildLoggers must be called with logConfigMu held, or during init
+func rebuildLoggers() {
+	var w io.Writer = currentLog.output
+	if !currentLog.json {
+		w = zerolog.ConsoleWriter{
+			Out:     currentLog.output,
+			NoColor: currentLog.output != os.Stdout && currentLog.output != os.Stderr,
+		}
+	}
+
+	base := zerolog.New(w).With().Timestamp().Logger()
+
+	m := make(map[LogSubsystem]*zerolog.Logger, len(LogSubsystems))
+	for _, s := range LogSubsystems {
+		l := base.With().Str("subsystem", string(s)).Logger().Level(currentLog.levels[s])
+		m[s] = &l
+	}
+
+	loggers.Store(&m)
+}
+
+// Logger returns the logger of a subsystem
+func Logger(s LogSubsystem) *zerolog.Logger {
+	l, ok := (*loggers.Load())[s]
+	if !ok {
+		disabled := zerolog.Nop()
+		return &disabled
+	}
+	return l
+}
+
+// SetLogOutput writes the log of all subsystems to w, as JSON lines or in a human readable format
+func SetLogOutput(w io.Writer, json bool) {
+	logConfigMu.Lock()
+	defer logConfigMu.Unlock()
+
+	currentLog.output = w
+	currentLog.json = json
+	rebuildLoggers()
+}
+
+// SetLogLevel sets the level of a single subsystem
+func SetLogLevel(s LogSubsystem, level zerolog.Level) error {
+	logConfigMu.Lock()
+	defer logConfigMu.Unlock()
+
+	if _, ok := currentLog.levels[s]; !ok {
+		return ErrUnknownLogSubsystem
+	}
+
+	currentLog.levels[s] = level
+	rebuildLoggers()
+	return nil
+}
+
+// SetAllLogLevels sets the level of all subsystems
+func SetAllLogLevels(level zerolog.Level) {
+	logConfigMu.Lock()
+	defer logConfigMu.Unlock()
+
+	for s := range currentLog.levels {
+		currentLog.levels[s] = level
+	}
+	rebuildLoggers()
+}
+
+// LogLevels returns the current level of every subsystem
+func LogLevels() map[LogSubsystem]zerolog.Level {
+	logConfigMu.Lock()
+	defer logConfigMu.Unlock()
+
+	levels := make(map[LogSubsystem]zerolog.Level, len(currentLog.levels))
+	for s, l := range currentLog.levels {
+		levels[s] = l
+	}
+	return levels
+}
+
+// ParseLogSubsystem returns the subsystem with the given name
+func ParseLogSubsystem(name string) (LogSubsystem, error) {
+	for _, s := range LogSubsystems {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", ErrUnknownLogSubsystem
+}
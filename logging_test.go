@@ -0,0 +1,89 @@
+package edurouter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/davidkroell/edurouter"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer is written by the handler goroutines and read by the test
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func captureLog(t *testing.T) *lockedBuffer {
+	var buf lockedBuffer
+	edurouter.SetLogOutput(&buf, true)
+
+	levels := edurouter.LogLevels()
+	t.Cleanup(func() {
+		edurouter.SetLogOutput(os.Stderr, false)
+		for s, l := range levels {
+			_ = edurouter.SetLogLevel(s, l)
+		}
+	})
+
+	return &buf
+}
+
+func TestLogging_SubsystemLevels(t *testing.T) {
+	buf := captureLog(t)
+
+	edurouter.SetAllLogLevels(zerolog.ErrorLevel)
+	require.NoError(t, edurouter.SetLogLevel(edurouter.LogSubsystemARP, zerolog.DebugLevel))
+	assert.ErrorIs(t, edurouter.SetLogLevel("foo", zerolog.DebugLevel), edurouter.ErrUnknownLogSubsystem)
+
+	assert.Equal(t, zerolog.DebugLevel, edurouter.LogLevels()[edurouter.LogSubsystemARP])
+	assert.Equal(t, zerolog.ErrorLevel, edurouter.LogLevels()[edurouter.LogSubsystemIPv4])
+
+	edurouter.Logger(edurouter.LogSubsystemARP).Debug().Str("ip", "10.0.0.1").Msg("arp debug")
+	edurouter.Logger(edurouter.LogSubsystemIPv4).Debug().Msg("ipv4 debug")
+	edurouter.Logger(edurouter.LogSubsystemIPv4).Error().Msg("ipv4 error")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var event map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(t, "arp", event["subsystem"])
+	assert.Equal(t, "debug", event["level"])
+	assert.Equal(t, "10.0.0.1", event["ip"])
+	assert.Equal(t, "arp debug", event["message"])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, "ipv4", event["subsystem"])
+	assert.Equal(t, "ipv4 error", event["message"])
+
+	edurouter.SetAllLogLevels(zerolog.Disabled)
+	edurouter.Logger(edurouter.LogSubsystemIPv4).Error().Msg("silent")
+	assert.NotContains(t, buf.String(), "silent")
+}
+
+func TestParseLogSubsystem(t *testing.T) {
+	s, err := edurouter.ParseLogSubsystem("route")
+	require.NoError(t, err)
+	assert.Equal(t, edurouter.LogSubsystemRoute, s)
+
+	_, err = edurouter.ParseLogSubsystem("routing")
+	assert.ErrorIs(t, err, edurouter.ErrUnknownLogSubsystem)
+}
@@ -0,0 +1,89 @@
+package edurouter
+
+import (
+	"net"
+	"sync"
+)
+
+// LoopbackInterfaceName is the name of the emulated loopback interface
+const LoopbackInterfaceName = "lo"
+
+// LoopbackNetwork is always owned by the emulated loopback interface
+var LoopbackNetwork = net.IPNet{IP: net.IP{127, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}
+
+// LoopbackAddr is the source address of packets the router sends to LoopbackNetwork
+var LoopbackAddr = net.IP{127, 0, 0, 1}
+
+// Loopback is the emulated loopback interface of the router. It owns LoopbackNetwork and the router-id addresses,
+// which are local like the addresses of the interfaces, but do not belong to any attached network.
+type Loopback struct {
+	routerIDs []net.IP
+	mu        sync.RWMutex
+}
+
+func NewLoopback() *Loopback {
+	return &Loopback{}
+}
+
+// AddRouterID adds a router-id address to the loopback interface
+func (lo *Loopback) AddRouterID(ip net.IP) error {
+	ip = ip.To4()
+	if ip == nil {
+		return ErrNotAnIPv4Address
+	}
+
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+
+	for _, id := range lo.routerIDs {
+		if id.Equal(ip) {
+			return ErrRouterIDExists
+		}
+	}
+
+	lo.routerIDs = append(lo.routerIDs, ip)
+
+	Logger(LogSubsystemIface).Info().Stringer("addr", ip).Msg("router-id added")
+	return nil
+}
+
+// DeleteRouterID removes a router-id address from the loopback interface
+func (lo *Loopback) DeleteRouterID(ip net.IP) error {
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+
+	for n, id := range lo.routerIDs {
+		if id.Equal(ip) {
+			lo.routerIDs = append(lo.routerIDs[:n], lo.routerIDs[n+1:]...)
+			return nil
+		}
+	}
+	return ErrNoSuchRouterID
+}
+
+// RouterIDs returns the router-id addresses in the order they were added
+func (lo *Loopback) RouterIDs() []net.IP {
+	lo.mu.RLock()
+	defer lo.mu.RUnlock()
+
+	ids := make([]net.IP, len(lo.routerIDs))
+	copy(ids, lo.routerIDs)
+	return ids
+}
+
+// Owns reports whether ip is in LoopbackNetwork or is a router-id
+func (lo *Loopback) Owns(ip net.IP) bool {
+	if LoopbackNetwork.Contains(ip) {
+		return true
+	}
+
+	lo.mu.RLock()
+	defer lo.mu.RUnlock()
+
+	for _, id := range lo.routerIDs {
+		if id.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLoopback_RouterIDs(t *testing.T) {
+	lo := edurouter.NewLoopback()
+
+	assert.True(t, lo.Owns(net.IP{127, 0, 0, 1}))
+	assert.True(t, lo.Owns(net.IP{127, 1, 2, 3}))
+	assert.False(t, lo.Owns(net.IP{192, 168, 255, 1}))
+
+	require.NoError(t, lo.AddRouterID(net.IP{192, 168, 255, 1}))
+	assert.ErrorIs(t, lo.AddRouterID(net.ParseIP("192.168.255.1")), edurouter.ErrRouterIDExists)
+	assert.ErrorIs(t, lo.AddRouterID(net.ParseIP("fe80::1")), edurouter.ErrNotAnIPv4Address)
+
+	assert.True(t, lo.Owns(net.IP{192, 168, 255, 1}))
+	assert.Equal(t, []net.IP{{192, 168, 255, 1}}, lo.RouterIDs())
+
+	require.NoError(t, lo.DeleteRouterID(net.IP{192, 168, 255, 1}))
+	assert.ErrorIs(t, lo.DeleteRouterID(net.IP{192, 168, 255, 1}), edurouter.ErrNoSuchRouterID)
+	assert.False(t, lo.Owns(net.IP{192, 168, 255, 1}))
+	assert.Empty(t, lo.RouterIDs())
+}
+
+func TestLinkLayerListener_PingLocalAddress(t *testing.T) {
+	tests := map[string]struct {
+		dstIP    net.IP
+		routerID net.IP
+	}{
+		"IngressInterface": {
+			dstIP: net.IP{10, 0, 0, 1},
+		},
+		"OtherInterface": {
+			dstIP: net.IP{10, 0, 1, 1},
+		},
+		"Loopback": {
+			dstIP: net.IP{127, 0, 0, 1},
+		},
+		"LoopbackNetwork": {
+			dstIP: net.IP{127, 5, 5, 5},
+		},
+		"RouterID": {
+			dstIP:    net.IP{192, 168, 255, 1},
+			routerID: net.IP{192, 168, 255, 1},
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newICMPErrorSetup(t, ctx)
+			if v.routerID != nil {
+				require.NoError(t, s.router.listener.Loopback().AddRouterID(v.routerID))
+			}
+
+			opts := edurouter.DefaultPingOptions
+			opts.Count = 2
+			opts.Interval = 10 * time.Millisecond
+			opts.Timeout = 500 * time.Millisecond
+
+			var replies []edurouter.PingReply
+			stats, err := s.router.listener.Ping(ctx, v.dstIP, opts, func(r edurouter.PingReply) {
+				replies = append(replies, r)
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 2, stats.Received)
+
+			for _, r := range replies {
+				assert.EqualValues(t, v.dstIP, r.Src)
+				assert.Equal(t, edurouter.IcmpTypeEchoReply, r.Type)
+			}
+
+			// nothing is sent on a link, not even an ARP request
+			assert.Nil(t, receiveFrame(s.hostFrames, 50*time.Millisecond))
+		})
+	}
+}
+
+func TestLinkLayerListener_ForwardedToLocalAddress(t *testing.T) {
+	tests := map[string]struct {
+		dstIP     net.IP
+		routerID  net.IP
+		wantReply bool
+	}{
+		"OtherInterface": {
+			dstIP:     net.IP{10, 0, 1, 1},
+			wantReply: true,
+		},
+		"RouterID": {
+			dstIP:     net.IP{192, 168, 255, 1},
+			routerID:  net.IP{192, 168, 255, 1},
+			wantReply: true,
+		},
+		"LoopbackNotAccepted": {
+			dstIP: net.IP{127, 0, 0, 1},
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newICMPErrorSetup(t, ctx)
+			if v.routerID != nil {
+				require.NoError(t, s.router.listener.Loopback().AddRouterID(v.routerID))
+			}
+
+			s.send(t, v.dstIP, edurouter.DefaultIPv4TTL, edurouter.IPProtocolICMPv4, nil)
+
+			reply := nextIPv4(s.hostFrames, 200*time.Millisecond)
+			if !v.wantReply {
+				assert.Nil(t, reply)
+				return
+			}
+
+			require.NotNil(t, reply, "no echo reply received")
+			assert.EqualValues(t, v.dstIP, reply.SrcIP)
+			assert.EqualValues(t, s.hostIP, reply.DstIP)
+
+			var icmpPacket edurouter.ICMPPacket
+			require.NoError(t, (&icmpPacket).UnmarshalBinary(reply.Payload))
+			assert.Equal(t, edurouter.IcmpTypeEchoReply, icmpPacket.IcmpType)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package edurouter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// classic libpcap file format, see https://www.tcpdump.org/manpages/pcap-savefile.5.html
+const (
+	pcapMagicMicroseconds uint32 = 0xA1B2C3D4
+	pcapMagicNanoseconds  uint32 = 0xA1B23C4D
+
+	pcapGlobalHeaderLength = 24
+	pcapRecordHeaderLength = 16
+	pcapMaxSnapLength      = 262144
+)
+
+// PcapPacket is a single packet read from a capture file
+type PcapPacket struct {
+	Timestamp time.Time
+	Data      []byte
+}
+
+// PacketReader reads packets from a capture file. ReadPacket returns io.EOF after the last packet.
+type PacketReader interface {
+	ReadPacket() (PcapPacket, error)
+}
+
+// NewPacketReader detects whether r is a classic pcap or a pcapng stream and returns the matching reader.
+// Only ethernet captures are supported.
+func NewPacketReader(r io.Reader) (PacketReader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(magic) == pcapngBlockTypeSHB {
+		// the section header block type is a palindrome, so the byte order does not matter
+		return NewPcapngReader(br)
+	}
+
+	return NewPcapReader(br)
+}
+
+// PcapReader reads classic pcap files in either byte order with micro- or nanosecond timestamps
+type PcapReader struct {
+	r           io.Reader
+	byteOrder   binary.ByteOrder
+	nanoseconds bool
+}
+
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	header := make([]byte, pcapGlobalHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	p := &PcapReader{r: r}
+
+	switch {
+	case binary.LittleEndian.Uint32(header[0:4]) == pcapMagicMicroseconds:
+		p.byteOrder = binary.LittleEndian
+	case binary.BigEndian.Uint32(header[0:4]) == pcapMagicMicroseconds:
+		p.byteOrder = binary.BigEndian
+	case binary.LittleEndian.Uint32(header[0:4]) == pcapMagicNanoseconds:
+		p.byteOrder = binary.LittleEndian
+		p.nanoseconds = true
+	case binary.BigEndian.Uint32(header[0:4]) == pcapMagicNanoseconds:
+		p.byteOrder = binary.BigEndian
+		p.nanoseconds = true
+	default:
+		return nil, ErrUnknownCaptureFormat
+	}
+
+	if p.byteOrder.Uint32(header[20:24]) != LinkTypeEthernet {
+		return nil, ErrUnsupportedLinkType
+	}
+
+	return p, nil
+}
+
+func (p *PcapReader) ReadPacket() (PcapPacket, error) {
+	header := make([]byte, pcapRecordHeaderLength)
+	if _, err := io.ReadFull(p.r, header); err != nil {
+		return PcapPacket{}, err
+	}
+
+	seconds := p.byteOrder.Uint32(header[0:4])
+	fraction := p.byteOrder.Uint32(header[4:8])
+	capturedLength := p.byteOrder.Uint32(header[8:12])
+
+	if capturedLength > pcapMaxSnapLength {
+		return PcapPacket{}, ErrCaptureRecordTooLarge
+	}
+
+	data := make([]byte, capturedLength)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return PcapPacket{}, io.ErrUnexpectedEOF
+	}
+
+	nanos := int64(fraction)
+	if !p.nanoseconds {
+		nanos *= int64(time.Microsecond)
+	}
+
+	return PcapPacket{
+		Timestamp: time.Unix(int64(seconds), nanos),
+		Data:      data,
+	}, nil
+}
+
+// PcapWriter writes ethernet frames into a classic pcap file with nanosecond timestamps
+type PcapWriter struct {
+	w io.Writer
+}
+
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	header := make([]byte, pcapGlobalHeaderLength)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagicNanoseconds)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	// thiszone and sigfigs are always zero
+	binary.LittleEndian.PutUint32(header[16:20], pcapMaxSnapLength)
+	binary.LittleEndian.PutUint32(header[20:24], LinkTypeEthernet)
+
+	_, err := w.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PcapWriter{w: w}, nil
+}
+
+func (p *PcapWriter) WritePacket(ts time.Time, data []byte) error {
+	b := make([]byte, pcapRecordHeaderLength, pcapRecordHeaderLength+len(data))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(ts.Nanosecond()))
+	binary.LittleEndian.PutUint32(b[8:12], uint32(len(data)))
+	binary.LittleEndian.PutUint32(b[12:16], uint32(len(data)))
+	b = append(b, data...)
+
+	_, err := p.w.Write(b)
+	return err
+}
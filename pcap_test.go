@@ -0,0 +1,131 @@
+package edurouter_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPcapWriterAndReader(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := edurouter.NewPcapWriter(&buf)
+	require.NoError(t, err)
+
+	ts1 := time.Unix(1700000000, 123456789)
+	ts2 := time.Unix(1700000001, 1)
+	data1 := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 0x08, 0x06}
+	data2 := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 0x08, 0x00, 0xff}
+
+	require.NoError(t, w.WritePacket(ts1, data1))
+	require.NoError(t, w.WritePacket(ts2, data2))
+
+	r, err := edurouter.NewPacketReader(&buf)
+	require.NoError(t, err)
+	require.IsType(t, &edurouter.PcapReader{}, r)
+
+	p, err := r.ReadPacket()
+	require.NoError(t, err)
+	assert.True(t, ts1.Equal(p.Timestamp))
+	assert.EqualValues(t, data1, p.Data)
+
+	p, err = r.ReadPacket()
+	require.NoError(t, err)
+	assert.True(t, ts2.Equal(p.Timestamp))
+	assert.EqualValues(t, data2, p.Data)
+
+	_, err = r.ReadPacket()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestPcapReader_BigEndianMicroseconds(t *testing.T) {
+	var buf bytes.Buffer
+
+	header := make([]byte, 24)
+	binary.BigEndian.PutUint32(header[0:4], 0xA1B2C3D4)
+	binary.BigEndian.PutUint16(header[4:6], 2)
+	binary.BigEndian.PutUint16(header[6:8], 4)
+	binary.BigEndian.PutUint32(header[16:20], 65535)
+	binary.BigEndian.PutUint32(header[20:24], 1)
+	buf.Write(header)
+
+	data := []byte{0xde, 0xad, 0xbe, 0xef}
+	record := make([]byte, 16)
+	binary.BigEndian.PutUint32(record[0:4], 10)
+	binary.BigEndian.PutUint32(record[4:8], 500)
+	binary.BigEndian.PutUint32(record[8:12], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[12:16], uint32(len(data)))
+	buf.Write(record)
+	buf.Write(data)
+
+	r, err := edurouter.NewPacketReader(&buf)
+	require.NoError(t, err)
+
+	p, err := r.ReadPacket()
+	require.NoError(t, err)
+	assert.True(t, time.Unix(10, 500*int64(time.Microsecond)).Equal(p.Timestamp))
+	assert.EqualValues(t, data, p.Data)
+}
+
+func TestPcapReader_Errors(t *testing.T) {
+	tests := map[string]struct {
+		input   []byte
+		wantErr error
+	}{
+		"UnknownMagic": {
+			input:   make([]byte, 24),
+			wantErr: edurouter.ErrUnknownCaptureFormat,
+		},
+		"Truncated": {
+			input:   []byte{0xd4, 0xc3, 0xb2, 0xa1},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		"NotEthernet": {
+			input:   []byte{0xd4, 0xc3, 0xb2, 0xa1, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0, 0, 101, 0, 0, 0},
+			wantErr: edurouter.ErrUnsupportedLinkType,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := edurouter.NewPacketReader(bytes.NewReader(v.input))
+			assert.ErrorIs(t, err, v.wantErr)
+		})
+	}
+}
+
+func TestPcapngReader(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := edurouter.NewPcapngWriter(&buf)
+	require.NoError(t, err)
+
+	ts := time.Unix(1700000000, 123456789)
+	frames := []edurouter.CapturedFrame{
+		{Timestamp: ts, InterfaceName: "eth0", Direction: edurouter.FrameDirectionIn, Data: []byte{1, 2, 3}},
+		{Timestamp: ts.Add(time.Second), InterfaceName: "eth1", Direction: edurouter.FrameDirectionOut, Data: []byte{4, 5, 6, 7, 8}},
+	}
+
+	for _, f := range frames {
+		require.NoError(t, w.WriteFrame(f))
+	}
+
+	r, err := edurouter.NewPacketReader(&buf)
+	require.NoError(t, err)
+	require.IsType(t, &edurouter.PcapngReader{}, r)
+
+	for _, f := range frames {
+		p, err := r.ReadPacket()
+		require.NoError(t, err)
+		assert.True(t, f.Timestamp.Equal(p.Timestamp))
+		assert.EqualValues(t, f.Data, p.Data)
+	}
+
+	_, err = r.ReadPacket()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,204 @@
+package edurouter
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	pcapngBlockTypeSPB uint32 = 0x00000003
+
+	pcapngDefaultTsResol = 6
+	pcapngMaxBlockLength = 16 * 1024 * 1024
+)
+
+type pcapngInterface struct {
+	linkType uint16
+	// units per second of the timestamps
+	tsUnitsPerSecond uint64
+}
+
+// PcapngReader reads ethernet frames from enhanced and simple packet blocks of a pcapng stream
+type PcapngReader struct {
+	r          io.Reader
+	byteOrder  binary.ByteOrder
+	interfaces []pcapngInterface
+}
+
+func NewPcapngReader(r io.Reader) (*PcapngReader, error) {
+	p := &PcapngReader{r: r}
+
+	blockType, _, err := p.readBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if blockType != pcapngBlockTypeSHB {
+		return nil, ErrUnknownCaptureFormat
+	}
+
+	return p, nil
+}
+
+func (p *PcapngReader) ReadPacket() (PcapPacket, error) {
+	for {
+		blockType, body, err := p.readBlock()
+		if err != nil {
+			return PcapPacket{}, err
+		}
+
+		switch blockType {
+		case pcapngBlockTypeIDB:
+			p.readInterfaceDescription(body)
+
+		case pcapngBlockTypeEPB:
+			if len(body) < 20 {
+				return PcapPacket{}, io.ErrUnexpectedEOF
+			}
+
+			ifi, err := p.interfaceByID(p.byteOrder.Uint32(body[0:4]))
+			if err != nil {
+				return PcapPacket{}, err
+			}
+
+			ts := uint64(p.byteOrder.Uint32(body[4:8]))<<32 | uint64(p.byteOrder.Uint32(body[8:12]))
+			capturedLength := p.byteOrder.Uint32(body[12:16])
+
+			if int(capturedLength) > len(body)-20 {
+				return PcapPacket{}, io.ErrUnexpectedEOF
+			}
+
+			seconds := ts / ifi.tsUnitsPerSecond
+			nanos := (ts % ifi.tsUnitsPerSecond) * uint64(time.Second) / ifi.tsUnitsPerSecond
+
+			return PcapPacket{
+				Timestamp: time.Unix(int64(seconds), int64(nanos)),
+				Data:      body[20 : 20+capturedLength],
+			}, nil
+
+		case pcapngBlockTypeSPB:
+			if len(body) < 4 {
+				return PcapPacket{}, io.ErrUnexpectedEOF
+			}
+
+			if _, err := p.interfaceByID(0); err != nil {
+				return PcapPacket{}, err
+			}
+
+			// simple packet blocks have no timestamp and may be truncated to the snap length
+			originalLength := int(p.byteOrder.Uint32(body[0:4]))
+			data := body[4:]
+			if originalLength < len(data) {
+				data = data[:originalLength]
+			}
+
+			return PcapPacket{Data: data}, nil
+		}
+
+		// other blocks are skipped
+	}
+}
+
+func (p *PcapngReader) interfaceByID(id uint32) (pcapngInterface, error) {
+	if int(id) >= len(p.interfaces) {
+		return pcapngInterface{}, ErrUnknownCaptureFormat
+	}
+
+	ifi := p.interfaces[id]
+	if ifi.linkType != LinkTypeEthernet {
+		return pcapngInterface{}, ErrUnsupportedLinkType
+	}
+	return ifi, nil
+}
+
+func (p *PcapngReader) readInterfaceDescription(body []byte) {
+	ifi := pcapngInterface{
+		tsUnitsPerSecond: uint64(math.Pow10(pcapngDefaultTsResol)),
+	}
+
+	if len(body) >= 8 {
+		ifi.linkType = p.byteOrder.Uint16(body[0:2])
+
+		options := body[8:]
+		for len(options) >= 4 {
+			code := p.byteOrder.Uint16(options[0:2])
+			length := int(p.byteOrder.Uint16(options[2:4]))
+			if code == pcapngOptionEndOfOpt || len(options) < 4+length {
+				break
+			}
+
+			if code == pcapngOptionIfTsResol && length == 1 {
+				tsResol := options[4]
+				if tsResol&0x80 == 0 {
+					// negative power of 10
+					ifi.tsUnitsPerSecond = uint64(math.Pow10(int(tsResol)))
+				} else {
+					// negative power of 2
+					ifi.tsUnitsPerSecond = 1 << (tsResol & 0x7f)
+				}
+			}
+
+			options = options[4+length+pcapngPadding(length):]
+		}
+	}
+
+	p.interfaces = append(p.interfaces, ifi)
+}
+
+// readBlock returns type and body of the next block. A section header block resets the byte order and interfaces.
+func (p *PcapngReader) readBlock() (uint32, []byte, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(p.r, header[:8]); err != nil {
+		return 0, nil, err
+	}
+
+	if binary.LittleEndian.Uint32(header[0:4]) == pcapngBlockTypeSHB {
+		// the byte order magic follows the block length
+		if _, err := io.ReadFull(p.r, header[8:12]); err != nil {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+
+		switch {
+		case binary.LittleEndian.Uint32(header[8:12]) == pcapngByteOrderMagic:
+			p.byteOrder = binary.LittleEndian
+		case binary.BigEndian.Uint32(header[8:12]) == pcapngByteOrderMagic:
+			p.byteOrder = binary.BigEndian
+		default:
+			return 0, nil, ErrUnknownCaptureFormat
+		}
+
+		p.interfaces = nil
+
+		totalLength := p.byteOrder.Uint32(header[4:8])
+		if totalLength < 16 || totalLength > pcapngMaxBlockLength {
+			return 0, nil, ErrCaptureRecordTooLarge
+		}
+
+		rest := make([]byte, totalLength-12)
+		if _, err := io.ReadFull(p.r, rest); err != nil {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+
+		body := append(header[8:12], rest[:len(rest)-4]...)
+		return pcapngBlockTypeSHB, body, nil
+	}
+
+	if p.byteOrder == nil {
+		return 0, nil, ErrUnknownCaptureFormat
+	}
+
+	blockType := p.byteOrder.Uint32(header[0:4])
+	totalLength := p.byteOrder.Uint32(header[4:8])
+	if totalLength < 12 || totalLength > pcapngMaxBlockLength {
+		return 0, nil, ErrCaptureRecordTooLarge
+	}
+
+	rest := make([]byte, totalLength-8)
+	if _, err := io.ReadFull(p.r, rest); err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+
+	return blockType, rest[:len(rest)-4], nil
+}
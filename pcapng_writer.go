@@ -0,0 +1,136 @@
+package edurouter
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// pcapng block types and options, see https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+const (
+	pcapngBlockTypeSHB uint32 = 0x0A0D0D0A
+	pcapngBlockTypeIDB uint32 = 0x00000001
+	pcapngBlockTypeEPB uint32 = 0x00000006
+
+	pcapngByteOrderMagic uint32 = 0x1A2B3C4D
+
+	pcapngOptionEndOfOpt   uint16 = 0
+	pcapngOptionShbUserApp uint16 = 4
+	pcapngOptionIfName     uint16 = 2
+	pcapngOptionIfTsResol  uint16 = 9
+	pcapngOptionEpbFlags   uint16 = 2
+
+	pcapngEpbFlagInbound  uint32 = 1
+	pcapngEpbFlagOutbound uint32 = 2
+
+	// timestamps are written in nanoseconds
+	pcapngTsResolNanoseconds = 9
+
+	LinkTypeEthernet = 1
+)
+
+// PcapngWriter writes frames into a pcapng stream which can be opened with Wireshark.
+// An interface description block is emitted the first time a frame of an interface is written.
+type PcapngWriter struct {
+	w          io.Writer
+	interfaces map[string]uint32
+}
+
+func NewPcapngWriter(w io.Writer) (*PcapngWriter, error) {
+	p := &PcapngWriter{
+		w:          w,
+		interfaces: map[string]uint32{},
+	}
+
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:4], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:6], 1)
+	binary.LittleEndian.PutUint16(body[6:8], 0)
+	// section length is not specified
+	binary.LittleEndian.PutUint64(body[8:16], 0xFFFFFFFFFFFFFFFF)
+
+	body = appendPcapngOption(body, pcapngOptionShbUserApp, []byte("edurouter "+Version()))
+	body = appendPcapngOption(body, pcapngOptionEndOfOpt, nil)
+
+	return p, p.writeBlock(pcapngBlockTypeSHB, body)
+}
+
+func (p *PcapngWriter) WriteFrame(f CapturedFrame) error {
+	interfaceID, ok := p.interfaces[f.InterfaceName]
+	if !ok {
+		var err error
+		interfaceID, err = p.writeInterfaceDescription(f.InterfaceName)
+		if err != nil {
+			return err
+		}
+	}
+
+	ts := uint64(f.Timestamp.UnixNano())
+
+	body := make([]byte, 20, 20+len(f.Data)+16)
+	binary.LittleEndian.PutUint32(body[0:4], interfaceID)
+	binary.LittleEndian.PutUint32(body[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(f.Data)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(len(f.Data)))
+
+	body = append(body, f.Data...)
+	body = append(body, make([]byte, pcapngPadding(len(f.Data)))...)
+
+	flags := make([]byte, 4)
+	if f.Direction == FrameDirectionIn {
+		binary.LittleEndian.PutUint32(flags, pcapngEpbFlagInbound)
+	} else {
+		binary.LittleEndian.PutUint32(flags, pcapngEpbFlagOutbound)
+	}
+
+	body = appendPcapngOption(body, pcapngOptionEpbFlags, flags)
+	body = appendPcapngOption(body, pcapngOptionEndOfOpt, nil)
+
+	return p.writeBlock(pcapngBlockTypeEPB, body)
+}
+
+func (p *PcapngWriter) writeInterfaceDescription(interfaceName string) (uint32, error) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:2], LinkTypeEthernet)
+	// snap length of 0 means no limit
+	binary.LittleEndian.PutUint32(body[4:8], 0)
+
+	body = appendPcapngOption(body, pcapngOptionIfName, []byte(interfaceName))
+	body = appendPcapngOption(body, pcapngOptionIfTsResol, []byte{pcapngTsResolNanoseconds})
+	body = appendPcapngOption(body, pcapngOptionEndOfOpt, nil)
+
+	err := p.writeBlock(pcapngBlockTypeIDB, body)
+	if err != nil {
+		return 0, err
+	}
+
+	interfaceID := uint32(len(p.interfaces))
+	p.interfaces[interfaceName] = interfaceID
+	return interfaceID, nil
+}
+
+// writeBlock frames the body with block type and the total length at start and end
+func (p *PcapngWriter) writeBlock(blockType uint32, body []byte) error {
+	totalLength := uint32(12 + len(body))
+
+	b := make([]byte, 8, totalLength)
+	binary.LittleEndian.PutUint32(b[0:4], blockType)
+	binary.LittleEndian.PutUint32(b[4:8], totalLength)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, totalLength)
+
+	_, err := p.w.Write(b)
+	return err
+}
+
+func appendPcapngOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, pcapngPadding(len(value)))...)
+}
+
+// pcapngPadding returns the number of bytes needed to align n to 32 bits
+func pcapngPadding(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,111 @@
+package edurouter_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type pcapngBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+func splitPcapngBlocks(t *testing.T, b []byte) []pcapngBlock {
+	var blocks []pcapngBlock
+
+	for len(b) > 0 {
+		require.GreaterOrEqual(t, len(b), 12)
+
+		blockType := binary.LittleEndian.Uint32(b[0:4])
+		totalLength := binary.LittleEndian.Uint32(b[4:8])
+		require.Zero(t, totalLength%4, "blocks are 32 bit aligned")
+		require.GreaterOrEqual(t, len(b), int(totalLength))
+		require.EqualValues(t, totalLength, binary.LittleEndian.Uint32(b[totalLength-4:totalLength]))
+
+		blocks = append(blocks, pcapngBlock{
+			blockType: blockType,
+			body:      b[8 : totalLength-4],
+		})
+		b = b[totalLength:]
+	}
+	return blocks
+}
+
+func TestPcapngWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := edurouter.NewPcapngWriter(&buf)
+	require.NoError(t, err)
+
+	ts := time.Unix(1700000000, 123456789)
+	frame := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4, 5, 6, 0x08, 0x06, 0xde, 0xad, 0xbe}
+
+	require.NoError(t, w.WriteFrame(edurouter.CapturedFrame{
+		Timestamp:     ts,
+		InterfaceName: "eth0",
+		Direction:     edurouter.FrameDirectionIn,
+		Data:          frame,
+	}))
+	require.NoError(t, w.WriteFrame(edurouter.CapturedFrame{
+		Timestamp:     ts,
+		InterfaceName: "eth1",
+		Direction:     edurouter.FrameDirectionOut,
+		Data:          frame,
+	}))
+	require.NoError(t, w.WriteFrame(edurouter.CapturedFrame{
+		Timestamp:     ts,
+		InterfaceName: "eth0",
+		Direction:     edurouter.FrameDirectionOut,
+		Data:          frame,
+	}))
+
+	blocks := splitPcapngBlocks(t, buf.Bytes())
+	require.Len(t, blocks, 6)
+
+	// section header, interface eth0, packet, interface eth1, packet, packet
+	wantTypes := []uint32{0x0A0D0D0A, 1, 6, 1, 6, 6}
+	for i, block := range blocks {
+		assert.EqualValues(t, wantTypes[i], block.blockType)
+	}
+
+	assert.EqualValues(t, 0x1A2B3C4D, binary.LittleEndian.Uint32(blocks[0].body[0:4]))
+
+	// linktype ethernet and the interface name as first option
+	assert.EqualValues(t, 1, binary.LittleEndian.Uint16(blocks[1].body[0:2]))
+	assert.EqualValues(t, 2, binary.LittleEndian.Uint16(blocks[1].body[8:10]))
+	assert.EqualValues(t, "eth0", string(blocks[1].body[12:16]))
+
+	wantPackets := []struct {
+		block       pcapngBlock
+		interfaceID uint32
+		flags       uint32
+	}{
+		{block: blocks[2], interfaceID: 0, flags: 1},
+		{block: blocks[4], interfaceID: 1, flags: 2},
+		{block: blocks[5], interfaceID: 0, flags: 2},
+	}
+
+	for _, want := range wantPackets {
+		body := want.block.body
+
+		assert.EqualValues(t, want.interfaceID, binary.LittleEndian.Uint32(body[0:4]))
+
+		tsNanos := uint64(binary.LittleEndian.Uint32(body[4:8]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:12]))
+		assert.EqualValues(t, ts.UnixNano(), tsNanos)
+
+		assert.EqualValues(t, len(frame), binary.LittleEndian.Uint32(body[12:16]))
+		assert.EqualValues(t, len(frame), binary.LittleEndian.Uint32(body[16:20]))
+		assert.EqualValues(t, frame, body[20:20+len(frame)])
+
+		// data is padded to 32 bits, followed by the epb_flags option
+		options := body[20+len(frame)+3:]
+		assert.EqualValues(t, 2, binary.LittleEndian.Uint16(options[0:2]))
+		assert.EqualValues(t, 4, binary.LittleEndian.Uint16(options[2:4]))
+		assert.EqualValues(t, want.flags, binary.LittleEndian.Uint32(options[4:8]))
+	}
+}
@@ -0,0 +1,281 @@
+package edurouter
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	"net"
+	"time"
+)
+
+// pingFloodInterval is the longest time a flood ping waits before sending the next echo request
+const pingFloodInterval = 10 * time.Millisecond
+
+// maxPingSize is the largest number of data bytes fitting into an IPv4 packet after the ICMP header
+const maxPingSize = math.MaxUint16 - IPv4HeaderLength - icmpv4HeaderLength
+
+// PingOptions configures the echo requests sent by a ping
+type PingOptions struct {
+	// Count is the number of echo requests sent, 0 sends until the deadline is reached or ctx is done
+	Count int
+	// Interval is the time between two echo requests
+	Interval time.Duration
+	// Size is the number of data bytes after the ICMP header
+	Size int
+	// TTL is the time to live of the echo requests
+	TTL uint8
+	// Source is the source address of the echo requests, e.g. the address of an interface.
+	// If it is nil, the address of the outgoing interface is used.
+	Source net.IP
+	// Timeout is the time to wait for the reply to an echo request
+	Timeout time.Duration
+	// Deadline stops the ping after this duration, no matter how many echo requests were sent. 0 means no deadline.
+	Deadline time.Duration
+	// Flood sends the next echo request as soon as a reply arrives, but at least every 10ms
+	Flood bool
+	// RecordRoute adds a record route option to the echo requests, the route is returned in PingReply.Route
+	RecordRoute bool
+}
+
+// DefaultPingOptions sends four echo requests with 56 data bytes, one per second
+var DefaultPingOptions = PingOptions{
+	Count:    4,
+	Interval: time.Second,
+	Size:     56,
+	TTL:      DefaultIPv4TTL,
+	Timeout:  2 * time.Second,
+}
+
+// PingReply is the outcome of a single echo request. Src is nil if the request was not answered in time.
+type PingReply struct {
+	Seq uint16
+	Src net.IP
+	TTL uint8
+	// Length is the size of the ICMP message received
+	Length int
+	RTT    time.Duration
+	// Type is IcmpTypeEchoReply, or the type of an ICMP error about the echo request
+	Type IcmpType
+	Code uint8
+	// Route holds the addresses recorded on the way to the destination and back, if RecordRoute was set
+	Route []net.IP
+}
+
+// TimedOut reports whether the echo request was not answered in time
+func (r PingReply) TimedOut() bool {
+	return r.Src == nil
+}
+
+// PingStatistics summarizes a ping. The round trip times are computed from the echo replies only.
+type PingStatistics struct {
+	Transmitted int
+	Received    int
+	// Errors is the number of ICMP errors received about the echo requests
+	Errors  int
+	Min     time.Duration
+	Avg     time.Duration
+	Max     time.Duration
+	Mdev    time.Duration
+	Elapsed time.Duration
+}
+
+// Loss returns the percentage of echo requests not answered with an echo reply
+func (s PingStatistics) Loss() float64 {
+	if s.Transmitted == 0 {
+		return 0
+	}
+	return float64(s.Transmitted-s.Received) * 100 / float64(s.Transmitted)
+}
+
+// pendingEcho is an echo request waiting for its reply
+type pendingEcho struct {
+	seq  uint16
+	sent time.Time
+}
+
+// Ping sends echo requests to dstIP and matches the replies by id and sequence number.
+// replyFn is called for every reply, ICMP error and timeout, it may be nil.
+// If ctx is done or the deadline is reached, the statistics of the requests sent so far are returned.
+func (i *IcmpHandler) Ping(ctx context.Context, dstIP net.IP, opts PingOptions, replyFn func(PingReply)) (PingStatistics, error) {
+	dstIP = dstIP.To4()
+	if dstIP == nil {
+		return PingStatistics{}, ErrNotAnIPv4Address
+	}
+
+	maxSize := maxPingSize
+	if opts.RecordRoute {
+		maxSize -= ipv4MaxOptionsLength
+	}
+
+	if opts.Size < 0 || opts.Size > maxSize {
+		return PingStatistics{}, ErrPingSizeTooLarge
+	}
+
+	interval := opts.Interval
+	if opts.Flood {
+		interval = pingFloodInterval
+	}
+	if interval <= 0 {
+		return PingStatistics{}, ErrInvalidPingInterval
+	}
+
+	if opts.Timeout <= 0 {
+		return PingStatistics{}, ErrInvalidPingTimeout
+	}
+
+	if opts.Count < 0 {
+		return PingStatistics{}, ErrInvalidPingCount
+	}
+
+	if opts.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Deadline)
+		defer cancel()
+	}
+
+	if replyFn == nil {
+		replyFn = func(PingReply) {}
+	}
+
+	id, replies := i.registerProbes(IPProtocolICMPv4)
+	defer i.unregisterProbes(IPProtocolICMPv4, id)
+
+	var stats PingStatistics
+	var pending []pendingEcho
+	var seq uint16
+	var rttSum, rttSquareSum float64
+
+	start := time.Now()
+	nextSend := start
+
+loop:
+	for {
+		now := time.Now()
+		moreToSend := opts.Count == 0 || stats.Transmitted < opts.Count
+
+		if moreToSend && !now.Before(nextSend) {
+			seq++
+
+			select {
+			case i.publishCh <- newEchoRequestPdu(dstIP, opts, id, seq):
+			case <-ctx.Done():
+				break loop
+			}
+
+			pending = append(pending, pendingEcho{seq: seq, sent: now})
+			stats.Transmitted++
+			nextSend = now.Add(interval)
+			moreToSend = opts.Count == 0 || stats.Transmitted < opts.Count
+		}
+
+		// pending requests are ordered by the time they were sent
+		for len(pending) > 0 && now.Sub(pending[0].sent) >= opts.Timeout {
+			replyFn(PingReply{Seq: pending[0].seq})
+			pending = pending[1:]
+		}
+
+		if !moreToSend && len(pending) == 0 {
+			break
+		}
+
+		var wake time.Time
+		if len(pending) > 0 {
+			wake = pending[0].sent.Add(opts.Timeout)
+		}
+		if moreToSend && (wake.IsZero() || nextSend.Before(wake)) {
+			wake = nextSend
+		}
+
+		timer := time.NewTimer(time.Until(wake))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			break loop
+		case <-timer.C:
+		case reply := <-replies:
+			timer.Stop()
+
+			n := indexOfPendingEcho(pending, reply.Seq)
+			if n < 0 {
+				// late or duplicate reply
+				continue
+			}
+
+			result := PingReply{
+				Seq:    reply.Seq,
+				Src:    reply.Src,
+				TTL:    reply.TTL,
+				Length: reply.Length,
+				RTT:    reply.Received.Sub(pending[n].sent),
+				Type:   reply.Type,
+				Code:   reply.Code,
+				Route:  reply.Route,
+			}
+			pending = append(pending[:n], pending[n+1:]...)
+
+			if result.Type == IcmpTypeEchoReply {
+				if stats.Received == 0 || result.RTT < stats.Min {
+					stats.Min = result.RTT
+				}
+				if result.RTT > stats.Max {
+					stats.Max = result.RTT
+				}
+				stats.Received++
+				rttSum += float64(result.RTT)
+				rttSquareSum += float64(result.RTT) * float64(result.RTT)
+			} else {
+				stats.Errors++
+			}
+
+			replyFn(result)
+
+			if opts.Flood {
+				nextSend = time.Now()
+			}
+		}
+	}
+
+	stats.Elapsed = time.Since(start)
+
+	if stats.Received > 0 {
+		avg := rttSum / float64(stats.Received)
+		stats.Avg = time.Duration(avg)
+		stats.Mdev = time.Duration(math.Sqrt(math.Max(rttSquareSum/float64(stats.Received)-avg*avg, 0)))
+	}
+
+	return stats, nil
+}
+
+func indexOfPendingEcho(pending []pendingEcho, seq uint16) int {
+	for n, p := range pending {
+		if p.seq == seq {
+			return n
+		}
+	}
+	return -1
+}
+
+// newEchoRequestPdu builds an echo request with opts.Size random data bytes
+func newEchoRequestPdu(dstIP net.IP, opts PingOptions, id, seq uint16) *IPv4Pdu {
+	icmpPacket := ICMPPacket{
+		IcmpType: IcmpTypeEchoRequest,
+		Id:       id,
+		Seq:      seq,
+		Data:     make([]byte, opts.Size),
+	}
+
+	_, _ = rand.Read(icmpPacket.Data)
+
+	// never returns an error
+	icmpBinary, _ := icmpPacket.MarshalBinary()
+
+	ipPdu := NewIPv4Pdu(opts.Source, dstIP, IPProtocolICMPv4, icmpBinary)
+	if opts.TTL != 0 {
+		ipPdu.TTL = opts.TTL
+	}
+	if opts.RecordRoute {
+		ipPdu.Options = NewRecordRouteOption()
+	}
+	return ipPdu
+}
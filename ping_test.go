@@ -0,0 +1,183 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIcmpHandler_Ping(t *testing.T) {
+	tests := map[string]struct {
+		dstIP       net.IP
+		ttl         uint8
+		size        int
+		wantSrc     net.IP
+		wantType    edurouter.IcmpType
+		wantCode    uint8
+		wantErrors  int
+		wantReceive int
+	}{
+		"EchoReply": {
+			dstIP:       net.IP{10, 0, 2, 2},
+			wantSrc:     net.IP{10, 0, 2, 2},
+			wantType:    edurouter.IcmpTypeEchoReply,
+			wantReceive: 3,
+		},
+		"OddSize": {
+			dstIP:       net.IP{10, 0, 2, 2},
+			size:        57,
+			wantSrc:     net.IP{10, 0, 2, 2},
+			wantType:    edurouter.IcmpTypeEchoReply,
+			wantReceive: 3,
+		},
+		"TimeExceeded": {
+			dstIP:      net.IP{10, 0, 2, 2},
+			ttl:        1,
+			wantSrc:    net.IP{10, 0, 1, 2},
+			wantType:   edurouter.IcmpTypeTimeExceeded,
+			wantCode:   edurouter.IcmpCodeTTLExceeded,
+			wantErrors: 3,
+		},
+		"HostUnreachable": {
+			dstIP:      net.IP{10, 0, 2, 50},
+			wantSrc:    net.IP{10, 0, 1, 2},
+			wantType:   edurouter.IcmpTypeDestinationUnreachable,
+			wantCode:   edurouter.IcmpCodeHostUnreachable,
+			wantErrors: 3,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r1 := newRouterChain(t, ctx)
+
+			opts := edurouter.DefaultPingOptions
+			opts.Count = 3
+			opts.Interval = 20 * time.Millisecond
+			opts.Size = 100
+			if v.size != 0 {
+				opts.Size = v.size
+			}
+			opts.TTL = v.ttl
+
+			var replies []edurouter.PingReply
+			stats, err := r1.listener.Ping(ctx, v.dstIP, opts, func(r edurouter.PingReply) {
+				replies = append(replies, r)
+			})
+			require.NoError(t, err)
+
+			require.Len(t, replies, 3)
+			for n, r := range replies {
+				assert.EqualValues(t, n+1, r.Seq)
+				assert.EqualValues(t, v.wantSrc, r.Src)
+				assert.Equal(t, v.wantType, r.Type)
+				assert.Equal(t, v.wantCode, r.Code)
+				assert.Greater(t, r.RTT, time.Duration(0))
+			}
+
+			assert.Equal(t, 3, stats.Transmitted)
+			assert.Equal(t, v.wantReceive, stats.Received)
+			assert.Equal(t, v.wantErrors, stats.Errors)
+			assert.InDelta(t, float64(3-v.wantReceive)*100/3, stats.Loss(), 0.01)
+
+			if v.wantReceive > 0 {
+				assert.Equal(t, 8+opts.Size, replies[0].Length)
+				assert.LessOrEqual(t, stats.Min, stats.Avg)
+				assert.LessOrEqual(t, stats.Avg, stats.Max)
+				assert.Greater(t, stats.Min, time.Duration(0))
+			}
+		})
+	}
+}
+
+func TestIcmpHandler_PingTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1 := newRouterChain(t, ctx)
+
+	// nobody answers on the first segment, and no ICMP errors are sent about local packets
+	opts := edurouter.DefaultPingOptions
+	opts.Count = 2
+	opts.Interval = 10 * time.Millisecond
+	opts.Timeout = 50 * time.Millisecond
+
+	var replies []edurouter.PingReply
+	stats, err := r1.listener.Ping(ctx, net.IP{10, 0, 0, 50}, opts, func(r edurouter.PingReply) {
+		replies = append(replies, r)
+	})
+	require.NoError(t, err)
+
+	require.Len(t, replies, 2)
+	for n, r := range replies {
+		assert.EqualValues(t, n+1, r.Seq)
+		assert.True(t, r.TimedOut())
+	}
+
+	assert.Equal(t, edurouter.PingStatistics{Transmitted: 2, Elapsed: stats.Elapsed}, stats)
+	assert.Equal(t, float64(100), stats.Loss())
+}
+
+func TestIcmpHandler_PingDeadlineAndFlood(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1 := newRouterChain(t, ctx)
+
+	opts := edurouter.DefaultPingOptions
+	opts.Count = 0
+	opts.Interval = 50 * time.Millisecond
+	opts.Deadline = 175 * time.Millisecond
+
+	stats, err := r1.listener.Ping(ctx, net.IP{10, 0, 2, 2}, opts, nil)
+	require.NoError(t, err)
+	// requests at 0, 50, 100 and 150ms, the last one may be late on a busy machine
+	assert.GreaterOrEqual(t, stats.Transmitted, 3)
+	assert.LessOrEqual(t, stats.Transmitted, 4)
+	assert.Less(t, stats.Elapsed, time.Second)
+
+	opts = edurouter.DefaultPingOptions
+	opts.Count = 50
+	opts.Flood = true
+
+	stats, err = r1.listener.Ping(ctx, net.IP{10, 0, 2, 2}, opts, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 50, stats.Transmitted)
+	assert.Equal(t, 50, stats.Received)
+	// one request per second would take 50 seconds
+	assert.Less(t, stats.Elapsed, 5*time.Second)
+}
+
+func TestIcmpHandler_PingInvalidOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r1 := newRouterChain(t, ctx)
+
+	opts := edurouter.DefaultPingOptions
+	opts.Size = 70000
+	_, err := r1.listener.Ping(ctx, net.IP{10, 0, 2, 2}, opts, nil)
+	assert.ErrorIs(t, err, edurouter.ErrPingSizeTooLarge)
+
+	opts = edurouter.DefaultPingOptions
+	opts.Interval = 0
+	_, err = r1.listener.Ping(ctx, net.IP{10, 0, 2, 2}, opts, nil)
+	assert.ErrorIs(t, err, edurouter.ErrInvalidPingInterval)
+
+	opts = edurouter.DefaultPingOptions
+	opts.Timeout = 0
+	_, err = r1.listener.Ping(ctx, net.IP{10, 0, 2, 2}, opts, nil)
+	assert.ErrorIs(t, err, edurouter.ErrInvalidPingTimeout)
+
+	opts = edurouter.DefaultPingOptions
+	opts.Count = -1
+	_, err = r1.listener.Ping(ctx, net.IP{10, 0, 2, 2}, opts, nil)
+	assert.ErrorIs(t, err, edurouter.ErrInvalidPingCount)
+}
@@ -0,0 +1,174 @@
+package edurouter
+
+import (
+	"github.com/mdlayher/ethernet"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ReplayFrameTransport feeds the frames of a capture file into an InterfaceConfig as if they arrived on the wire.
+// Frames written by the router are collected into a pcap file, if an output is given.
+// Once all frames are replayed, the transport stays open until it is closed.
+type ReplayFrameTransport struct {
+	in       PacketReader
+	out      *PcapWriter
+	closers  []io.Closer
+	hwAddr   net.HardwareAddr
+	realtime bool
+	frames   chan []byte
+	finished chan struct{}
+	done     chan struct{}
+
+	closeOnce sync.Once
+	mu        sync.Mutex
+}
+
+// NewReplayFrameTransport replays the pcap or pcapng stream in. If realtime is set, the original timing
+// between frames is honoured, otherwise frames are replayed as fast as possible.
+// out may be nil. in and out are closed with the transport if they implement io.Closer.
+func NewReplayFrameTransport(in io.Reader, out io.Writer, hwAddr net.HardwareAddr, realtime bool) (*ReplayFrameTransport, error) {
+	reader, err := NewPacketReader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &ReplayFrameTransport{
+		in:       reader,
+		hwAddr:   hwAddr,
+		realtime: realtime,
+		frames:   make(chan []byte),
+		finished: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if c, ok := in.(io.Closer); ok {
+		t.closers = append(t.closers, c)
+	}
+
+	if out != nil {
+		t.out, err = NewPcapWriter(out)
+		if err != nil {
+			return nil, err
+		}
+
+		if c, ok := out.(io.Closer); ok {
+			t.closers = append(t.closers, c)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *ReplayFrameTransport) Open(etherTypes []ethernet.EtherType) error {
+	filter := map[ethernet.EtherType]bool{}
+	for _, etherType := range etherTypes {
+		filter[etherType] = true
+	}
+
+	go t.replay(filter)
+	return nil
+}
+
+func (t *ReplayFrameTransport) replay(filter map[ethernet.EtherType]bool) {
+	defer close(t.finished)
+
+	var previous time.Time
+
+	for {
+		packet, err := t.in.ReadPacket()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			Logger(LogSubsystemIface).Error().Msgf("error reading replay capture: %v", err)
+			return
+		}
+
+		if len(packet.Data) < ethernetHeaderLength {
+			continue
+		}
+
+		etherType := ethernet.EtherType(uint16(packet.Data[12])<<8 | uint16(packet.Data[13]))
+		if !filter[etherType] {
+			continue
+		}
+
+		if t.realtime && !previous.IsZero() && packet.Timestamp.After(previous) {
+			select {
+			case <-time.After(packet.Timestamp.Sub(previous)):
+			case <-t.done:
+				return
+			}
+		}
+		previous = packet.Timestamp
+
+		select {
+		case t.frames <- packet.Data:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Finished is closed once all frames of the capture have been read by the router
+func (t *ReplayFrameTransport) Finished() <-chan struct{} {
+	return t.finished
+}
+
+func (t *ReplayFrameTransport) ReadFrame(b []byte) (int, error) {
+	select {
+	case frame := <-t.frames:
+		return copy(b, frame), nil
+	case <-t.done:
+		return 0, ErrFrameTransportClosed
+	}
+}
+
+func (t *ReplayFrameTransport) WriteFrame(b []byte) error {
+	if len(b) < ethernetHeaderLength {
+		return ErrFrameTooShort
+	}
+
+	select {
+	case <-t.done:
+		return ErrFrameTransportClosed
+	default:
+	}
+
+	if t.out == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.out.WritePacket(time.Now(), b)
+}
+
+func (t *ReplayFrameTransport) HardwareAddr() net.HardwareAddr {
+	return t.hwAddr
+}
+
+func (t *ReplayFrameTransport) MTU() int {
+	return pcapMaxSnapLength - ethernetHeaderLength
+}
+
+func (t *ReplayFrameTransport) Close() error {
+	var err error
+
+	t.closeOnce.Do(func() {
+		close(t.done)
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		for _, c := range t.closers {
+			if closeErr := c.Close(); closeErr != nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
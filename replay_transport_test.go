@@ -0,0 +1,194 @@
+package edurouter_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer which can be read while the router writes to it
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte{}, b.buf.Bytes()...)
+}
+
+func readAllPackets(t *testing.T, b []byte) []edurouter.PcapPacket {
+	r, err := edurouter.NewPacketReader(bytes.NewReader(b))
+	require.NoError(t, err)
+
+	var packets []edurouter.PcapPacket
+	for {
+		p, err := r.ReadPacket()
+		if err == io.EOF {
+			return packets
+		}
+		require.NoError(t, err)
+		packets = append(packets, p)
+	}
+}
+
+func TestReplayFrameTransport_ARPAndICMP(t *testing.T) {
+	routerHwAddr := net.HardwareAddr{2, 0, 0, 0, 1, 0}
+	hostHwAddr := net.HardwareAddr{2, 0, 0, 0, 0, 100}
+	routerIP := net.IP{10, 0, 0, 1}
+	hostIP := net.IP{10, 0, 0, 2}
+
+	var in bytes.Buffer
+	w, err := edurouter.NewPcapWriter(&in)
+	require.NoError(t, err)
+
+	arpRequest := edurouter.ARPv4Pdu{
+		HTYPE:           edurouter.HTYPEEthernet,
+		PTYPE:           ethernet.EtherTypeIPv4,
+		HLEN:            edurouter.HardwareAddrLen,
+		PLEN:            net.IPv4len,
+		Operation:       edurouter.ARPOperationRequest,
+		SrcHardwareAddr: hostHwAddr,
+		SrcProtoAddr:    hostIP,
+		DstHardwareAddr: edurouter.EmptyHardwareAddr,
+		DstProtoAddr:    routerIP,
+	}
+	arpBinary, err := arpRequest.MarshalBinary()
+	require.NoError(t, err)
+
+	arpFrame, err := (&ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      hostHwAddr,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     arpBinary,
+	}).MarshalBinary()
+	require.NoError(t, err)
+
+	icmpRequest := edurouter.ICMPPacket{
+		IcmpType: edurouter.IcmpTypeEchoRequest,
+		Id:       7,
+		Seq:      1,
+		Data:     []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	icmpBinary, err := icmpRequest.MarshalBinary()
+	require.NoError(t, err)
+
+	ipPdu := edurouter.NewIPv4Pdu(hostIP, routerIP, edurouter.IPProtocolICMPv4, icmpBinary)
+	ipPdu.TTL = edurouter.DefaultIPv4TTL
+	ipBinary, err := ipPdu.MarshalBinary()
+	require.NoError(t, err)
+
+	icmpFrame, err := (&ethernet.Frame{
+		Destination: routerHwAddr,
+		Source:      hostHwAddr,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     ipBinary,
+	}).MarshalBinary()
+	require.NoError(t, err)
+
+	ts := time.Unix(1700000000, 0)
+	require.NoError(t, w.WritePacket(ts, arpFrame))
+	require.NoError(t, w.WritePacket(ts.Add(time.Millisecond), icmpFrame))
+
+	var out syncBuffer
+	transport, err := edurouter.NewReplayFrameTransport(&in, &out, routerHwAddr, false)
+	require.NoError(t, err)
+
+	config, err := edurouter.NewInterfaceConfig("eth0", &net.IPNet{IP: routerIP, Mask: net.CIDRMask(24, 32)})
+	require.NoError(t, err)
+	config.Transport = transport
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listener := edurouter.NewLinkLayerListener(config)
+	go listener.ListenAndServe(ctx)
+
+	select {
+	case <-transport.Finished():
+	case <-time.After(time.Second):
+		t.Fatal("replay did not finish")
+	}
+
+	var packets []edurouter.PcapPacket
+	require.Eventually(t, func() bool {
+		packets = readAllPackets(t, out.Bytes())
+		return len(packets) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	var gotArpReply, gotEchoReply bool
+
+	for _, p := range packets {
+		var f ethernet.Frame
+		require.NoError(t, (&f).UnmarshalBinary(p.Data))
+		assert.EqualValues(t, routerHwAddr, f.Source)
+		assert.EqualValues(t, hostHwAddr, f.Destination)
+
+		switch f.EtherType {
+		case ethernet.EtherTypeARP:
+			var arpReply edurouter.ARPv4Pdu
+			require.NoError(t, (&arpReply).UnmarshalBinary(f.Payload))
+			assert.EqualValues(t, edurouter.ARPOperationResponse, arpReply.Operation)
+			assert.EqualValues(t, routerIP, arpReply.SrcProtoAddr)
+			gotArpReply = true
+
+		case ethernet.EtherTypeIPv4:
+			var ipReply edurouter.IPv4Pdu
+			require.NoError(t, (&ipReply).UnmarshalBinary(f.Payload))
+
+			var icmpReply edurouter.ICMPPacket
+			require.NoError(t, (&icmpReply).UnmarshalBinary(ipReply.Payload))
+			assert.EqualValues(t, edurouter.IcmpTypeEchoReply, icmpReply.IcmpType)
+			assert.EqualValues(t, icmpRequest.Id, icmpReply.Id)
+			gotEchoReply = true
+		}
+	}
+
+	assert.True(t, gotArpReply)
+	assert.True(t, gotEchoReply)
+}
+
+func TestReplayFrameTransport_Realtime(t *testing.T) {
+	var in bytes.Buffer
+	w, err := edurouter.NewPcapWriter(&in)
+	require.NoError(t, err)
+
+	frame := make([]byte, 60)
+	frame[12] = 0x08
+	frame[13] = 0x06
+
+	ts := time.Unix(1700000000, 0)
+	require.NoError(t, w.WritePacket(ts, frame))
+	require.NoError(t, w.WritePacket(ts.Add(200*time.Millisecond), frame))
+
+	transport, err := edurouter.NewReplayFrameTransport(&in, nil, edurouter.RandomHardwareAddr(), true)
+	require.NoError(t, err)
+	defer transport.Close()
+
+	require.NoError(t, transport.Open([]ethernet.EtherType{ethernet.EtherTypeARP}))
+
+	b := make([]byte, transport.MTU())
+	start := time.Now()
+
+	_, err = transport.ReadFrame(b)
+	require.NoError(t, err)
+	_, err = transport.ReadFrame(b)
+	require.NoError(t, err)
+
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
@@ -87,17 +87,22 @@ func (table *RouteTable) AddRoute(config RouteInfo) error {
 	table.mu.Lock()
 	defer table.mu.Unlock()
 
-	table.configuredRoutes = append(table.configuredRoutes, config)
+	// prepend, so that newer routes come first among equally exact ones
+	table.configuredRoutes = append([]RouteInfo{config}, table.configuredRoutes...)
 
 	// sort slice by most exact match
 	sort.SliceStable(table.configuredRoutes, func(i, j int) bool {
 		netMaskIPi := binary.BigEndian.Uint32(table.configuredRoutes[i].DstNet.Mask)
 		netMaskIPj := binary.BigEndian.Uint32(table.configuredRoutes[j].DstNet.Mask)
 
-		return table.configuredRoutes[i].RouteType < table.configuredRoutes[j].RouteType || // ascending by route type (pseudo-metric)
+		if netMaskIPi != netMaskIPj {
 			// inverse netMask meaning more exact match
 			// a /16 is more important than a /8
-			(netMaskIPi > netMaskIPj)
+			return netMaskIPi > netMaskIPj
+		}
+
+		// ascending by route type (pseudo-metric) among equally exact routes
+		return table.configuredRoutes[i].RouteType < table.configuredRoutes[j].RouteType
 	})
 	return nil
 }
@@ -125,11 +130,15 @@ func (table *RouteTable) DeleteRouteAtIndex(index uint) {
 }
 
 func (table *RouteTable) getRouteInfoForPacket(ip *IPv4Pdu) (*RouteInfo, error) {
+	return table.getRouteInfoForIP(ip.DstIP)
+}
+
+func (table *RouteTable) getRouteInfoForIP(dstIP net.IP) (*RouteInfo, error) {
 	table.mu.RLock()
 	defer table.mu.RUnlock()
 
 	for _, ri := range table.configuredRoutes {
-		if bytes.Equal(ip.DstIP.Mask(ri.DstNet.Mask), ri.DstNet.IP) {
+		if bytes.Equal(dstIP.Mask(ri.DstNet.Mask), ri.DstNet.IP) {
 			// dst ip of the packet is inside this configured route table entries destination network
 			return &ri, nil
 		}
@@ -138,25 +147,41 @@ func (table *RouteTable) getRouteInfoForPacket(ip *IPv4Pdu) (*RouteInfo, error)
 	return nil, ErrNoRoute
 }
 
+// RoutePacket looks up the route of a forwarded packet and decrements its TTL.
+// It returns ErrTTLExceeded if the TTL expires. Packets without source address are routed with RouteLocalPacket.
 func (table *RouteTable) RoutePacket(ip IPv4Pdu) (*IPv4Pdu, *RouteInfo, error) {
+	if ip.SrcIP == nil {
+		return table.RouteLocalPacket(ip)
+	}
+
 	ri, err := table.getRouteInfoForPacket(&ip)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	if ip.TTL <= 1 {
+		// time to live ended, the packet must not be forwarded
+		return nil, nil, ErrTTLExceeded
+	}
+	ip.TTL--
+
+	return &ip, ri, nil
+}
+
+// RouteLocalPacket looks up the route of a packet originated by the router, its TTL is not decremented.
+// The source address defaults to the address of the outgoing interface, the TTL to DefaultIPv4TTL.
+func (table *RouteTable) RouteLocalPacket(ip IPv4Pdu) (*IPv4Pdu, *RouteInfo, error) {
+	ri, err := table.getRouteInfoForPacket(&ip)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	if ip.SrcIP == nil {
-		// local originating traffic
-
 		ip.SrcIP = ri.OutInterface.Addr.IP
-		ip.TTL = DefaultIPv4TTL
-	} else {
-		ip.TTL--
 	}
 
 	if ip.TTL == 0 {
-		// time to live ended, dropping
-		return nil, nil, ErrDropPdu
+		ip.TTL = DefaultIPv4TTL
 	}
 
 	return &ip, ri, nil
@@ -227,6 +227,95 @@ func TestRouteTable_AddRoute(t *testing.T) {
 		actualRoutes := rt.GetRoutes()
 		assert.EqualValues(t, []RouteInfo{ri4, ri2, ri1, ri3}, actualRoutes)
 	})
+
+	t.Run("StaticRouteInsideLinkLocalNetwork", func(t *testing.T) {
+		rt := NewRouteTable()
+
+		outIface, err := NewInterfaceConfig("veth0", &net.IPNet{
+			IP:   net.IP{192, 168, 0, 1},
+			Mask: net.CIDRMask(24, 32),
+		})
+		require.NoError(t, err)
+
+		ri1 := RouteInfo{
+			RouteType: LinkLocalRouteType,
+			DstNet: net.IPNet{
+				IP:   net.IP{192, 168, 0, 0},
+				Mask: net.CIDRMask(24, 32),
+			},
+			OutInterface: outIface,
+		}
+		require.NoError(t, rt.AddRoute(ri1))
+
+		nextHop := net.IP{192, 168, 0, 100}
+		ri2 := RouteInfo{
+			RouteType: StaticRouteType,
+			DstNet: net.IPNet{
+				IP:   net.IP{192, 168, 0, 128},
+				Mask: net.CIDRMask(25, 32),
+			},
+			OutInterface: outIface,
+			NextHop:      &nextHop,
+		}
+		require.NoError(t, rt.AddRoute(ri2))
+
+		// the longest prefix wins, no matter the route type
+		assert.EqualValues(t, []RouteInfo{ri2, ri1}, rt.GetRoutes())
+
+		routeInfo, err := rt.getRouteInfoForPacket(NewIPv4Pdu(nil, net.IP{192, 168, 0, 200}, IPProtocolICMPv4, nil))
+		require.NoError(t, err)
+		assert.EqualValues(t, ri2, *routeInfo)
+
+		routeInfo, err = rt.getRouteInfoForPacket(NewIPv4Pdu(nil, net.IP{192, 168, 0, 20}, IPProtocolICMPv4, nil))
+		require.NoError(t, err)
+		assert.EqualValues(t, ri1, *routeInfo)
+	})
+
+	t.Run("LinkLocalBeforeStaticAmongEquallyExact", func(t *testing.T) {
+		rt := NewRouteTable()
+
+		outIface, err := NewInterfaceConfig("veth0", &net.IPNet{
+			IP:   net.IP{192, 168, 0, 1},
+			Mask: net.CIDRMask(24, 32),
+		})
+		require.NoError(t, err)
+
+		nextHop := net.IP{192, 168, 0, 100}
+		ri1 := RouteInfo{
+			RouteType: StaticRouteType,
+			DstNet: net.IPNet{
+				IP:   net.IP{10, 0, 0, 0},
+				Mask: net.CIDRMask(8, 32),
+			},
+			OutInterface: outIface,
+			NextHop:      &nextHop,
+		}
+		require.NoError(t, rt.AddRoute(ri1))
+
+		ri2 := RouteInfo{
+			RouteType: LinkLocalRouteType,
+			DstNet: net.IPNet{
+				IP:   net.IP{192, 168, 0, 0},
+				Mask: net.CIDRMask(24, 32),
+			},
+			OutInterface: outIface,
+		}
+		require.NoError(t, rt.AddRoute(ri2))
+
+		ri3 := RouteInfo{
+			RouteType: StaticRouteType,
+			DstNet: net.IPNet{
+				IP:   net.IP{192, 168, 0, 0},
+				Mask: net.CIDRMask(24, 32),
+			},
+			OutInterface: outIface,
+			NextHop:      &nextHop,
+		}
+		require.NoError(t, rt.AddRoute(ri3))
+
+		// a static /24 added later does not shadow the link local /24, the /8 stays last
+		assert.EqualValues(t, []RouteInfo{ri2, ri3, ri1}, rt.GetRoutes())
+	})
 }
 
 func TestRouteTable_GetRoutes(t *testing.T) {
@@ -364,18 +453,18 @@ func TestRouteTable_DeleteRouteAtIndex(t *testing.T) {
 }
 
 func TestRouteTable_RoutePacket(t *testing.T) {
-	t.Run("NoRoutesDropPacket", func(t *testing.T) {
+	t.Run("NoRoute", func(t *testing.T) {
 		rt := NewRouteTable()
 
 		packet := NewIPv4Pdu([]byte{192, 168, 1, 10}, []byte{192, 168, 2, 20}, IPProtocolICMPv4, []byte{})
 
-		packet, routeInfo, err := rt.RoutePacket(packet)
-		assert.EqualError(t, err, ErrDropPdu.Error())
+		packet, routeInfo, err := rt.RoutePacket(*packet)
+		assert.ErrorIs(t, err, ErrNoRoute)
 		assert.Nil(t, routeInfo)
 		assert.Nil(t, packet)
 	})
 
-	t.Run("PacketTTLIsZeroDropPacket", func(t *testing.T) {
+	t.Run("PacketTTLExceeded", func(t *testing.T) {
 		rt := NewRouteTable()
 
 		nextHop := net.IP([]byte{192, 168, 10, 100})
@@ -400,8 +489,8 @@ func TestRouteTable_RoutePacket(t *testing.T) {
 		packet := NewIPv4Pdu([]byte{192, 168, 1, 10}, []byte{192, 168, 0, 20}, IPProtocolICMPv4, []byte{})
 		packet.TTL = 1
 
-		packet, routeInfo, err := rt.RoutePacket(packet)
-		assert.EqualError(t, err, ErrDropPdu.Error())
+		packet, routeInfo, err := rt.RoutePacket(*packet)
+		assert.ErrorIs(t, err, ErrTTLExceeded)
 		assert.Nil(t, routeInfo)
 		assert.Nil(t, packet)
 	})
@@ -430,9 +519,37 @@ func TestRouteTable_RoutePacket(t *testing.T) {
 
 		packet := NewIPv4Pdu([]byte{192, 168, 1, 10}, []byte{192, 168, 0, 20}, IPProtocolICMPv4, []byte{})
 
-		packet, routeInfo, err := rt.RoutePacket(packet)
+		packet, routeInfo, err := rt.RoutePacket(*packet)
 		assert.NoError(t, err)
 		assert.EqualValues(t, ri1, *routeInfo)
 		assert.EqualValues(t, 63, packet.TTL)
 	})
+
+	t.Run("LocalPacket", func(t *testing.T) {
+		rt := NewRouteTable()
+
+		outIface, err := NewInterfaceConfig("veth0", &net.IPNet{
+			IP:   net.IP{192, 168, 0, 1},
+			Mask: net.CIDRMask(24, 32),
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, rt.AddRoute(RouteInfo{
+			RouteType: LinkLocalRouteType,
+			DstNet: net.IPNet{
+				IP:   net.IP{192, 168, 0, 0},
+				Mask: net.CIDRMask(24, 32),
+			},
+			OutInterface: outIface,
+		}))
+
+		packet := NewIPv4Pdu(nil, []byte{192, 168, 0, 20}, IPProtocolICMPv4, []byte{})
+		packet.TTL = 1
+
+		// the TTL of locally originated packets is not decremented
+		packet, _, err = rt.RouteLocalPacket(*packet)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, packet.TTL)
+		assert.EqualValues(t, outIface.Addr.IP, packet.SrcIP)
+	})
 }
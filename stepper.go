@@ -0,0 +1,211 @@
+package edurouter
+
+import (
+	"context"
+	"fmt"
+	"github.com/mdlayher/ethernet"
+	"sync"
+)
+
+type StepAction uint8
+
+const (
+	// StepNext lets the packet run to the next handler boundary
+	StepNext StepAction = 0
+	// StepContinue lets the packet run through the router without pausing again
+	StepContinue StepAction = 1
+	// StepDrop discards the packet
+	StepDrop StepAction = 2
+)
+
+func (a StepAction) String() string {
+	switch a {
+	case StepNext:
+		return "next"
+	case StepContinue:
+		return "continue"
+	case StepDrop:
+		return "drop"
+	default:
+		return ""
+	}
+}
+
+// Breakpoint is a packet paused at a handler boundary, waiting for a StepAction
+type Breakpoint struct {
+	Trace *PacketTrace
+	Stage TraceStage
+	// PDU describes the packet as it is passed on to the next handler
+	PDU string
+
+	action chan StepAction
+}
+
+const stepperNotifyQueueLength = 64
+
+// Stepper pauses packets at every handler boundary while step mode is enabled.
+// The handler goroutine of a paused packet blocks until the packet is resumed, so packets behind it wait as well.
+type Stepper struct {
+	enabled bool
+	filter  *CaptureFilter
+	waiting []*Breakpoint
+	notify  chan *Breakpoint
+	mu      sync.Mutex
+}
+
+func NewStepper() *Stepper {
+	return &Stepper{
+		notify: make(chan *Breakpoint, stepperNotifyQueueLength),
+	}
+}
+
+// Enable turns step mode on for all frames received from now on which match the filter.
+// Packets originated by the router are matched as if they were sent without ethernet addresses.
+// A nil filter selects all packets.
+func (s *Stepper) Enable(filter *CaptureFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enabled = true
+	s.filter = filter
+}
+
+// Disable turns step mode off and lets all paused packets continue
+func (s *Stepper) Disable() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enabled = false
+
+	for _, b := range s.waiting {
+		b.action <- StepContinue
+	}
+	s.waiting = nil
+}
+
+func (s *Stepper) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enabled
+}
+
+// Breakpoints delivers every breakpoint when it is hit.
+// Breakpoints are dropped if they are not received fast enough, Current always returns the oldest one.
+func (s *Stepper) Breakpoints() <-chan *Breakpoint {
+	return s.notify
+}
+
+// Current returns the oldest paused packet, or nil if no packet is waiting
+func (s *Stepper) Current() *Breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.waiting) == 0 {
+		return nil
+	}
+	return s.waiting[0]
+}
+
+// Resume resolves the oldest breakpoint with the given action
+func (s *Stepper) Resume(action StepAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.waiting) == 0 {
+		return ErrNoBreakpoint
+	}
+
+	b := s.waiting[0]
+	s.waiting = s.waiting[1:]
+
+	b.action <- action
+	return nil
+}
+
+// selects reports whether a packet entering the router is paused at its handler boundaries
+func (s *Stepper) selects(frame CapturedFrame) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.enabled {
+		return false
+	}
+	return s.filter == nil || s.filter.Match(frame)
+}
+
+// pause blocks until the breakpoint is resolved. Packets are dropped if ctx is done.
+func (s *Stepper) pause(ctx context.Context, trace *PacketTrace, stage TraceStage, pdu string) StepAction {
+	b := &Breakpoint{
+		Trace:  trace,
+		Stage:  stage,
+		PDU:    pdu,
+		action: make(chan StepAction, 1),
+	}
+
+	s.mu.Lock()
+	if !s.enabled {
+		s.mu.Unlock()
+		return StepContinue
+	}
+	s.waiting = append(s.waiting, b)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- b:
+	default:
+	}
+
+	select {
+	case action := <-b.action:
+		return action
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for i, w := range s.waiting {
+			if w == b {
+				s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+				return StepDrop
+			}
+		}
+
+		// resolved concurrently
+		return <-b.action
+	}
+}
+
+// localCapturedFrame wraps a packet originated by the router, so it can be matched by a CaptureFilter
+func localCapturedFrame(packet *IPv4Pdu) CapturedFrame {
+	payload, _ := packet.MarshalBinary()
+
+	data, _ := (&ethernet.Frame{
+		Destination: EmptyHardwareAddr,
+		Source:      EmptyHardwareAddr,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     payload,
+	}).MarshalBinary()
+
+	return CapturedFrame{
+		InterfaceName: "local",
+		Direction:     FrameDirectionOut,
+		Data:          data,
+	}
+}
+
+func describeIPv4(packet *IPv4Pdu) string {
+	return fmt.Sprintf("%s, ttl %d", summarizeIPv4(packet), packet.TTL)
+}
+
+func describeOutFrame(f *ethernet.Frame, iface *InterfaceConfig) string {
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return err.Error()
+	}
+
+	return SummarizeFrame(CapturedFrame{
+		InterfaceName: iface.InterfaceName,
+		Direction:     FrameDirectionOut,
+		Data:          data,
+	})
+}
@@ -0,0 +1,124 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+type steppingSetup struct {
+	*twoSegmentSetup
+	stepper *edurouter.Stepper
+}
+
+// newSteppingSetup creates a router forwarding from 10.0.0.0/24 on eth0 to 10.0.1.5 on eth1
+func newSteppingSetup(t *testing.T, ctx context.Context) *steppingSetup {
+	s := newTwoSegmentSetup(t, ctx, net.IP{10, 0, 1, 5})
+
+	return &steppingSetup{
+		twoSegmentSetup: s,
+		stepper:         s.router.listener.Stepper(),
+	}
+}
+
+func (s *steppingSetup) sendPacket(t *testing.T) {
+	ipPdu := edurouter.NewIPv4Pdu(s.hostIP, s.receiverIP, edurouter.IPProtocolUDP, []byte{1, 2, 3, 4})
+	ipPdu.TTL = edurouter.DefaultIPv4TTL
+	s.sendPdu(t, ipPdu)
+}
+
+func (s *steppingSetup) nextBreakpoint(t *testing.T) *edurouter.Breakpoint {
+	select {
+	case b := <-s.stepper.Breakpoints():
+		assert.Same(t, b, s.stepper.Current())
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("no breakpoint hit")
+		return nil
+	}
+}
+
+func TestStepper_Next(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newSteppingSetup(t, ctx)
+	s.stepper.Enable(nil)
+	s.sendPacket(t)
+
+	wantStages := []edurouter.TraceStage{
+		edurouter.TraceStageLinkLayer,
+		edurouter.TraceStageIPv4Input,
+		edurouter.TraceStageInternet,
+		edurouter.TraceStageOutput,
+	}
+
+	for _, stage := range wantStages {
+		b := s.nextBreakpoint(t)
+		assert.Equal(t, stage, b.Stage)
+
+		// the packet must not leave the router before the last step
+		assert.Nil(t, receiveFrame(s.receiverFrames, 10*time.Millisecond))
+		require.NoError(t, s.stepper.Resume(edurouter.StepNext))
+	}
+
+	assert.NotNil(t, receiveFrame(s.receiverFrames, time.Second))
+	assert.ErrorIs(t, s.stepper.Resume(edurouter.StepNext), edurouter.ErrNoBreakpoint)
+}
+
+func TestStepper_ContinueAndDrop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newSteppingSetup(t, ctx)
+	s.stepper.Enable(nil)
+
+	s.sendPacket(t)
+	b := s.nextBreakpoint(t)
+	assert.Contains(t, b.PDU, "eth0 in IP 10.0.0.2 > 10.0.1.5: UDP")
+	require.NoError(t, s.stepper.Resume(edurouter.StepContinue))
+	assert.NotNil(t, receiveFrame(s.receiverFrames, time.Second))
+
+	s.sendPacket(t)
+	s.nextBreakpoint(t)
+	require.NoError(t, s.stepper.Resume(edurouter.StepNext))
+
+	b = s.nextBreakpoint(t)
+	assert.Equal(t, edurouter.TraceStageIPv4Input, b.Stage)
+	assert.Contains(t, b.PDU, "IP 10.0.0.2 > 10.0.1.5: UDP")
+	assert.Contains(t, b.PDU, "ttl 64")
+	require.NoError(t, s.stepper.Resume(edurouter.StepDrop))
+
+	assert.Nil(t, receiveFrame(s.receiverFrames, 100*time.Millisecond))
+
+	events := b.Trace.Events()
+	assert.Equal(t, "dropped in step mode", events[len(events)-1].Message)
+}
+
+func TestStepper_FilterAndDisable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newSteppingSetup(t, ctx)
+
+	filter, err := edurouter.ParseCaptureFilter("icmp")
+	require.NoError(t, err)
+	s.stepper.Enable(filter)
+
+	// UDP is not selected by the filter
+	s.sendPacket(t)
+	assert.NotNil(t, receiveFrame(s.receiverFrames, time.Second))
+	assert.Nil(t, s.stepper.Current())
+
+	s.stepper.Enable(nil)
+	s.sendPacket(t)
+	s.nextBreakpoint(t)
+
+	s.stepper.Disable()
+	assert.NotNil(t, receiveFrame(s.receiverFrames, time.Second))
+	assert.False(t, s.stepper.Enabled())
+}
@@ -0,0 +1,169 @@
+package edurouter
+
+import (
+	"errors"
+	"github.com/mdlayher/ethernet"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"sync"
+)
+
+const tunDevicePath = "/dev/net/tun"
+
+// TapFrameTransport creates and owns a Linux TAP device.
+// The kernel sees the device as a regular NIC, while edurouter sits on the "wire" side of it
+// using its own hardware address. The device is removed by the kernel once the transport is closed.
+type TapFrameTransport struct {
+	interfaceName string
+	hwAddr        net.HardwareAddr
+	mtu           int
+	etherTypes    map[ethernet.EtherType]bool
+	file          *os.File
+	closeOnce     sync.Once
+}
+
+// NewTapFrameTransport prepares a TAP device with the given name.
+// The device uses a random, locally administered hardware address.
+func NewTapFrameTransport(interfaceName string) *TapFrameTransport {
+	return &TapFrameTransport{
+		interfaceName: interfaceName,
+		hwAddr:        RandomHardwareAddr(),
+	}
+}
+
+func (t *TapFrameTransport) Open(etherTypes []ethernet.EtherType) error {
+	// non-blocking, so that the runtime poller is used and Close interrupts pending reads
+	fd, err := unix.Open(tunDevicePath, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+
+	ifr, err := unix.NewIfreq(t.interfaceName)
+	if err != nil {
+		_ = unix.Close(fd)
+		return err
+	}
+
+	// ethernet frames without the additional packet information header
+	ifr.SetUint16(unix.IFF_TAP | unix.IFF_NO_PI)
+
+	err = unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr)
+	if err != nil {
+		_ = unix.Close(fd)
+		return err
+	}
+
+	// the kernel may have chosen the name, e.g. for "tap%d"
+	t.interfaceName = ifr.Name()
+
+	err = setInterfaceUp(t.interfaceName)
+	if err != nil {
+		_ = unix.Close(fd)
+		return err
+	}
+
+	ifi, err := net.InterfaceByName(t.interfaceName)
+	if err != nil {
+		_ = unix.Close(fd)
+		return err
+	}
+	t.mtu = ifi.MTU
+
+	t.etherTypes = map[ethernet.EtherType]bool{}
+	for _, etherType := range etherTypes {
+		t.etherTypes[etherType] = true
+	}
+
+	t.file = os.NewFile(uintptr(fd), tunDevicePath)
+	return nil
+}
+
+func setInterfaceUp(name string) error {
+	sock, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(sock)
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		return err
+	}
+
+	err = unix.IoctlIfreq(sock, unix.SIOCGIFFLAGS, ifr)
+	if err != nil {
+		return err
+	}
+
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(sock, unix.SIOCSIFFLAGS, ifr)
+}
+
+// InterfaceName returns the name of the TAP device, which may have been assigned by the kernel
+func (t *TapFrameTransport) InterfaceName() string {
+	return t.interfaceName
+}
+
+func (t *TapFrameTransport) ReadFrame(b []byte) (int, error) {
+	if t.file == nil {
+		return 0, ErrFrameTransportClosed
+	}
+
+	for {
+		n, err := t.file.Read(b)
+		if errors.Is(err, os.ErrClosed) {
+			return 0, ErrFrameTransportClosed
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if n < ethernetHeaderLength {
+			continue
+		}
+
+		// a TAP device delivers every frame, only pass the ones a listener was opened for
+		etherType := ethernet.EtherType(uint16(b[12])<<8 | uint16(b[13]))
+		if !t.etherTypes[etherType] {
+			continue
+		}
+
+		return n, nil
+	}
+}
+
+func (t *TapFrameTransport) WriteFrame(b []byte) error {
+	if len(b) < ethernetHeaderLength {
+		return ErrFrameTooShort
+	}
+
+	if t.file == nil {
+		return ErrFrameTransportClosed
+	}
+
+	_, err := t.file.Write(b)
+	if errors.Is(err, os.ErrClosed) {
+		return ErrFrameTransportClosed
+	}
+	return err
+}
+
+func (t *TapFrameTransport) HardwareAddr() net.HardwareAddr {
+	return t.hwAddr
+}
+
+func (t *TapFrameTransport) MTU() int {
+	return t.mtu
+}
+
+func (t *TapFrameTransport) Close() error {
+	var err error
+
+	t.closeOnce.Do(func() {
+		if t.file != nil {
+			err = t.file.Close()
+		}
+	})
+	return err
+}
@@ -0,0 +1,63 @@
+package edurouter_test
+
+import (
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTapFrameTransport(t *testing.T) {
+	tap := edurouter.NewTapFrameTransport("edutap%d")
+
+	err := tap.Open([]ethernet.EtherType{ethernet.EtherTypeARP})
+	if err != nil {
+		t.Skipf("TAP devices not available: %v", err)
+	}
+
+	name := tap.InterfaceName()
+	assert.NotEqual(t, "edutap%d", name)
+
+	ifi, err := net.InterfaceByName(name)
+	require.NoError(t, err)
+
+	assert.NotZero(t, ifi.Flags&net.FlagUp)
+	assert.EqualValues(t, ifi.MTU, tap.MTU())
+
+	// the kernel side of the device has its own hardware address
+	assert.NotEqual(t, ifi.HardwareAddr, tap.HardwareAddr())
+	assert.EqualValues(t, 0x02, tap.HardwareAddr()[0]&0x03)
+
+	frame := ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      tap.HardwareAddr(),
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     make([]byte, 46),
+	}
+	b, err := frame.MarshalBinary()
+	require.NoError(t, err)
+	assert.NoError(t, tap.WriteFrame(b))
+
+	readErr := make(chan error)
+	go func() {
+		_, err := tap.ReadFrame(make([]byte, tap.MTU()+14))
+		readErr <- err
+	}()
+
+	// closing interrupts pending reads and removes the device
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, tap.Close())
+
+	select {
+	case err := <-readErr:
+		assert.EqualError(t, err, edurouter.ErrFrameTransportClosed.Error())
+	case <-time.After(time.Second):
+		t.Fatal("read not interrupted by close")
+	}
+
+	_, err = net.InterfaceByName(name)
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+//go:build !linux
+
+package edurouter
+
+import (
+	"github.com/mdlayher/ethernet"
+	"net"
+)
+
+// TapFrameTransport is only available on Linux
+type TapFrameTransport struct {
+	interfaceName string
+	hwAddr        net.HardwareAddr
+}
+
+func NewTapFrameTransport(interfaceName string) *TapFrameTransport {
+	return &TapFrameTransport{
+		interfaceName: interfaceName,
+		hwAddr:        RandomHardwareAddr(),
+	}
+}
+
+func (t *TapFrameTransport) Open(etherTypes []ethernet.EtherType) error {
+	return ErrTapUnsupported
+}
+
+func (t *TapFrameTransport) InterfaceName() string {
+	return t.interfaceName
+}
+
+func (t *TapFrameTransport) ReadFrame(b []byte) (int, error) {
+	return 0, ErrTapUnsupported
+}
+
+func (t *TapFrameTransport) WriteFrame(b []byte) error {
+	return ErrTapUnsupported
+}
+
+func (t *TapFrameTransport) HardwareAddr() net.HardwareAddr {
+	return t.hwAddr
+}
+
+func (t *TapFrameTransport) MTU() int {
+	return 0
+}
+
+func (t *TapFrameTransport) Close() error {
+	return nil
+}
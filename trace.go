@@ -0,0 +1,223 @@
+package edurouter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceStage names the part of the router which recorded a TraceEvent
+type TraceStage string
+
+const (
+	TraceStageLinkLayer TraceStage = "link"
+	TraceStageARP       TraceStage = "arp"
+	TraceStageIPv4Input TraceStage = "ipv4-in"
+	TraceStageInternet  TraceStage = "internet"
+	TraceStageRoute     TraceStage = "route"
+	TraceStageTTL       TraceStage = "ttl"
+	TraceStageOptions   TraceStage = "options"
+	TraceStageTransport TraceStage = "transport"
+	TraceStageResolve   TraceStage = "resolve"
+	TraceStageOutput    TraceStage = "output"
+)
+
+// TraceEvent is a single decision taken while processing a packet
+type TraceEvent struct {
+	Timestamp time.Time
+	Stage     TraceStage
+	Message   string
+}
+
+// PacketTrace records the journey of a frame through the router.
+// All methods are safe to call on a nil *PacketTrace, which records nothing.
+type PacketTrace struct {
+	ID            uint64
+	InterfaceName string
+	Started       time.Time
+	events        []TraceEvent
+	stepper       *Stepper
+	stepping      bool
+	mu            sync.Mutex
+}
+
+func (t *PacketTrace) Record(stage TraceStage, format string, args ...any) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, TraceEvent{
+		Timestamp: time.Now(),
+		Stage:     stage,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// selectForStepping decides whether the packet is paused at its handler boundaries
+func (t *PacketTrace) selectForStepping(frame CapturedFrame) {
+	if t == nil || t.stepper == nil {
+		return
+	}
+
+	selected := t.stepper.selects(frame)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stepping = selected
+}
+
+// Checkpoint marks a handler boundary. In step mode the packet is paused here until it is resumed,
+// describe is only called then. Checkpoint returns false if the packet has to be dropped.
+func (t *PacketTrace) Checkpoint(ctx context.Context, stage TraceStage, describe func() string) bool {
+	if t == nil || t.stepper == nil {
+		return true
+	}
+
+	t.mu.Lock()
+	stepping := t.stepping
+	t.mu.Unlock()
+
+	if !stepping {
+		return true
+	}
+
+	switch t.stepper.pause(ctx, t, stage, describe()) {
+	case StepContinue:
+		t.mu.Lock()
+		t.stepping = false
+		t.mu.Unlock()
+
+		t.Record(stage, "continued in step mode")
+	case StepDrop:
+		t.Record(stage, "dropped in step mode")
+		return false
+	}
+
+	return true
+}
+
+func (t *PacketTrace) Events() []TraceEvent {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := make([]TraceEvent, len(t.events))
+	copy(events, t.events)
+	return events
+}
+
+// String renders the journey with the time elapsed since the trace was started
+func (t *PacketTrace) String() string {
+	if t == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "trace %d on %s at %s\n", t.ID, t.InterfaceName, t.Started.Format("15:04:05.000000"))
+
+	for _, e := range t.Events() {
+		elapsed := float64(e.Timestamp.Sub(t.Started).Microseconds()) / 1000
+		fmt.Fprintf(&sb, "  +%8.3fms  %-9s  %s\n", elapsed, e.Stage, e.Message)
+	}
+
+	return sb.String()
+}
+
+const DefaultTracerCapacity = 256
+
+// Tracer assigns trace IDs and keeps the most recent traces
+type Tracer struct {
+	traces  []*PacketTrace
+	nextID  uint64
+	stepper *Stepper
+	mu      sync.RWMutex
+}
+
+// NewTracer keeps up to capacity traces, older ones are forgotten
+func NewTracer(capacity int) *Tracer {
+	return &Tracer{
+		traces: make([]*PacketTrace, capacity),
+	}
+}
+
+// NewTrace starts the trace of a frame received on interfaceName.
+// A nil *Tracer returns a nil trace, so tracing can be left out entirely.
+func (t *Tracer) NewTrace(interfaceName string) *PacketTrace {
+	if t == nil || len(t.traces) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	trace := &PacketTrace{
+		ID:            t.nextID,
+		InterfaceName: interfaceName,
+		Started:       time.Now(),
+		stepper:       t.stepper,
+	}
+
+	t.traces[t.nextID%uint64(len(t.traces))] = trace
+	return trace
+}
+
+// SetStepper pauses new traces at their checkpoints while step mode is enabled
+func (t *Tracer) SetStepper(s *Stepper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stepper = s
+}
+
+// Get returns the trace with the given id, if it was not forgotten yet
+func (t *Tracer) Get(id uint64) (*PacketTrace, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if id == 0 || len(t.traces) == 0 {
+		return nil, false
+	}
+
+	trace := t.traces[id%uint64(len(t.traces))]
+	if trace == nil || trace.ID != id {
+		return nil, false
+	}
+	return trace, true
+}
+
+// Last returns the most recently started trace, or nil if there is none
+func (t *Tracer) Last() *PacketTrace {
+	t.mu.RLock()
+	id := t.nextID
+	t.mu.RUnlock()
+
+	trace, _ := t.Get(id)
+	return trace
+}
+
+// Traces returns all kept traces, oldest first
+func (t *Tracer) Traces() []*PacketTrace {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var traces []*PacketTrace
+
+	for i := 1; i <= len(t.traces); i++ {
+		trace := t.traces[(t.nextID+uint64(i))%uint64(len(t.traces))]
+		if trace != nil {
+			traces = append(traces, trace)
+		}
+	}
+	return traces
+}
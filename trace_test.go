@@ -0,0 +1,119 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPacketTrace_Nil(t *testing.T) {
+	var trace *edurouter.PacketTrace
+
+	trace.Record(edurouter.TraceStageRoute, "ignored %d", 1)
+	assert.Empty(t, trace.Events())
+	assert.Empty(t, trace.String())
+
+	var tracer *edurouter.Tracer
+	assert.Nil(t, tracer.NewTrace("eth0"))
+}
+
+func TestTracer(t *testing.T) {
+	tracer := edurouter.NewTracer(2)
+	assert.Nil(t, tracer.Last())
+
+	first := tracer.NewTrace("eth0")
+	second := tracer.NewTrace("eth1")
+	third := tracer.NewTrace("eth0")
+
+	assert.EqualValues(t, 1, first.ID)
+	assert.EqualValues(t, 3, third.ID)
+
+	_, ok := tracer.Get(first.ID)
+	assert.False(t, ok, "oldest trace is forgotten")
+
+	trace, ok := tracer.Get(second.ID)
+	assert.True(t, ok)
+	assert.Same(t, second, trace)
+
+	assert.Same(t, third, tracer.Last())
+	assert.Equal(t, []*edurouter.PacketTrace{second, third}, tracer.Traces())
+
+	third.Record(edurouter.TraceStageLinkLayer, "received %d bytes", 60)
+	events := third.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, edurouter.TraceStageLinkLayer, events[0].Stage)
+	assert.Equal(t, "received 60 bytes", events[0].Message)
+	assert.Contains(t, third.String(), "link       received 60 bytes\n")
+}
+
+func TestLinkLayerListener_TraceForwardedPacket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	segments := []*edurouter.VirtualSwitch{edurouter.NewVirtualSwitch(), edurouter.NewVirtualSwitch()}
+	r := newVirtualRouter(t, ctx, 1, segments, []string{"10.0.0.1/24", "10.0.1.1/24"})
+
+	hostHwAddr := net.HardwareAddr{2, 0, 0, 0, 0, 100}
+	dstHwAddr := net.HardwareAddr{2, 0, 0, 0, 0, 101}
+	dstIP := net.IP{10, 0, 1, 5}
+
+	// skip ARP resolution on the outgoing interface
+	require.NoError(t, r.interfaces[1].ArpTable.Store(dstIP, dstHwAddr))
+
+	host := segments[0].NewPort(hostHwAddr)
+	require.NoError(t, host.Open(nil))
+
+	dst := segments[1].NewPort(dstHwAddr)
+	require.NoError(t, dst.Open(nil))
+	dstFrames := readFrames(dst)
+
+	ipPdu := edurouter.NewIPv4Pdu(net.IP{10, 0, 0, 2}, dstIP, edurouter.IPProtocolUDP, []byte{1, 2, 3, 4})
+	ipPdu.TTL = edurouter.DefaultIPv4TTL
+	ipBinary, err := ipPdu.MarshalBinary()
+	require.NoError(t, err)
+
+	writeFrame(t, host, &ethernet.Frame{
+		Destination: *r.interfaces[0].HardwareAddr,
+		Source:      hostHwAddr,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     ipBinary,
+	})
+
+	require.NotNil(t, receiveFrame(dstFrames, time.Second))
+
+	trace := r.listener.Tracer().Last()
+	require.NotNil(t, trace)
+	assert.Equal(t, "eth0", trace.InterfaceName)
+
+	var stages []edurouter.TraceStage
+	var messages []string
+	for _, e := range trace.Events() {
+		stages = append(stages, e.Stage)
+		messages = append(messages, e.Message)
+	}
+
+	assert.Equal(t, []edurouter.TraceStage{
+		edurouter.TraceStageLinkLayer,
+		edurouter.TraceStageLinkLayer,
+		edurouter.TraceStageIPv4Input,
+		edurouter.TraceStageInternet,
+		edurouter.TraceStageRoute,
+		edurouter.TraceStageTTL,
+		edurouter.TraceStageResolve,
+		edurouter.TraceStageOutput,
+	}, stages)
+
+	journey := strings.Join(messages, "\n")
+	assert.Contains(t, journey, "dispatched to the IPv4 handler")
+	assert.Contains(t, journey, "10.0.1.5 is not local, forwarding")
+	assert.Contains(t, journey, "matched 10.0.1.0/24, directly connected on eth1")
+	assert.Contains(t, journey, "ttl decremented from 64 to 63")
+	assert.Contains(t, journey, "10.0.1.5 is at 02:00:00:00:00:65")
+	assert.Contains(t, journey, "on eth1")
+}
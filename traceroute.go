@@ -0,0 +1,186 @@
+package edurouter
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// tracerouteBasePort is the destination port of the first UDP probe, each further probe uses the next port
+const tracerouteBasePort = 33434
+
+// tracerouteProbeDataLength is the number of bytes sent after the ICMP or UDP header of a probe
+const tracerouteProbeDataLength = 32
+
+// TracerouteOptions configures the probes sent by a traceroute
+type TracerouteOptions struct {
+	// MaxHops is the highest TTL probed
+	MaxHops int
+	// Probes is the number of probes sent per TTL
+	Probes int
+	// Protocol is IPProtocolUDP for probes to unused ports, or IPProtocolICMPv4 for echo requests
+	Protocol IPProtocol
+	// Timeout is the time to wait for the answer to a probe
+	Timeout time.Duration
+}
+
+// DefaultTracerouteOptions uses the defaults of the classic traceroute, but waits only a second for each probe
+var DefaultTracerouteOptions = TracerouteOptions{
+	MaxHops:  30,
+	Probes:   3,
+	Protocol: IPProtocolUDP,
+	Timeout:  time.Second,
+}
+
+// Validate checks the protocol of the probes, that they are sent to at least one and at most 255 hops and that answers are awaited
+func (o TracerouteOptions) Validate() error {
+	if o.Protocol != IPProtocolICMPv4 && o.Protocol != IPProtocolUDP {
+		return ErrUnsupportedProbeProtocol
+	}
+
+	if o.MaxHops < 1 || o.MaxHops > 255 {
+		return ErrInvalidTracerouteHops
+	}
+
+	if o.Probes < 1 {
+		return ErrInvalidTracerouteProbes
+	}
+
+	if o.Timeout <= 0 {
+		return ErrInvalidProbeTimeout
+	}
+
+	return nil
+}
+
+// TracerouteProbe is the answer to a single probe. Src is nil if the probe was not answered in time.
+type TracerouteProbe struct {
+	Src  net.IP
+	RTT  time.Duration
+	Type IcmpType
+	Code uint8
+}
+
+// Final reports whether the probe reached the destination, or was rejected on the way
+func (p TracerouteProbe) Final() bool {
+	return p.Src != nil && (p.Type == IcmpTypeEchoReply || p.Type == IcmpTypeDestinationUnreachable)
+}
+
+// TracerouteHop holds the answers to the probes sent with the same TTL
+type TracerouteHop struct {
+	TTL    uint8
+	Probes []TracerouteProbe
+}
+
+// Traceroute sends probes to dstIP with increasing TTL, until the destination answers or MaxHops is reached.
+// hopDone is called after the probes of each TTL were answered or timed out, it may be nil.
+// If ctx is done, the hops probed so far are returned.
+func (i *IcmpHandler) Traceroute(ctx context.Context, dstIP net.IP, opts TracerouteOptions, hopDone func(TracerouteHop)) ([]TracerouteHop, error) {
+	dstIP = dstIP.To4()
+	if dstIP == nil {
+		return nil, ErrNotAnIPv4Address
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	id, replies := i.registerProbes(opts.Protocol)
+	defer i.unregisterProbes(opts.Protocol, id)
+
+	var hops []TracerouteHop
+	var seq uint16
+
+	for ttl := 1; ttl <= opts.MaxHops; ttl++ {
+		hop := TracerouteHop{TTL: uint8(ttl)}
+		final := false
+
+		for n := 0; n < opts.Probes; n++ {
+			seq++
+
+			probe := newProbePdu(dstIP, opts.Protocol, id, seq)
+			probe.TTL = hop.TTL
+
+			sent := time.Now()
+			select {
+			case i.publishCh <- probe:
+			case <-ctx.Done():
+				return hops, nil
+			}
+
+			answer, ok := waitForProbeReply(ctx, replies, seq, sent, opts.Timeout)
+			if !ok {
+				return hops, nil
+			}
+
+			hop.Probes = append(hop.Probes, answer)
+			final = final || answer.Final()
+		}
+
+		hops = append(hops, hop)
+		if hopDone != nil {
+			hopDone(hop)
+		}
+
+		if final {
+			break
+		}
+	}
+
+	return hops, nil
+}
+
+// waitForProbeReply waits for the reply to probe seq, replies to earlier probes are skipped.
+// It returns false if ctx is done.
+func waitForProbeReply(ctx context.Context, replies <-chan ICMPReply, seq uint16, sent time.Time, timeout time.Duration) (TracerouteProbe, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return TracerouteProbe{}, false
+		case <-timer.C:
+			return TracerouteProbe{}, true
+		case reply := <-replies:
+			if reply.Seq != seq {
+				continue
+			}
+
+			return TracerouteProbe{
+				Src:  reply.Src,
+				RTT:  reply.Received.Sub(sent),
+				Type: reply.Type,
+				Code: reply.Code,
+			}, true
+		}
+	}
+}
+
+// newProbePdu builds an ICMP echo request, or a UDP datagram to port tracerouteBasePort+seq from port id
+func newProbePdu(dstIP net.IP, protocol IPProtocol, id, seq uint16) *IPv4Pdu {
+	var payload []byte
+
+	switch protocol {
+	case IPProtocolICMPv4:
+		icmpPacket := ICMPPacket{
+			IcmpType: IcmpTypeEchoRequest,
+			Id:       id,
+			Seq:      seq,
+			Data:     make([]byte, tracerouteProbeDataLength),
+		}
+
+		// never returns an error
+		payload, _ = icmpPacket.MarshalBinary()
+
+	case IPProtocolUDP:
+		// the checksum is optional and left empty
+		payload = make([]byte, 8+tracerouteProbeDataLength)
+		binary.BigEndian.PutUint16(payload[0:2], id)
+		binary.BigEndian.PutUint16(payload[2:4], tracerouteBasePort+seq)
+		binary.BigEndian.PutUint16(payload[4:6], uint16(len(payload)))
+	}
+
+	return NewIPv4Pdu(nil, dstIP, protocol, payload)
+}
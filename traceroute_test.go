@@ -0,0 +1,151 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIcmpHandler_Traceroute(t *testing.T) {
+	tests := map[string]struct {
+		protocol edurouter.IPProtocol
+		wantType edurouter.IcmpType
+		wantCode uint8
+	}{
+		"ICMP": {
+			protocol: edurouter.IPProtocolICMPv4,
+			wantType: edurouter.IcmpTypeEchoReply,
+		},
+		"UDP": {
+			protocol: edurouter.IPProtocolUDP,
+			wantType: edurouter.IcmpTypeDestinationUnreachable,
+			// the router has no UDP handler
+			wantCode: edurouter.IcmpCodeProtocolUnreachable,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r1 := newRouterChain(t, ctx)
+
+			opts := edurouter.TracerouteOptions{
+				MaxHops:  5,
+				Probes:   2,
+				Protocol: v.protocol,
+				Timeout:  time.Second,
+			}
+
+			var reported []edurouter.TracerouteHop
+			hops, err := r1.listener.Traceroute(ctx, net.IP{10, 0, 2, 2}, opts, func(hop edurouter.TracerouteHop) {
+				reported = append(reported, hop)
+			})
+			require.NoError(t, err)
+			assert.Equal(t, hops, reported)
+
+			require.Len(t, hops, 2)
+
+			for _, p := range hops[0].Probes {
+				assert.EqualValues(t, net.IP{10, 0, 1, 2}, p.Src)
+				assert.Equal(t, edurouter.IcmpTypeTimeExceeded, p.Type)
+				assert.False(t, p.Final())
+			}
+
+			assert.EqualValues(t, 2, hops[1].TTL)
+			require.Len(t, hops[1].Probes, 2)
+			for _, p := range hops[1].Probes {
+				assert.EqualValues(t, net.IP{10, 0, 2, 2}, p.Src)
+				assert.Equal(t, v.wantType, p.Type)
+				assert.Equal(t, v.wantCode, p.Code)
+				assert.Greater(t, p.RTT, time.Duration(0))
+				assert.True(t, p.Final())
+			}
+		})
+	}
+}
+
+func TestIcmpHandler_TracerouteTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	segments := []*edurouter.VirtualSwitch{edurouter.NewVirtualSwitch(), edurouter.NewVirtualSwitch()}
+	r1 := newVirtualRouter(t, ctx, 1, segments, []string{"10.0.0.1/24", "10.0.1.1/24"})
+
+	// nobody answers behind the next hop
+	r1.addStaticRoute(t, "10.0.2.0/24", "10.0.1.2", 1)
+	timeouts := edurouter.DefaultARPTimeouts
+	timeouts.MaxProbes = 1
+	timeouts.RetransTime = 10 * time.Millisecond
+	r1.interfaces[1].ArpTable.SetTimeouts(timeouts)
+
+	opts := edurouter.TracerouteOptions{
+		MaxHops:  2,
+		Probes:   1,
+		Protocol: edurouter.IPProtocolICMPv4,
+		Timeout:  50 * time.Millisecond,
+	}
+
+	hops, err := r1.listener.Traceroute(ctx, net.IP{10, 0, 2, 2}, opts, nil)
+	require.NoError(t, err)
+	require.Len(t, hops, 2)
+	for _, hop := range hops {
+		assert.Nil(t, hop.Probes[0].Src)
+	}
+
+	_, err = r1.listener.Traceroute(ctx, net.IP{10, 0, 2, 2}, edurouter.TracerouteOptions{Protocol: edurouter.IPProtocolTCP}, nil)
+	assert.ErrorIs(t, err, edurouter.ErrUnsupportedProbeProtocol)
+}
+
+func TestTracerouteOptions_Validate(t *testing.T) {
+	tests := map[string]struct {
+		modify  func(o *edurouter.TracerouteOptions)
+		wantErr error
+	}{
+		"Default": {
+			modify:  func(o *edurouter.TracerouteOptions) {},
+			wantErr: nil,
+		},
+		"MaxHops255": {
+			modify:  func(o *edurouter.TracerouteOptions) { o.MaxHops = 255 },
+			wantErr: nil,
+		},
+		"MaxHopsTooLarge": {
+			modify:  func(o *edurouter.TracerouteOptions) { o.MaxHops = 256 },
+			wantErr: edurouter.ErrInvalidTracerouteHops,
+		},
+		"NoHops": {
+			modify:  func(o *edurouter.TracerouteOptions) { o.MaxHops = 0 },
+			wantErr: edurouter.ErrInvalidTracerouteHops,
+		},
+		"NoProbes": {
+			modify:  func(o *edurouter.TracerouteOptions) { o.Probes = 0 },
+			wantErr: edurouter.ErrInvalidTracerouteProbes,
+		},
+		"NegativeProbes": {
+			modify:  func(o *edurouter.TracerouteOptions) { o.Probes = -1 },
+			wantErr: edurouter.ErrInvalidTracerouteProbes,
+		},
+		"NoTimeout": {
+			modify:  func(o *edurouter.TracerouteOptions) { o.Timeout = 0 },
+			wantErr: edurouter.ErrInvalidProbeTimeout,
+		},
+		"TCP": {
+			modify:  func(o *edurouter.TracerouteOptions) { o.Protocol = edurouter.IPProtocolTCP },
+			wantErr: edurouter.ErrUnsupportedProbeProtocol,
+		},
+	}
+
+	for name, v := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := edurouter.DefaultTracerouteOptions
+			v.modify(&opts)
+			assert.ErrorIs(t, opts.Validate(), v.wantErr)
+		})
+	}
+}
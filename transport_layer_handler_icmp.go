@@ -2,47 +2,116 @@ package edurouter
 
 import (
 	"context"
-	"crypto/rand"
-	"fmt"
-	"github.com/rs/zerolog/log"
+	"encoding/binary"
+	mathrand "math/rand"
 	"net"
+	"sync"
 	"time"
 )
 
 type IcmpHandler struct {
 	supplierCh chan *IPv4Pdu
 	publishCh  chan<- *IPv4Pdu
+
+	// probes are waiting for ICMP replies, by protocol and id of the probe
+	probes  map[probeKey]chan ICMPReply
+	nextID  uint16
+	probeMu sync.Mutex
+}
+
+// probeKey identifies the probes of a traceroute or ping: the ICMP echo id, or the UDP source port
+type probeKey struct {
+	protocol IPProtocol
+	id       uint16
+}
+
+// ICMPReply is an ICMP message answering a probe sent by the router
+type ICMPReply struct {
+	Src      net.IP
+	TTL      uint8
+	Type     IcmpType
+	Code     uint8
+	Seq      uint16
+	Length   int
+	Received time.Time
+	// Route holds the addresses of a record route option
+	Route []net.IP
 }
 
 func NewIcmpHandler(publishCh chan<- *IPv4Pdu) *IcmpHandler {
 	return &IcmpHandler{
 		supplierCh: make(chan *IPv4Pdu, 128),
 		publishCh:  publishCh,
+		probes:     make(map[probeKey]chan ICMPReply),
+		nextID:     uint16(mathrand.Intn(1 << 16)),
 	}
 }
 
-func (i *IcmpHandler) Ping(dstIP net.IP, numPings uint16) {
-	dstIP = dstIP.To4()
+// registerProbes returns an unused id for probes of protocol, and the channel receiving their replies
+func (i *IcmpHandler) registerProbes(protocol IPProtocol) (uint16, <-chan ICMPReply) {
+	i.probeMu.Lock()
+	defer i.probeMu.Unlock()
+
+	for {
+		i.nextID++
+		key := probeKey{protocol: protocol, id: i.nextID}
 
-	for seq := uint16(1); seq <= numPings; seq++ {
-		icmpPacket := ICMPPacket{
-			IcmpType: IcmpTypeEchoRequest,
-			Id:       200 + seq,
-			Seq:      seq,
-			Data:     make([]byte, 48, 48),
+		if _, ok := i.probes[key]; !ok {
+			replies := make(chan ICMPReply, 16)
+			i.probes[key] = replies
+			return key.id, replies
 		}
+	}
+}
 
-		_, _ = rand.Read(icmpPacket.Data)
+func (i *IcmpHandler) unregisterProbes(protocol IPProtocol, id uint16) {
+	i.probeMu.Lock()
+	defer i.probeMu.Unlock()
 
-		// never returns an error
-		icmpBinary, _ := icmpPacket.MarshalBinary()
+	delete(i.probes, probeKey{protocol: protocol, id: id})
+}
 
-		ipPdu := NewIPv4Pdu(nil, dstIP, IPProtocolICMPv4, icmpBinary)
+// deliverReply hands reply to the probes with key and reports whether they were found
+func (i *IcmpHandler) deliverReply(key probeKey, reply ICMPReply) bool {
+	i.probeMu.Lock()
+	defer i.probeMu.Unlock()
 
-		i.publishCh <- ipPdu
+	replies, ok := i.probes[key]
+	if !ok {
+		return false
+	}
 
-		time.Sleep(time.Second)
+	select {
+	case replies <- reply:
+	default:
+		Logger(LogSubsystemICMP).Debug().Uint16("id", key.id).Msg("icmp reply dropped, probe is not reading")
 	}
+	return true
+}
+
+// probeOfError returns the probe quoted in an ICMP error message
+func probeOfError(icmpPacket *ICMPPacket) (probeKey, uint16, bool) {
+	var quoted IPv4Pdu
+	if (&quoted).UnmarshalBinary(icmpPacket.Data) != nil || len(quoted.Payload) < 8 {
+		return probeKey{}, 0, false
+	}
+
+	switch quoted.Protocol {
+	case IPProtocolICMPv4:
+		if IcmpType(quoted.Payload[0]) != IcmpTypeEchoRequest {
+			return probeKey{}, 0, false
+		}
+		id := binary.BigEndian.Uint16(quoted.Payload[4:6])
+		seq := binary.BigEndian.Uint16(quoted.Payload[6:8])
+		return probeKey{protocol: IPProtocolICMPv4, id: id}, seq, true
+
+	case IPProtocolUDP:
+		srcPort := binary.BigEndian.Uint16(quoted.Payload[0:2])
+		dstPort := binary.BigEndian.Uint16(quoted.Payload[2:4])
+		return probeKey{protocol: IPProtocolUDP, id: srcPort}, dstPort - tracerouteBasePort, true
+	}
+
+	return probeKey{}, 0, false
 }
 
 func (i *IcmpHandler) SupplierC() chan<- *IPv4Pdu {
@@ -65,7 +134,7 @@ func (i *IcmpHandler) runHandler(ctx context.Context) {
 				continue
 			}
 			if err != nil {
-				log.Error().Msgf("error during icmp handling: %v", err)
+				Logger(LogSubsystemICMP).Error().Msgf("error during icmp handling: %v", err)
 				continue
 			}
 
@@ -84,15 +153,52 @@ func (i *IcmpHandler) handle(packet *IPv4Pdu) (*IPv4Pdu, error) {
 	}
 
 	if icmpPacket.IcmpType == IcmpTypeEchoRequest {
+		Logger(LogSubsystemICMP).Debug().
+			Stringer("src", packet.SrcIP).
+			Uint16("id", icmpPacket.Id).
+			Uint16("seq", icmpPacket.Seq).
+			Msg("answering echo request")
+
 		icmpPacket.MakeResponse()
 
 		// never returns an error
 		icmpBinary, _ := icmpPacket.MarshalBinary()
 
-		return NewIPv4Pdu(packet.DstIP, packet.SrcIP, IPProtocolICMPv4, icmpBinary), nil
+		reply := NewIPv4Pdu(packet.DstIP, packet.SrcIP, IPProtocolICMPv4, icmpBinary)
+		reply.Options = echoReplyOptions(packet.Options)
+		return reply, nil
 	}
+	reply := ICMPReply{
+		Src:      packet.SrcIP,
+		TTL:      packet.TTL,
+		Type:     icmpPacket.IcmpType,
+		Code:     icmpPacket.IcmpCode,
+		Seq:      icmpPacket.Seq,
+		Length:   len(packet.Payload),
+		Received: time.Now(),
+		Route:    RecordedRoute(packet.Options),
+	}
+
+	switch icmpPacket.IcmpType {
+	case IcmpTypeEchoReply:
+		if i.deliverReply(probeKey{protocol: IPProtocolICMPv4, id: icmpPacket.Id}, reply) {
+			return nil, ErrDropPdu
+		}
+	case IcmpTypeTimeExceeded, IcmpTypeDestinationUnreachable:
+		key, seq, ok := probeOfError(&icmpPacket)
+		if ok {
+			reply.Seq = seq
+			i.deliverReply(key, reply)
+		}
+		return nil, ErrDropPdu
+	}
+
 	if icmpPacket.IcmpType == IcmpTypeEchoReply {
-		fmt.Printf("64 bytes from %s: icmp_seq=%d, ttl=%d\n", packet.SrcIP.String(), icmpPacket.Seq, packet.TTL)
+		Logger(LogSubsystemICMP).Debug().
+			Stringer("src", packet.SrcIP).
+			Uint16("id", icmpPacket.Id).
+			Uint16("seq", icmpPacket.Seq).
+			Msg("echo reply without ping session, dropped")
 	}
 
 	return nil, ErrDropPdu
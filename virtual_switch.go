@@ -0,0 +1,181 @@
+package edurouter
+
+import (
+	"bytes"
+	"github.com/mdlayher/ethernet"
+	"net"
+	"sync"
+)
+
+const (
+	DefaultVirtualSwitchMTU = 1500
+	virtualPortQueueLength  = 256
+)
+
+// VirtualSwitch is an in-memory layer 2 segment.
+// Frames written to one of its ports are delivered to the port owning the destination MAC.
+// Broadcast and multicast frames are flooded to all other ports.
+type VirtualSwitch struct {
+	ports []*VirtualSwitchPort
+	mu    sync.RWMutex
+}
+
+func NewVirtualSwitch() *VirtualSwitch {
+	return &VirtualSwitch{
+		ports: make([]*VirtualSwitchPort, 0),
+		mu:    sync.RWMutex{},
+	}
+}
+
+// NewPort attaches a new port with the given hardware address to the switch.
+// The port implements FrameTransport and is intended to be used by an InterfaceConfig.
+func (s *VirtualSwitch) NewPort(hwAddr net.HardwareAddr) *VirtualSwitchPort {
+	port := &VirtualSwitchPort{
+		sw:     s,
+		hwAddr: hwAddr,
+		mtu:    DefaultVirtualSwitchMTU,
+		rx:     make(chan []byte, virtualPortQueueLength),
+		done:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ports = append(s.ports, port)
+	return port
+}
+
+func (s *VirtualSwitch) detach(port *VirtualSwitchPort) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.ports {
+		if p == port {
+			s.ports = append(s.ports[:i], s.ports[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *VirtualSwitch) forward(from *VirtualSwitchPort, b []byte) {
+	dst := net.HardwareAddr(b[0:6])
+	etherType := ethernet.EtherType(uint16(b[12])<<8 | uint16(b[13]))
+
+	// the group bit is set for broadcast and multicast addresses
+	flood := dst[0]&0x01 == 0x01
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.ports {
+		if p == from {
+			continue
+		}
+
+		if flood || bytes.Equal(p.hwAddr, dst) {
+			p.deliver(etherType, b)
+		}
+	}
+}
+
+// VirtualSwitchPort is a FrameTransport attached to a VirtualSwitch
+type VirtualSwitchPort struct {
+	sw         *VirtualSwitch
+	hwAddr     net.HardwareAddr
+	mtu        int
+	etherTypes map[ethernet.EtherType]bool
+	rx         chan []byte
+	done       chan struct{}
+	open       bool
+	closeOnce  sync.Once
+	mu         sync.RWMutex
+}
+
+// Open starts receiving frames of the given ether types. If no ether types are given, all frames are received.
+func (p *VirtualSwitchPort) Open(etherTypes []ethernet.EtherType) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return ErrFrameTransportClosed
+	default:
+	}
+
+	if len(etherTypes) > 0 {
+		p.etherTypes = map[ethernet.EtherType]bool{}
+		for _, etherType := range etherTypes {
+			p.etherTypes[etherType] = true
+		}
+	}
+
+	p.open = true
+	return nil
+}
+
+func (p *VirtualSwitchPort) deliver(etherType ethernet.EtherType, b []byte) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !p.open {
+		return
+	}
+
+	if p.etherTypes != nil && !p.etherTypes[etherType] {
+		return
+	}
+
+	frame := make([]byte, len(b))
+	copy(frame, b)
+
+	select {
+	case p.rx <- frame:
+	default:
+		// queue is full, the frame is lost like on a congested switch
+	}
+}
+
+func (p *VirtualSwitchPort) ReadFrame(b []byte) (int, error) {
+	select {
+	case frame := <-p.rx:
+		return copy(b, frame), nil
+	case <-p.done:
+		return 0, ErrFrameTransportClosed
+	}
+}
+
+func (p *VirtualSwitchPort) WriteFrame(b []byte) error {
+	if len(b) < ethernetHeaderLength {
+		return ErrFrameTooShort
+	}
+
+	select {
+	case <-p.done:
+		return ErrFrameTransportClosed
+	default:
+	}
+
+	p.sw.forward(p, b)
+	return nil
+}
+
+func (p *VirtualSwitchPort) HardwareAddr() net.HardwareAddr {
+	return p.hwAddr
+}
+
+func (p *VirtualSwitchPort) MTU() int {
+	return p.mtu
+}
+
+func (p *VirtualSwitchPort) Close() error {
+	p.closeOnce.Do(func() {
+		p.sw.detach(p)
+
+		p.mu.Lock()
+		p.open = false
+		p.mu.Unlock()
+
+		close(p.done)
+	})
+	return nil
+}
@@ -0,0 +1,314 @@
+package edurouter_test
+
+import (
+	"context"
+	"github.com/davidkroell/edurouter"
+	"github.com/mdlayher/ethernet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+// readFrames decodes all frames received on port into the returned channel
+func readFrames(port *edurouter.VirtualSwitchPort) <-chan *ethernet.Frame {
+	frameCh := make(chan *ethernet.Frame, 16)
+
+	go func() {
+		b := make([]byte, port.MTU()+14)
+		for {
+			n, err := port.ReadFrame(b)
+			if err != nil {
+				close(frameCh)
+				return
+			}
+
+			var f ethernet.Frame
+			if (&f).UnmarshalBinary(append([]byte{}, b[:n]...)) == nil {
+				frameCh <- &f
+			}
+		}
+	}()
+
+	return frameCh
+}
+
+func receiveFrame(frameCh <-chan *ethernet.Frame, timeout time.Duration) *ethernet.Frame {
+	select {
+	case f := <-frameCh:
+		return f
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func writeFrame(t *testing.T, port *edurouter.VirtualSwitchPort, f *ethernet.Frame) {
+	b, err := f.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, port.WriteFrame(b))
+}
+
+func TestVirtualSwitch_Delivery(t *testing.T) {
+	sw := edurouter.NewVirtualSwitch()
+
+	hwAddr1 := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	hwAddr2 := net.HardwareAddr{2, 0, 0, 0, 0, 2}
+	hwAddr3 := net.HardwareAddr{2, 0, 0, 0, 0, 3}
+
+	port1 := sw.NewPort(hwAddr1)
+	port2 := sw.NewPort(hwAddr2)
+	port3 := sw.NewPort(hwAddr3)
+
+	require.NoError(t, port1.Open(nil))
+	require.NoError(t, port2.Open(nil))
+	require.NoError(t, port3.Open([]ethernet.EtherType{ethernet.EtherTypeARP}))
+
+	frames1 := readFrames(port1)
+	frames2 := readFrames(port2)
+	frames3 := readFrames(port3)
+
+	t.Run("Unicast", func(t *testing.T) {
+		writeFrame(t, port1, &ethernet.Frame{
+			Destination: hwAddr2,
+			Source:      hwAddr1,
+			EtherType:   ethernet.EtherTypeARP,
+			Payload:     make([]byte, 46),
+		})
+
+		f := receiveFrame(frames2, time.Second)
+		require.NotNil(t, f)
+		assert.EqualValues(t, hwAddr1, f.Source)
+
+		assert.Nil(t, receiveFrame(frames1, 50*time.Millisecond))
+		assert.Nil(t, receiveFrame(frames3, 50*time.Millisecond))
+	})
+
+	t.Run("Broadcast", func(t *testing.T) {
+		writeFrame(t, port1, &ethernet.Frame{
+			Destination: ethernet.Broadcast,
+			Source:      hwAddr1,
+			EtherType:   ethernet.EtherTypeARP,
+			Payload:     make([]byte, 46),
+		})
+
+		assert.NotNil(t, receiveFrame(frames2, time.Second))
+		assert.NotNil(t, receiveFrame(frames3, time.Second))
+		assert.Nil(t, receiveFrame(frames1, 50*time.Millisecond))
+	})
+
+	t.Run("EtherTypeFilter", func(t *testing.T) {
+		writeFrame(t, port1, &ethernet.Frame{
+			Destination: ethernet.Broadcast,
+			Source:      hwAddr1,
+			EtherType:   ethernet.EtherTypeIPv4,
+			Payload:     make([]byte, 46),
+		})
+
+		assert.NotNil(t, receiveFrame(frames2, time.Second))
+		assert.Nil(t, receiveFrame(frames3, 50*time.Millisecond))
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		require.NoError(t, port3.Close())
+
+		_, ok := <-frames3
+		assert.False(t, ok)
+
+		_, err := port3.ReadFrame(make([]byte, 64))
+		assert.EqualError(t, err, edurouter.ErrFrameTransportClosed.Error())
+		assert.EqualError(t, port3.WriteFrame(make([]byte, 64)), edurouter.ErrFrameTransportClosed.Error())
+	})
+}
+
+type virtualRouter struct {
+	listener   *edurouter.LinkLayerListener
+	interfaces []*edurouter.InterfaceConfig
+}
+
+func newVirtualRouter(t *testing.T, ctx context.Context, id byte, segments []*edurouter.VirtualSwitch, addrs []string) *virtualRouter {
+	r := &virtualRouter{}
+
+	for i, addr := range addrs {
+		ip, ipNet, err := net.ParseCIDR(addr)
+		require.NoError(t, err)
+		ipNet.IP = ip
+
+		iface, err := edurouter.NewInterfaceConfig("eth"+string(rune('0'+i)), ipNet)
+		require.NoError(t, err)
+
+		iface.Transport = segments[i].NewPort(net.HardwareAddr{2, 0, 0, 0, id, byte(i)})
+		r.interfaces = append(r.interfaces, iface)
+	}
+
+	r.listener = edurouter.NewLinkLayerListener(r.interfaces...)
+	go r.listener.ListenAndServe(ctx)
+
+	require.Eventually(t, func() bool {
+		return len(r.listener.Interfaces()) == len(addrs)
+	}, time.Second, 10*time.Millisecond)
+
+	return r
+}
+
+func (r *virtualRouter) addStaticRoute(t *testing.T, dstNet string, nextHop string, ifaceIndex int) {
+	_, ipNet, err := net.ParseCIDR(dstNet)
+	require.NoError(t, err)
+
+	nextHopIP := net.ParseIP(nextHop).To4()
+
+	err = r.listener.RouteTable().AddRoute(edurouter.RouteInfo{
+		RouteType:    edurouter.StaticRouteType,
+		DstNet:       *ipNet,
+		NextHop:      &nextHopIP,
+		OutInterface: r.interfaces[ifaceIndex],
+	})
+	require.NoError(t, err)
+}
+
+// newRouterChain connects r1 -- seg1 -- r2 -- seg2 -- r3 and returns r1.
+// ARP requests for unknown hosts on seg2 time out quickly.
+func newRouterChain(t *testing.T, ctx context.Context) *virtualRouter {
+	segments := []*edurouter.VirtualSwitch{
+		edurouter.NewVirtualSwitch(),
+		edurouter.NewVirtualSwitch(),
+		edurouter.NewVirtualSwitch(),
+	}
+
+	r1 := newVirtualRouter(t, ctx, 1, segments[0:2], []string{"10.0.0.1/24", "10.0.1.1/24"})
+	r2 := newVirtualRouter(t, ctx, 2, segments[1:3], []string{"10.0.1.2/24", "10.0.2.1/24"})
+	r3 := newVirtualRouter(t, ctx, 3, segments[2:3], []string{"10.0.2.2/24"})
+
+	r1.addStaticRoute(t, "10.0.2.0/24", "10.0.1.2", 1)
+	r3.addStaticRoute(t, "10.0.0.0/16", "10.0.2.1", 0)
+
+	timeouts := edurouter.DefaultARPTimeouts
+	timeouts.MaxProbes = 1
+	timeouts.RetransTime = 10 * time.Millisecond
+	r2.interfaces[1].ArpTable.SetTimeouts(timeouts)
+
+	return r1
+}
+
+// twoSegmentSetup is a router between a host on 10.0.0.0/24 and a receiver on 10.0.1.0/24.
+// The router resolves the receiver with a static ARP entry.
+type twoSegmentSetup struct {
+	router         *virtualRouter
+	host           *edurouter.VirtualSwitchPort
+	hostFrames     <-chan *ethernet.Frame
+	hostIP         net.IP
+	receiver       *edurouter.VirtualSwitchPort
+	receiverFrames <-chan *ethernet.Frame
+	receiverIP     net.IP
+}
+
+func newTwoSegmentSetup(t *testing.T, ctx context.Context, receiverIP net.IP) *twoSegmentSetup {
+	segments := []*edurouter.VirtualSwitch{edurouter.NewVirtualSwitch(), edurouter.NewVirtualSwitch()}
+	r := newVirtualRouter(t, ctx, 1, segments, []string{"10.0.0.1/24", "10.0.1.1/24"})
+
+	host := segments[0].NewPort(net.HardwareAddr{2, 0, 0, 0, 0, 100})
+	require.NoError(t, host.Open(nil))
+
+	receiver := segments[1].NewPort(net.HardwareAddr{2, 0, 0, 0, 1, receiverIP.To4()[3]})
+	require.NoError(t, receiver.Open(nil))
+	require.NoError(t, r.interfaces[1].ArpTable.Store(receiverIP, receiver.HardwareAddr()))
+
+	return &twoSegmentSetup{
+		router:         r,
+		host:           host,
+		hostFrames:     readFrames(host),
+		hostIP:         net.IP{10, 0, 0, 2},
+		receiver:       receiver,
+		receiverFrames: readFrames(receiver),
+		receiverIP:     receiverIP,
+	}
+}
+
+// sendPdu writes an IP packet from the host to the router
+func (s *twoSegmentSetup) sendPdu(t *testing.T, ipPdu *edurouter.IPv4Pdu) {
+	ipBinary, err := ipPdu.MarshalBinary()
+	require.NoError(t, err)
+
+	writeFrame(t, s.host, &ethernet.Frame{
+		Destination: *s.router.interfaces[0].HardwareAddr,
+		Source:      s.host.HardwareAddr(),
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     ipBinary,
+	})
+}
+
+func TestVirtualSwitch_PingAcrossThreeRouters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// host -- seg0 -- r1 -- seg1 -- r2 -- seg2 -- r3 -- seg3
+	segments := []*edurouter.VirtualSwitch{
+		edurouter.NewVirtualSwitch(),
+		edurouter.NewVirtualSwitch(),
+		edurouter.NewVirtualSwitch(),
+		edurouter.NewVirtualSwitch(),
+	}
+
+	r1 := newVirtualRouter(t, ctx, 1, segments[0:2], []string{"10.0.0.1/24", "10.0.1.1/24"})
+	r2 := newVirtualRouter(t, ctx, 2, segments[1:3], []string{"10.0.1.2/24", "10.0.2.1/24"})
+	r3 := newVirtualRouter(t, ctx, 3, segments[2:4], []string{"10.0.2.2/24", "10.0.3.1/24"})
+
+	r1.addStaticRoute(t, "10.0.2.0/24", "10.0.1.2", 1)
+	r1.addStaticRoute(t, "10.0.3.0/24", "10.0.1.2", 1)
+	r2.addStaticRoute(t, "10.0.0.0/24", "10.0.1.1", 0)
+	r2.addStaticRoute(t, "10.0.3.0/24", "10.0.2.2", 1)
+	r3.addStaticRoute(t, "10.0.0.0/24", "10.0.2.1", 0)
+	r3.addStaticRoute(t, "10.0.1.0/24", "10.0.2.1", 0)
+
+	hostHwAddr := net.HardwareAddr{2, 0, 0, 0, 0, 100}
+	hostIP := net.IP{10, 0, 0, 2}
+	dstIP := net.IP{10, 0, 2, 2}
+
+	host := segments[0].NewPort(hostHwAddr)
+	require.NoError(t, host.Open(nil))
+	hostFrames := readFrames(host)
+
+	icmpRequest := edurouter.ICMPPacket{
+		IcmpType: edurouter.IcmpTypeEchoRequest,
+		Id:       1,
+		Seq:      1,
+		Data:     []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	icmpBinary, err := icmpRequest.MarshalBinary()
+	require.NoError(t, err)
+
+	ipPdu := edurouter.NewIPv4Pdu(hostIP, dstIP, edurouter.IPProtocolICMPv4, icmpBinary)
+	ipPdu.TTL = edurouter.DefaultIPv4TTL
+	ipBinary, err := ipPdu.MarshalBinary()
+	require.NoError(t, err)
+
+	writeFrame(t, host, &ethernet.Frame{
+		Destination: *r1.interfaces[0].HardwareAddr,
+		Source:      hostHwAddr,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     ipBinary,
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		f := receiveFrame(hostFrames, time.Until(deadline))
+		if f == nil || f.EtherType != ethernet.EtherTypeIPv4 {
+			continue
+		}
+
+		var reply edurouter.IPv4Pdu
+		require.NoError(t, (&reply).UnmarshalBinary(f.Payload))
+
+		var icmpReply edurouter.ICMPPacket
+		require.NoError(t, (&icmpReply).UnmarshalBinary(reply.Payload))
+
+		assert.EqualValues(t, dstIP, reply.SrcIP)
+		assert.EqualValues(t, hostIP, reply.DstIP)
+		assert.EqualValues(t, edurouter.IcmpTypeEchoReply, icmpReply.IcmpType)
+		assert.EqualValues(t, icmpRequest.Seq, icmpReply.Seq)
+		assert.EqualValues(t, *r1.interfaces[0].HardwareAddr, f.Source)
+		return
+	}
+
+	t.Fatal("no echo reply received")
+}